@@ -2,26 +2,194 @@ package spamc
 
 import (
 	"bufio"
+	"bytes"
 	"context"
-	"fmt"
+	"crypto/tls"
 	"io"
+	"io/ioutil"
 	"net"
+	"net/mail"
 	"net/textproto"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
 // Client is a connection to the spamd daemon.
+//
+// A Client is safe for concurrent use: every command dials its own connection,
+// which is closed once the response is read. The exported fields shouldn't be
+// modified once the Client is in use; use Clone() to get a Client with
+// different settings.
 type Client struct {
 	// DefaultUser is the User to send if a command didn't specify one.
 	DefaultUser string
 
-	addr   string
-	dialer Dialer
-	conn   net.Conn
+	// Router selects the spamd backend based on the User header; commands are
+	// sent to the address passed to New() if this is nil or if it doesn't
+	// return an address.
+	Router Router
+
+	// Balancer selects the backend for commands that aren't routed by the
+	// Router, from the backends set with SetBackends(); commands are
+	// distributed with round-robin if this is nil.
+	Balancer Balancer
+
+	// BackendLimit and BackendLimits limit the number of commands in
+	// progress per backend; see WithBackendLimits().
+	BackendLimit  int
+	BackendLimits map[string]int
+
+	// Threshold is the score from which a message is considered spam. If this
+	// is 0 then spamd's verdict is used.
+	//
+	// This only affects IsSpam; BaseScore is always the server's required
+	// score.
+	Threshold float64
+
+	// DefaultHeaders are sent with every command, unless the command sets the
+	// header itself. Use WithDefaultHeaders() to set this on a clone, as the
+	// map shouldn't be modified once the Client is in use.
+	//
+	// A Compress header is ignored, as the message wouldn't be compressed;
+	// use Compress instead.
+	DefaultHeaders Header
+
+	// Compress messages with zlib, to reduce the amount of data sent to
+	// spamd. Messages are compressed after the Preprocessor was run.
+	Compress bool
+
+	// Timeout for connecting to spamd and running a command. If this is 0 the
+	// dialer's Timeout is used if it's a *net.Dialer.
+	Timeout time.Duration
+
+	// IdleTimeout is the maximum time a command can be idle; the deadline is
+	// extended after every read and write. If this is set Timeout is only
+	// used for connecting, so that large messages can be processed over a
+	// slow connection without hanging forever.
+	IdleTimeout time.Duration
+
+	// Preprocessor modifies messages before they're sent; for example a
+	// MIMEReducer. The Content-length header is always recalculated when
+	// this is set.
+	Preprocessor Preprocessor
+
+	// UserFromMessage sets the User header from the message's headers if the
+	// command didn't specify one; for example RecipientUser. DefaultUser is
+	// used if this returns an empty string.
+	UserFromMessage UserExtractor
+
+	// FixContentLength replaces an explicit Content-length header if it
+	// doesn't match the size of the message. A ContentLengthError is returned
+	// if this is false, or if the size of the message can't be determined up
+	// front and doesn't match the number of bytes sent.
+	FixContentLength bool
+
+	// StrictPing makes Ping() and PingInfo() return an error if the reply
+	// isn't "PONG", to detect endpoints that aren't spamd.
+	StrictPing bool
+
+	// StrictHeaders makes commands return an error if a header isn't one
+	// that spamd knows about, such as a misspelled "Usre". Unknown headers
+	// are sent as-is and a warning is logged if this is false.
+	StrictHeaders bool
+
+	// ParseMode controls if responses that can't be fully parsed are an
+	// error, or are returned with warnings.
+	ParseMode ParseMode
+
+	// TellDryRun makes Tell() validate the command and log the request that
+	// would be sent, without connecting to spamd. Use this to audit training
+	// pipelines before enabling --allow-tell.
+	TellDryRun bool
+
+	// Retry policy for commands that failed with a temporary error; commands
+	// aren't retried by default.
+	Retry RetryPolicy
+
+	// HedgeDelay enables hedged requests: if there's no response to a CHECK,
+	// SYMBOLS, REPORT, or REPORT_IFSPAM command after this delay, the command
+	// is sent again to another backend and the first response is used. This
+	// reduces the tail latency caused by a single slow backend or spamd
+	// child, at the cost of scanning some messages twice. The message is
+	// read in memory to send it twice.
+	//
+	// Note that spamd may autolearn from both commands. Other commands, such
+	// as TELL, are never hedged.
+	HedgeDelay time.Duration
+
+	// OnVersionSkew is called if the reply to a PING command has a different
+	// protocol version than the client's. The command fails if this is nil.
+	//
+	// The address is empty if the command was sent to the default address.
+	OnVersionSkew func(addr, version string)
+
+	// Debug records the raw request and response in the Wire field of
+	// responses, so that problems can be diagnosed from logs. Only the first
+	// DebugBodyLimit bytes of the response body are recorded; this defaults
+	// to 4K.
+	Debug          bool
+	DebugBodyLimit int
+
+	// Socket options for TCP connections to spamd.
+	Socket SocketOptions
+
+	// OnCommand is called after every command, for example to record
+	// metrics per backend, user, and command. The context is the one passed
+	// to the command, so Metadata can be read from it.
+	//
+	// For Process() and Headers() this is called once the Message is closed.
+	OnCommand func(ctx context.Context, info CommandInfo)
+
+	// OnVerdict is called with the verdict for every message that was
+	// scanned with CHECK, SYMBOLS, REPORT, REPORT_IFSPAM, PROCESS, or
+	// HEADERS; for example to alert on high scores with webhook.Notifier.
+	// It's called before the command returns, so it shouldn't block.
+	OnVerdict func(ctx context.Context, v Verdict)
+
+	// VerdictSink receives the same verdicts as OnVerdict; use MultiSink()
+	// to send them to several sinks. Errors are logged, and don't affect the
+	// command.
+	VerdictSink VerdictSink
+
+	// OnUnavailable is called if spamd is unavailable (see
+	// IsUnavailable()), so that a verdict can be returned instead of an
+	// error; for example FailOpen to accept all messages, or a local
+	// heuristic. The error is returned if this is nil.
+	//
+	// It's used by Scan(), Handler(), and the CHECK, SYMBOLS, REPORT, and
+	// REPORT_IFSPAM commands, which return a response with the verdict's
+	// score and symbols and without a Report or ResponseHeader. PROCESS,
+	// HEADERS, and other commands still return the error, as there is no
+	// response without spamd.
+	OnUnavailable FallbackFunc
+
+	// OnParseWarning is called for every part of a response that couldn't
+	// be parsed and was skipped, such as a malformed line in a report, so
+	// that changes in spamd's output are noticed. The warnings are also
+	// logged, and set in the Warnings field of the response.
+	OnParseWarning func(ctx context.Context, cmd, warning string)
+
+	// Logger for internal events such as failed connections; nothing is
+	// logged if this is nil.
+	Logger Logger
+
+	// TLSConfig enables TLS if it's not nil, for spamd running with --ssl.
+	// The ServerName is set from the address if it's empty.
+	TLSConfig *tls.Config
+
+	addr     string
+	dialer   Dialer
+	health   *health   // Shared with clones.
+	conns    *conns    // Shared with clones.
+	backends *backends // Shared with clones.
+	limiter  *limiter  // Shared with clones.
 }
 
 // Error is used for spamd responses; it contains the spamd exit code.
@@ -38,34 +206,105 @@ type Dialer interface {
 	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
 
+// Router maps a User to the address of the spamd backend which should handle
+// commands for that user; for example when Bayes databases are sharded over
+// several spamd instances.
+type Router interface {
+	// Route returns the address as "host:port", or an empty string to use
+	// the default address.
+	Route(user string) string
+}
+
+// RouterFunc is an adapter to allow the use of ordinary functions as a Router.
+type RouterFunc func(user string) string
+
+// Route calls f(user).
+func (f RouterFunc) Route(user string) string { return f(user) }
+
+// RouteMap is a Router with a fixed user to address mapping. Users who are not
+// in the map are sent to the default address.
+type RouteMap map[string]string
+
+// Route returns the address for user.
+func (m RouteMap) Route(user string) string { return m[user] }
+
+// UserExtractor returns the User to send for a message from the message's
+// headers, or an empty string if it can't be determined.
+type UserExtractor func(textproto.MIMEHeader) string
+
+// RecipientUser is a UserExtractor which uses the recipient address from the
+// Delivered-To or X-Original-To headers.
+func RecipientUser(h textproto.MIMEHeader) string {
+	for _, k := range []string{"Delivered-To", "X-Original-To"} {
+		v := strings.TrimSpace(h.Get(k))
+		if v == "" {
+			continue
+		}
+		if addr, err := mail.ParseAddress(v); err == nil {
+			return addr.Address
+		}
+		return v
+	}
+	return ""
+}
+
 // Header for requests and responses.
 type Header map[string]string
 
+// Headers for the TELL command.
+const (
+	HeaderMessageClass = "Message-class"
+	HeaderSet          = "Set"
+	HeaderRemove       = "Remove"
+)
+
+// Values for the Message-class header.
+const (
+	MessageClassSpam = "spam"
+	MessageClassHam  = "ham"
+)
+
+// Values for the Set and Remove headers.
+const (
+	TellLocal       = "local"
+	TellRemote      = "remote"
+	TellLocalRemote = TellLocal + "," + TellRemote
+)
+
 // Set a header. This will normalize the key casing, which is important because
 // SpamAssassin may ignore the header otherwise.
 //
 // The map is modified in-place, but is also returned for easier use:
 //
 //   fun(Header{}.Set("key", "value").Set("foo", "bar"))
+//
+// It panics if the value of a Message-class, Set, or Remove header is invalid.
 func (h Header) Set(k, v string) Header {
 	k = h.normalizeKey(k)
+	if err := checkHeader(k, v); err != nil {
+		panic(err.Error())
+	}
+	h[k] = v
+	return h
+}
 
+// checkHeader checks the value of the TELL headers; k must be normalized.
+func checkHeader(k, v string) error {
 	switch k {
-	case "Message-class":
+	case HeaderMessageClass:
 		v := strings.ToLower(v)
-		if v != "" && v != "spam" && v != "ham" {
-			panic(fmt.Sprintf("unknown value for %v header: %v", k, v))
+		if v != "" && v != MessageClassSpam && v != MessageClassHam {
+			return errors.Errorf("unknown value for %v header: %v", k, v)
 		}
-	case "Set", "Remove":
+	case HeaderSet, HeaderRemove:
 		v := strings.Split(strings.ToLower(v), ",")
 		for _, x := range v {
-			if x != "" && x != "local" && x != "remote" {
-				panic(fmt.Sprintf("unknown value for %v header: %v", k, x))
+			if x != "" && x != TellLocal && x != TellRemote {
+				return errors.Errorf("unknown value for %v header: %v", k, x)
 			}
 		}
 	}
-	h[k] = v
-	return h
+	return nil
 }
 
 // Get a header value; the second return value indicates if the map has this
@@ -112,26 +351,238 @@ func (h Header) normalizeKey(k string) string {
 //   New("127.0.0.1:783", &net.Dialer{Timeout: 20 * time.Second})
 //
 // If the passed dialer is nil then this will be used as a default.
-func New(addr string, d Dialer) *Client {
+//
+// If a hostname resolves to both IPv4 and IPv6 addresses a net.Dialer will try
+// both in parallel as described in RFC 6555 ("Happy Eyeballs"), so a broken
+// address family doesn't cause a timeout; see WithFallbackDelay().
+func New(addr string, d Dialer, opts ...Option) *Client {
 	if d == nil {
-		d = &net.Dialer{Timeout: 20 * time.Second}
+		d = &net.Dialer{Timeout: 20 * time.Second, FallbackDelay: defaultFallbackDelay}
 	}
-	return &Client{
-		addr:   addr,
-		dialer: d,
+	c := &Client{
+		addr:     addr,
+		dialer:   d,
+		health:   newHealth(),
+		conns:    newConns(),
+		backends: &backends{},
 	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Option sets an option on a Client; see New() and Clone().
+type Option func(*Client)
+
+// WithDefaultUser sets the DefaultUser.
+func WithDefaultUser(user string) Option {
+	return func(c *Client) { c.DefaultUser = user }
+}
+
+// WithDefaultHeaders sets DefaultHeaders to a copy of h. Invalid values for
+// the TELL headers don't panic as they do with Set(); commands return an error
+// instead.
+func WithDefaultHeaders(h Header) Option {
+	return func(c *Client) {
+		c.DefaultHeaders = make(Header, len(h))
+		for k, v := range h {
+			c.DefaultHeaders[c.DefaultHeaders.normalizeKey(k)] = v
+		}
+	}
+}
+
+// WithCompression sets Compress.
+func WithCompression(compress bool) Option {
+	return func(c *Client) { c.Compress = compress }
+}
+
+// WithThreshold sets the Threshold.
+func WithThreshold(score float64) Option {
+	return func(c *Client) { c.Threshold = score }
+}
+
+// WithTimeout sets the Timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.Timeout = d }
+}
+
+// WithIdleTimeout sets the IdleTimeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(c *Client) { c.IdleTimeout = d }
+}
+
+// WithRouter sets the Router.
+func WithRouter(r Router) Option {
+	return func(c *Client) { c.Router = r }
+}
+
+// WithPreprocessor sets the Preprocessor.
+func WithPreprocessor(p Preprocessor) Option {
+	return func(c *Client) { c.Preprocessor = p }
+}
+
+// WithUserFromMessage sets UserFromMessage.
+func WithUserFromMessage(f UserExtractor) Option {
+	return func(c *Client) { c.UserFromMessage = f }
+}
+
+// WithFixContentLength sets FixContentLength.
+func WithFixContentLength(fix bool) Option {
+	return func(c *Client) { c.FixContentLength = fix }
+}
+
+// WithStrictPing sets StrictPing.
+func WithStrictPing(strict bool) Option {
+	return func(c *Client) { c.StrictPing = strict }
+}
+
+// WithStrictHeaders sets StrictHeaders.
+func WithStrictHeaders(strict bool) Option {
+	return func(c *Client) { c.StrictHeaders = strict }
+}
+
+// WithTellDryRun sets TellDryRun.
+func WithTellDryRun(dryRun bool) Option {
+	return func(c *Client) { c.TellDryRun = dryRun }
+}
+
+// WithOnVersionSkew sets OnVersionSkew.
+func WithOnVersionSkew(f func(addr, version string)) Option {
+	return func(c *Client) { c.OnVersionSkew = f }
+}
+
+// WithDebug enables Debug, recording up to bodyLimit bytes of the response
+// body.
+func WithDebug(bodyLimit int) Option {
+	return func(c *Client) {
+		c.Debug = true
+		c.DebugBodyLimit = bodyLimit
+	}
+}
+
+// WithSocketOptions sets the Socket options.
+func WithSocketOptions(o SocketOptions) Option {
+	return func(c *Client) { c.Socket = o }
+}
+
+// WithTLS sets the TLSConfig.
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *Client) { c.TLSConfig = cfg }
+}
+
+// defaultFallbackDelay is the time to wait before trying the other address
+// family; this is the same as net.Dialer's default.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// WithFallbackDelay sets the time to wait for a connection with the primary
+// address family before a connection with the other address family is tried
+// in parallel. A negative value disables the fallback.
+//
+// This only works with a *net.Dialer; the dialer is copied, so a dialer passed
+// to New() isn't modified.
+func WithFallbackDelay(delay time.Duration) Option {
+	return func(c *Client) {
+		nd, ok := c.dialer.(*net.Dialer)
+		if !ok {
+			return
+		}
+		cp := *nd
+		cp.FallbackDelay = delay
+		c.dialer = &cp
+	}
+}
+
+// Clone returns a copy of the Client with opts applied; for example to use a
+// different DefaultUser for every tenant:
+//
+//   base := New("127.0.0.1:783", nil)
+//   tenant := base.Clone(WithDefaultUser("acct42"), WithTimeout(5*time.Second))
+//
+// The clone uses the same address and dialer as c, and shares the backend
+// health status. Cloning is cheap, and the original Client is not modified.
+func (c *Client) Clone(opts ...Option) *Client {
+	clone := *c
+	for _, o := range opts {
+		o(&clone)
+	}
+	return &clone
 }
 
 // Ping returns a confirmation that spamd is alive.
 func (c *Client) Ping(ctx context.Context) error {
-	read, err := c.send(ctx, cmdPing, strings.NewReader(""), nil)
+	_, err := c.PingInfo(ctx)
+	return err
+}
+
+// ResponsePing is the response from the PingInfo command.
+type ResponsePing struct {
+	// Latency is the round-trip time of the command, including connecting.
+	Latency time.Duration
+
+	// Version is the protocol version in spamd's reply.
+	Version string
+
+	// Text is the text in spamd's reply; this is "PONG" for spamd.
+	Text string
+}
+
+// PingInfo is like Ping(), but also returns the round-trip time and the
+// protocol version in spamd's reply.
+func (c *Client) PingInfo(ctx context.Context) (*ResponsePing, error) {
+	return c.ping(ctx, "")
+}
+
+// ping the spamd at addr, or the address selected by the Router if addr is
+// empty.
+func (c *Client) ping(ctx context.Context, addr string) (*ResponsePing, error) {
+	start := time.Now()
+	read, _, err := c.sendTo(ctx, addr, cmdPing, strings.NewReader(""), nil, false)
 	if err != nil {
-		return errors.Wrap(err, "error sending command to spamd")
+		return nil, errors.Wrap(err, "error sending command to spamd")
 	}
 	defer read.Close() // nolint: errcheck
 
+	var skew func(string)
+	if c.OnVersionSkew != nil {
+		skew = func(v string) { c.OnVersionSkew(addr, v) }
+	}
+
 	tp := textproto.NewReader(bufio.NewReader(read))
-	return parseCodeLine(tp, true)
+	version, text, err := readCodeLine(tp, true, skew)
+	if err != nil {
+		read.done.fail(err)
+		return nil, err
+	}
+	if c.StrictPing && text != "PONG" {
+		return nil, protocolErrorf("unexpected reply to PING: %q", text)
+	}
+
+	return &ResponsePing{
+		Latency: time.Since(start),
+		Version: version,
+		Text:    text,
+	}, nil
+}
+
+// gtube is the Generic Test for Unsolicited Bulk Email; all SpamAssassin
+// installations should flag messages containing this as spam.
+const gtube = "XJS*C4JDBQADN1.NSBN3*2IDNEN*GTUBE-STANDARD-ANTI-UBE-TEST-EMAIL*C.34X"
+
+// SelfTest checks a message with the GTUBE string, and returns an error if
+// spamd didn't flag it as spam.
+//
+// This is a more thorough check than Ping(), as it verifies that spamd can
+// actually check messages.
+func (c *Client) SelfTest(ctx context.Context) error {
+	r, err := c.Check(ctx, GTUBEMessage(), nil)
+	if err != nil {
+		return errors.Wrap(err, "self-test failed")
+	}
+	if !r.IsSpam {
+		return errors.Errorf("self-test failed: GTUBE not identified as spam (score %v)", r.Score)
+	}
+	return nil
 }
 
 // ResponseScore contains the Spam score of this email; used in various
@@ -140,11 +591,25 @@ type ResponseScore struct {
 	IsSpam    bool    // IsSpam reports if this message is considered spam.
 	Score     float64 // Score is the spam score of this message.
 	BaseScore float64 // BaseScore is the "minimum spam score" configured on the server.
+
+	// threshold is the Client's Threshold when the response was parsed.
+	threshold float64
 }
 
 // ResponseCheck is the response from the Check command.
 type ResponseCheck struct {
 	ResponseScore
+
+	// Warnings about parts of the response that couldn't be parsed and were
+	// skipped; see Client.OnParseWarning.
+	Warnings []string
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	// ResponseHeader is the header of spamd's response, such as the Spam
+	// header; see Raw().
+	ResponseHeader Header
 }
 
 // Check if the passed message is spam.
@@ -154,29 +619,67 @@ func (c *Client) Check(
 	hdr Header,
 ) (*ResponseCheck, error) {
 
-	read, err := c.send(ctx, cmdCheck, msg, hdr)
+	r, err := c.Exec(ctx, cmdCheck, msg, hdr)
 	if err != nil {
-		return nil, errors.Wrap(err, "error sending command to spamd")
+		return nil, err
 	}
-	defer read.Close() // nolint: errcheck
+	resp, ok := r.(*ResponseCheck)
+	if !ok {
+		return nil, parserTypeError(cmdCheck, r)
+	}
+	return resp, nil
+}
 
-	respHeaders, _, err := readResponse(read)
+// CheckUsers checks the message once for every user in users, as different
+// per-user preferences may give a different result. The commands are sent
+// concurrently.
+//
+// The returned map contains the response for every user for which the check
+// succeeded; the error is the first error that occurred, if any.
+func (c *Client) CheckUsers(
+	ctx context.Context,
+	msg io.Reader,
+	users []string,
+	hdr Header,
+) (map[string]*ResponseCheck, error) {
+
+	b, err := ioutil.ReadAll(msg)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not parse spamd response")
+		return nil, errors.Wrap(err, "could not read message")
 	}
 
-	isSpam, score, baseScore, err := parseSpamHeader(respHeaders)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not read Spam header")
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		results  = make(map[string]*ResponseCheck, len(users))
+	)
+	for _, user := range users {
+		h := make(Header, len(hdr)+1)
+		for k, v := range hdr {
+			h[k] = v
+		}
+		h.Set("User", user)
+
+		wg.Add(1)
+		go func(user string, h Header) {
+			defer wg.Done()
+			r, err := c.Check(ctx, bytes.NewReader(b), h)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "user %v", user)
+				}
+				return
+			}
+			results[user] = r
+		}(user, h)
 	}
+	wg.Wait()
 
-	return &ResponseCheck{
-		ResponseScore: ResponseScore{
-			IsSpam:    isSpam,
-			Score:     score,
-			BaseScore: baseScore,
-		},
-	}, nil
+	return results, firstErr
 }
 
 // ResponseSymbols is the response from the Symbols command.
@@ -184,7 +687,18 @@ type ResponseSymbols struct {
 	ResponseScore
 
 	// Symbols that matched.
-	Symbols []string
+	Symbols SymbolSet
+
+	// Warnings about parts of the response that couldn't be parsed and were
+	// skipped; see Client.OnParseWarning.
+	Warnings []string
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	// ResponseHeader is the header of spamd's response, such as the Spam
+	// header; see Raw().
+	ResponseHeader Header
 }
 
 // Symbols checks if the message is spam and returns the score and a list of all
@@ -195,46 +709,15 @@ func (c *Client) Symbols(
 	hdr Header,
 ) (*ResponseSymbols, error) {
 
-	// SPAMD/1.1 0 EX_OK
-	// Content-length: 50
-	// Spam: False ; 1.6 / 5.0
-	//
-	// INVALID_DATE,MISSING_HEADERS,NO_RECEIVED,NO_RELAYS
-	read, err := c.send(ctx, cmdSymbols, msg, hdr)
+	r, err := c.Exec(ctx, cmdSymbols, msg, hdr)
 	if err != nil {
-		return nil, errors.Wrap(err, "error sending command to spamd")
-	}
-	defer read.Close() // nolint: errcheck
-
-	respHeaders, tp, err := readResponse(read)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not parse spamd response")
-	}
-
-	isSpam, score, baseScore, err := parseSpamHeader(respHeaders)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not read Spam header")
+		return nil, err
 	}
-
-	body, err := readBody(tp)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not read body")
+	resp, ok := r.(*ResponseSymbols)
+	if !ok {
+		return nil, parserTypeError(cmdSymbols, r)
 	}
-
-	s := strings.Split(strings.TrimSpace(body), ",")
-	// Special case when symbols list is empty.
-	if len(s) == 1 && s[0] == "" {
-		s = *new([]string)
-	}
-
-	return &ResponseSymbols{
-		ResponseScore: ResponseScore{
-			IsSpam:    isSpam,
-			Score:     score,
-			BaseScore: baseScore,
-		},
-		Symbols: s,
-	}, nil
+	return resp, nil
 }
 
 // ResponseReport is the response from the Report and ReportIfSpam commands.
@@ -243,6 +726,17 @@ type ResponseReport struct {
 
 	// Report broken down in the found rules and their descriptions.
 	Report Report
+
+	// Warnings about parts of the response that couldn't be parsed and were
+	// skipped; see Client.OnParseWarning.
+	Warnings []string
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	// ResponseHeader is the header of spamd's response, such as the Spam
+	// header; see Raw().
+	ResponseHeader Header
 }
 
 // Report gives a detailed textual report for the message.
@@ -272,43 +766,90 @@ func (c *Client) report(
 	hdr Header,
 ) (*ResponseReport, error) {
 
-	read, err := c.send(ctx, cmd, msg, hdr)
+	r, err := c.Exec(ctx, cmd, msg, hdr)
 	if err != nil {
-		return nil, errors.Wrap(err, "error sending command to spamd")
+		return nil, err
 	}
-	defer read.Close() // nolint: errcheck
-
-	respHeaders, tp, err := readResponse(read)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not parse spamd response")
+	resp, ok := r.(*ResponseReport)
+	if !ok {
+		return nil, parserTypeError(cmd, r)
 	}
+	return resp, nil
+}
 
-	isSpam, score, baseScore, err := parseSpamHeader(respHeaders)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not read Spam header")
-	}
+// ResponseFull is the response from CheckFull.
+type ResponseFull struct {
+	ResponseScore
+
+	// Symbols that matched.
+	Symbols SymbolSet
+
+	// Report broken down in the found rules and their descriptions.
+	Report Report
+
+	// Warnings about parts of the response that couldn't be parsed and were
+	// skipped; see Client.OnParseWarning.
+	Warnings []string
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	// ResponseHeader is the header of spamd's response, such as the Spam
+	// header; see Raw().
+	ResponseHeader Header
+}
+
+// CheckFull checks if the message is spam and returns the score, the list of
+// symbols that were hit, and the report.
+//
+// This sends only a single REPORT command, rather than separate CHECK,
+// SYMBOLS, and REPORT commands.
+func (c *Client) CheckFull(
+	ctx context.Context,
+	msg io.Reader,
+	hdr Header,
+) (*ResponseFull, error) {
 
-	report, err := parseReport(tp)
+	r, err := c.report(ctx, cmdReport, msg, hdr)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not parse report")
+		return nil, err
 	}
+	return fullFromReport(r), nil
+}
 
-	return &ResponseReport{
-		ResponseScore: ResponseScore{
-			IsSpam:    isSpam,
-			Score:     score,
-			BaseScore: baseScore,
-		},
-		Report: report,
-	}, nil
+func fullFromReport(r *ResponseReport) *ResponseFull {
+	return &ResponseFull{
+		ResponseScore:  r.ResponseScore,
+		Symbols:        r.Report.Symbols(),
+		Report:         r.Report,
+		Warnings:       r.Warnings,
+		Wire:           r.Wire,
+		ResponseHeader: r.ResponseHeader,
+	}
 }
 
 // ResponseProcess is the response from the Process and Headers commands.
 type ResponseProcess struct {
 	ResponseScore
 
-	// Message headers and body.
+	// Autolearn is the autolearn result from the X-Spam-Status header.
+	Autolearn Autolearn
+
+	// Message headers and body. This must be closed; it's also closed once
+	// the context passed to Process() or Headers() is done, so the context
+	// shouldn't be cancelled before the Message is read.
 	Message io.ReadCloser
+
+	// Warnings about parts of the response that couldn't be parsed and were
+	// skipped; see Client.OnParseWarning.
+	Warnings []string
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	// ResponseHeader is the header of spamd's response, such as the Spam
+	// header; see Raw().
+	ResponseHeader Header
 }
 
 type rc struct {
@@ -324,6 +865,167 @@ func (r rc) Close() error {
 	return r.read.Close()
 }
 
+// messageReader is the Message of a Process() or Headers() response. If the
+// connection is closed before Content-length bytes were read, Read() and
+// Close() return a ContentLengthError, rather than a truncated message.
+//
+// The connection is closed once the context is done, so that it's not leaked
+// if the caller forgets to close the Message.
+type messageReader struct {
+	rc
+	n        int64 // Accessed atomically, as it's read by BytesRead().
+	length   int64 // -1 if there's no Content-length.
+	progress ProgressFunc
+	err      error
+
+	once     sync.Once
+	closed   int32 // Accessed atomically, as it's read by the finalizer.
+	closeErr error
+	stop     chan struct{}
+}
+
+func (c *Client) newMessageReader(
+	ctx context.Context,
+	read io.ReadCloser,
+	body io.Reader,
+	respHeaders Header,
+) *messageReader {
+
+	r := &messageReader{
+		rc:       rc{read: read, buff: bufio.NewReader(body)},
+		length:   -1,
+		progress: progressFromContext(ctx),
+	}
+	if l, ok := respHeaders.Get("Content-length"); ok {
+		if n, err := strconv.ParseInt(strings.TrimSpace(l), 10, 64); err == nil {
+			r.length = n
+		}
+	}
+
+	if done := ctx.Done(); done != nil {
+		r.stop = make(chan struct{})
+		go func(stop chan struct{}) {
+			select {
+			case <-done:
+				r.close() // nolint: errcheck
+			case <-stop:
+			}
+		}(r.stop)
+	}
+
+	// The goroutine above references the reader until the context is done,
+	// so the finalizer only runs after that, or if the context can never be
+	// done.
+	if c.Debug {
+		l := c.log()
+		runtime.SetFinalizer(r, func(r *messageReader) {
+			if atomic.LoadInt32(&r.closed) == 0 {
+				l.Warn("message from Process() or Headers() was not closed")
+				r.close() // nolint: errcheck
+			}
+		})
+	}
+	return r
+}
+
+func (r *messageReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	read := atomic.AddInt64(&r.n, int64(n))
+	if n > 0 && r.progress != nil {
+		r.progress(read, r.length)
+	}
+	if err == io.EOF && read < r.length {
+		r.err = errors.Wrap(&ContentLengthError{Header: r.length, Actual: read},
+			"response truncated")
+		err = r.err
+	}
+	return n, err
+}
+
+func (r *messageReader) Close() error {
+	err := r.close()
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+func (r *messageReader) close() error {
+	r.once.Do(func() {
+		atomic.StoreInt32(&r.closed, 1)
+		if r.stop != nil {
+			close(r.stop)
+		}
+		r.closeErr = r.rc.Close()
+	})
+	return r.closeErr
+}
+
+// SplitMessage is a message from Process() split in the header and body.
+type SplitMessage struct {
+	// Header is the parsed header.
+	Header textproto.MIMEHeader
+
+	// RawHeader is the header as returned by spamd, including the blank line
+	// that ends it. Use this to preserve the order of headers when rewriting
+	// them.
+	RawHeader []byte
+
+	// Body is the rest of the message; it's not read yet, so large messages
+	// can be streamed. Closing it closes the Message.
+	Body io.ReadCloser
+}
+
+// Split reads and parses the header of the Message, leaving the body to be
+// streamed:
+//
+//   r, err := c.Process(ctx, msg, nil)
+//   if err != nil {
+//       return err
+//   }
+//   m, err := r.Split()
+//   if err != nil {
+//       return err
+//   }
+//   defer m.Body.Close()
+//
+// The Message shouldn't be read after calling this, but Body should be closed.
+// The Message is closed if the header couldn't be parsed.
+func (r *ResponseProcess) Split() (*SplitMessage, error) {
+	// The Message is read through a new buffer, rather than the buffer of
+	// the messageReader, so that truncation and progress are still tracked.
+	br := rc{read: r.Message, buff: bufio.NewReader(r.Message)}
+	m := &SplitMessage{Body: br}
+
+	start := 0
+	for {
+		line, err := br.buff.ReadSlice('\n')
+		m.RawHeader = append(m.RawHeader, line...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.Message.Close() // nolint: errcheck
+			return nil, err
+		}
+		if len(bytes.TrimRight(m.RawHeader[start:], "\r\n")) == 0 {
+			break
+		}
+		start = len(m.RawHeader)
+	}
+
+	var err error
+	m.Header, err = textproto.NewReader(bufio.NewReader(bytes.NewReader(m.RawHeader))).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		r.Message.Close() // nolint: errcheck
+		return nil, protocolErrorf("could not parse headers: %v", err)
+	}
+	return m, nil
+}
+
 // Process this message and return a modified message.
 //
 // Do not forget to close the Message reader!
@@ -333,28 +1035,31 @@ func (c *Client) Process(
 	hdr Header,
 ) (*ResponseProcess, error) {
 
-	read, err := c.send(ctx, cmdProcess, msg, hdr)
+	read, respHeaders, tp, err := c.do(ctx, &Request{Command: cmdProcess, Message: msg, Headers: hdr})
 	if err != nil {
-		return nil, errors.Wrap(err, "error sending command to spamd")
+		return nil, err
 	}
 
-	respHeaders, tp, err := readResponse(read)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not parse spamd response")
+	score, warnings, err := c.parseScore(respHeaders)
+	if err == nil {
+		err = c.parseWarnings(ctx, cmdProcess, warnings)
 	}
-
-	isSpam, score, baseScore, err := parseSpamHeader(respHeaders)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not read Spam header")
+		read.Close() // nolint: errcheck
+		return nil, err
 	}
 
+	if c.hasVerdictHooks() {
+		c.emitVerdict(ctx, newVerdict(ctx, cmdProcess, read.user, score, nil))
+	}
+	h, body := peekHeader(tp.R)
 	return &ResponseProcess{
-		ResponseScore: ResponseScore{
-			IsSpam:    isSpam,
-			Score:     score,
-			BaseScore: baseScore,
-		},
-		Message: rc{read: read, buff: tp.R},
+		ResponseScore:  score,
+		Autolearn:      parseAutolearn(h),
+		Message:        c.newMessageReader(ctx, read, body, respHeaders),
+		Warnings:       warnings,
+		Wire:           read.wire,
+		ResponseHeader: respHeaders,
 	}, nil
 }
 
@@ -368,28 +1073,97 @@ func (c *Client) Headers(
 	hdr Header,
 ) (*ResponseProcess, error) {
 
-	read, err := c.send(ctx, cmdHeaders, msg, hdr)
+	read, respHeaders, tp, err := c.do(ctx, &Request{Command: cmdHeaders, Message: msg, Headers: hdr})
 	if err != nil {
-		return nil, errors.Wrap(err, "error sending command to spamd")
+		return nil, err
+	}
+
+	score, warnings, err := c.parseScore(respHeaders)
+	if err == nil {
+		err = c.parseWarnings(ctx, cmdHeaders, warnings)
+	}
+	if err != nil {
+		read.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	if c.hasVerdictHooks() {
+		c.emitVerdict(ctx, newVerdict(ctx, cmdHeaders, read.user, score, nil))
 	}
+	h, body := peekHeader(tp.R)
+	return &ResponseProcess{
+		ResponseScore:  score,
+		Autolearn:      parseAutolearn(h),
+		Message:        c.newMessageReader(ctx, read, body, respHeaders),
+		Warnings:       warnings,
+		Wire:           read.wire,
+		ResponseHeader: respHeaders,
+	}, nil
+}
+
+// ResponseHeaders is the response of the HeadersMIME command.
+type ResponseHeaders struct {
+	ResponseScore
+
+	// Header is the parsed header block of the modified message.
+	Header textproto.MIMEHeader
+
+	// RawHeader is the header block as returned by spamd.
+	RawHeader []byte
+
+	// Autolearn is the autolearn result from the X-Spam-Status header.
+	Autolearn Autolearn
+
+	// Warnings about parts of the response that couldn't be parsed and were
+	// skipped; see Client.OnParseWarning.
+	Warnings []string
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	// ResponseHeader is the header of spamd's response, such as the Spam
+	// header; see Raw().
+	ResponseHeader Header
+}
+
+// HeadersMIME is the same as Headers() but reads and parses the modified
+// headers, so there is no reader to close:
+//
+//   r, err := c.HeadersMIME(ctx, msg, nil)
+//   if err != nil {
+//       return err
+//   }
+//   status := r.Header.Get("X-Spam-Status")
+func (c *Client) HeadersMIME(
+	ctx context.Context,
+	msg io.Reader,
+	hdr Header,
+) (*ResponseHeaders, error) {
 
-	respHeaders, tp, err := readResponse(read)
+	r, err := c.Headers(ctx, msg, hdr)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not parse spamd response")
+		return nil, err
 	}
+	defer r.Message.Close() // nolint: errcheck
 
-	isSpam, score, baseScore, err := parseSpamHeader(respHeaders)
+	raw, err := ioutil.ReadAll(r.Message)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not read Spam header")
+		return nil, err
 	}
 
-	return &ResponseProcess{
-		ResponseScore: ResponseScore{
-			IsSpam:    isSpam,
-			Score:     score,
-			BaseScore: baseScore,
-		},
-		Message: rc{read: read, buff: tp.R},
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw))).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, protocolErrorf("could not parse headers: %v", err)
+	}
+
+	return &ResponseHeaders{
+		ResponseScore:  r.ResponseScore,
+		Header:         h,
+		RawHeader:      raw,
+		Autolearn:      r.Autolearn,
+		Warnings:       r.Warnings,
+		Wire:           r.Wire,
+		ResponseHeader: r.ResponseHeader,
 	}, nil
 }
 
@@ -397,6 +1171,9 @@ func (c *Client) Headers(
 type ResponseTell struct {
 	DidSet    []string
 	DidRemove []string
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
 }
 
 // Tell what type of we are to process and what should be done with that
@@ -411,42 +1188,60 @@ type ResponseTell struct {
 // To learn a message as spam:
 //
 //     c.Tell(ctx, msg, Header{}.
-//         Set("Message-class", "spam").
-//         Set("Set", "local"))
+//         Set(HeaderMessageClass, MessageClassSpam).
+//         Set(HeaderSet, TellLocal))
 //
 // Or to learn a message as ham:
 //
 //     c.Tell(ctx, msg, Header{}.
-//         Set("Message-class", "ham").
-//         Set("Set", "local"))
+//         Set(HeaderMessageClass, MessageClassHam).
+//         Set(HeaderSet, TellLocal))
+//
+// If TellDryRun is set the command is only validated and logged; the returned
+// response has the request in Wire.
 func (c *Client) Tell(
 	ctx context.Context,
 	msg io.Reader,
 	hdr Header,
 ) (*ResponseTell, error) {
 
-	read, err := c.send(ctx, cmdTell, msg, hdr)
-	defer read.Close() // nolint: errcheck
+	if c.TellDryRun {
+		return c.tellDryRun(msg, hdr)
+	}
+
+	r, err := c.Exec(ctx, cmdTell, msg, hdr)
 	if err != nil {
-		if serr, ok := err.(Error); ok && serr.Code == 69 {
-			return nil, errors.New(
+		if serr, ok := errors.Cause(err).(Error); ok && serr.Code == ExUnavailable {
+			return nil, errors.Wrap(err,
 				"TELL commands are not enabled, set the --allow-tell switch")
 		}
 		return nil, err
 	}
-
-	respHeaders, _, err := readResponse(read)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not parse spamd response")
+	resp, ok := r.(*ResponseTell)
+	if !ok {
+		return nil, parserTypeError(cmdTell, r)
 	}
+	return resp, nil
+}
 
-	r := &ResponseTell{}
-	if h, ok := respHeaders.Get("DidSet"); ok {
-		r.DidSet = strings.Split(h, ",")
+// tellDryRun validates and logs a TELL command without sending it.
+func (c *Client) tellDryRun(msg io.Reader, hdr Header) (*ResponseTell, error) {
+	if _, ok := hdr.Get(HeaderMessageClass); !ok {
+		return nil, errors.New("TELL requires the Message-class header")
 	}
-	if h, ok := respHeaders.Get("DidRemove"); ok {
-		r.DidRemove = strings.Split(h, ",")
+	_, set := hdr.Get(HeaderSet)
+	_, remove := hdr.Get(HeaderRemove)
+	if !set && !remove {
+		return nil, errors.New("TELL requires the Set or Remove header")
+	}
+
+	_, headers, err := c.prepare(msg, hdr)
+	if err != nil {
+		return nil, err
 	}
 
-	return r, nil
+	buf := new(bytes.Buffer)
+	writeRequestHeader(buf, cmdTell, headers)
+	c.log().Info("TELL dry run", "addr", c.route(headers), "request", buf.String())
+	return &ResponseTell{Wire: &Wire{Request: buf.Bytes()}}, nil
 }
@@ -3,12 +3,17 @@ package spamc
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
+	"net/textproto"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/teamwork/test"
 	"github.com/teamwork/test/fakeconn"
 )
@@ -31,6 +36,81 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestPingInfo(t *testing.T) {
+	out, err := newClient("SPAMD/1.5 0 PONG\r\n").PingInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Version != "1.5" {
+		t.Errorf("wrong version: %v", out.Version)
+	}
+	if out.Latency <= 0 {
+		t.Errorf("no latency: %v", out.Latency)
+	}
+
+	_, err = newClient("SPAMD/1.5 76 error\r\n").PingInfo(context.Background())
+	if !test.ErrorContains(err, "spamd returned code 76") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestPingStrict(t *testing.T) {
+	c := newClient("SPAMD/1.5 0 PONG\r\n")
+	c.StrictPing = true
+	if out, err := c.PingInfo(context.Background()); err != nil || out.Text != "PONG" {
+		t.Errorf("out: %#v; err: %v", out, err)
+	}
+
+	c = newClient("SPAMD/1.5 0 HELLO\r\n")
+	c.StrictPing = true
+	if err := c.Ping(context.Background()); !IsProtocolError(err) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestPingVersionSkew(t *testing.T) {
+	if err := newClient("SPAMD/1.3 0 PONG\r\n").Ping(context.Background()); !test.ErrorContains(err, "unexpected version") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	var skew []string
+	c := newClient("SPAMD/1.3 0 PONG\r\n").Clone(WithOnVersionSkew(func(addr, v string) {
+		skew = append(skew, v)
+	}))
+	out, err := c.PingInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Version != "1.3" || !reflect.DeepEqual(skew, []string{"1.3"}) {
+		t.Errorf("out: %#v; skew: %v", out, skew)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	cases := []struct {
+		in, wantErr string
+	}{
+		{"SPAMD/1.1 0 EX_OK\r\nSpam: yes; 1000.0 / 5.0\r\n\r\n", ""},
+		{"SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\n", "GTUBE not identified as spam"},
+		{"SPAMD/1.1 76 Bad header line\r\n\r\n", "self-test failed"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			c := newClient(tc.in)
+			err := c.SelfTest(context.Background())
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Errorf("wrong error\nout:  %#v\nwant: %#v\n", err, tc.wantErr)
+			}
+
+			sent := c.dialer.(*testDialer).conn.Written.String()
+			if !strings.HasPrefix(sent, "CHECK SPAMC/1.5\r\n") || !strings.Contains(sent, gtube) {
+				t.Errorf("wrong data sent: %#v", sent)
+			}
+		})
+	}
+}
+
 func TestCheck(t *testing.T) {
 	cases := []struct {
 		in      string
@@ -45,6 +125,7 @@ func TestCheck(t *testing.T) {
 					Score:     6.42,
 					BaseScore: 5,
 				},
+				ResponseHeader: Header{"Spam": "yes; 6.42 / 5.0"},
 			},
 			"",
 		},
@@ -56,6 +137,7 @@ func TestCheck(t *testing.T) {
 					Score:     -2.0,
 					BaseScore: 5,
 				},
+				ResponseHeader: Header{"Spam": "no; -2.0 / 5.0"},
 			},
 			"",
 		},
@@ -76,6 +158,51 @@ func TestCheck(t *testing.T) {
 	}
 }
 
+func TestCheckThreshold(t *testing.T) {
+	cases := []struct {
+		in        string
+		threshold float64
+		want      bool
+	}{
+		{"SPAMD/1.1 0 EX_OK\r\nSpam: no; 4.0 / 5.0\r\n\r\n", 0, false},
+		{"SPAMD/1.1 0 EX_OK\r\nSpam: no; 4.0 / 5.0\r\n\r\n", 3.5, true},
+		{"SPAMD/1.1 0 EX_OK\r\nSpam: no; 4.0 / 5.0\r\n\r\n", 4, true},
+		{"SPAMD/1.1 0 EX_OK\r\nSpam: yes; 6.0 / 5.0\r\n\r\n", 8, false},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			c := newClient(tc.in)
+			c.Threshold = tc.threshold
+			out, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.IsSpam != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out.IsSpam, tc.want)
+			}
+			if out.BaseScore != 5 {
+				t.Errorf("BaseScore changed: %v", out.BaseScore)
+			}
+		})
+	}
+}
+
+func TestCheckSectionReader(t *testing.T) {
+	spool := strings.NewReader("First message\nSecond message\nThird message\n")
+	c := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: no; 1.0 / 5.0\r\n\r\n")
+
+	_, err := c.Check(context.Background(), io.NewSectionReader(spool, 14, 15), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "CHECK SPAMC/1.5\r\nContent-length: 15\r\n\r\nSecond message\n"
+	if out := c.dialer.(*testDialer).conn.Written.String(); out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
+
 func TestSymbols(t *testing.T) {
 	cases := []struct {
 		in      string
@@ -94,7 +221,8 @@ func TestSymbols(t *testing.T) {
 					Score:     1.6,
 					BaseScore: 5.0,
 				},
-				Symbols: []string{"INVALID_DATE", "MISSING_HEADERS", "NO_RECEIVED", "NO_RELAYS"},
+				ResponseHeader: Header{"Content-length": "50", "Spam": "False ; 1.6 / 5.0"},
+				Symbols:        []string{"INVALID_DATE", "MISSING_HEADERS", "NO_RECEIVED", "NO_RELAYS"},
 			},
 			"",
 		},
@@ -110,7 +238,8 @@ func TestSymbols(t *testing.T) {
 					Score:     1.6,
 					BaseScore: 5.0,
 				},
-				Symbols: *new([]string),
+				ResponseHeader: Header{"Content-length": "50", "Spam": "False ; 1.6 / 5.0"},
+				Symbols:        *new([]string),
 			},
 			"",
 		},
@@ -162,20 +291,16 @@ func TestReport(t *testing.T) {
 					Score:     1.6,
 					BaseScore: 5.0,
 				},
+				ResponseHeader: Header{"Content-length": "50", "Spam": "False ; 1.6 / 5.0"},
 				Report: Report{
 					Intro: normalizeSpace(`
 					Spam detection software, running on the system "d311d8df23f8",
 					has NOT identified this incoming email as spam.
 
-					Content preview:  the body [...]
-
 					Content analysis details:   (1.6 points, 5.0 required)
 				`),
-					Table: []struct {
-						Points      float64
-						Rule        string
-						Description string
-					}{
+					ContentPreview: "the body [...]",
+					Table: []ReportRow{
 						{
 							Points:      0.4,
 							Rule:        "INVALID_DATE",
@@ -206,6 +331,13 @@ func TestReport(t *testing.T) {
 			if !test.ErrorContains(err, tc.wantErr) {
 				t.Errorf("wrong error\nout:  %#v\nwant: %#v\n", err, tc.wantErr)
 			}
+			if out != nil {
+				wantRaw := tc.in[strings.Index(tc.in, "\r\n\r\n")+4:]
+				if string(out.Report.Raw) != wantRaw {
+					t.Errorf("wrong Raw\nout:  %q\nwant: %q\n", out.Report.Raw, wantRaw)
+				}
+				out.Report.Raw = nil
+			}
 			if !reflect.DeepEqual(out, tc.want) {
 				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
 			}
@@ -213,6 +345,156 @@ func TestReport(t *testing.T) {
 	}
 }
 
+func TestProcessTruncated(t *testing.T) {
+	out, err := newClient("SPAMD/1.1 0 EX_OK\r\n"+
+		"Content-length: 40\r\n"+
+		"Spam: False ; 1.6 / 5.0\r\n"+
+		"\r\n"+
+		"Subject: foo\r\n\r\nasd").
+		Process(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantErr := "response truncated: message is 19 bytes, but Content-length is 40 bytes"
+	_, err = ioutil.ReadAll(out.Message)
+	if !test.ErrorContains(err, wantErr) {
+		t.Errorf("wrong read error\nout:  %v\nwant: %v\n", err, wantErr)
+	}
+	err = out.Message.Close()
+	if !test.ErrorContains(err, wantErr) {
+		t.Errorf("wrong close error\nout:  %v\nwant: %v\n", err, wantErr)
+	}
+	if _, ok := errors.Cause(err).(*ContentLengthError); !ok {
+		t.Errorf("wrong error type: %T", errors.Cause(err))
+	}
+}
+
+type notifyConn struct {
+	fakeconn.Conn
+	closed chan struct{}
+}
+
+func (c notifyConn) Close() error {
+	close(c.closed) // Panics if it's closed twice.
+	return c.Conn.Close()
+}
+
+func TestProcessContextClose(t *testing.T) {
+	closed := make(chan struct{})
+	c := New("", dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn := fakeconn.New()
+		conn.ReadFrom.WriteString("SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.6 / 5.0\r\n\r\nSubject: foo\r\n")
+		return notifyConn{Conn: conn, closed: closed}, nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out, err := c.Process(ctx, strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+		t.Fatal("closed before the context was done")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("not closed after the context was done")
+	}
+	_ = out.Message.Close()
+}
+
+func TestProcessContextCancelRead(t *testing.T) {
+	infos := make(chan CommandInfo, 1)
+	c := New("", dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			buf := make([]byte, 1024)
+			req := ""
+			for !strings.HasSuffix(req, "A message") {
+				n, err := server.Read(buf)
+				if err != nil {
+					return
+				}
+				req += string(buf[:n])
+			}
+			// Send part of the message, and keep the connection open.
+			_, _ = server.Write([]byte("SPAMD/1.1 0 EX_OK\r\nContent-length: 100\r\n" +
+				"Spam: False ; 1.6 / 5.0\r\n\r\nSubject: foo\r\n\r\nThe body"))
+		}()
+		return client, nil
+	}), WithOnCommand(func(ctx context.Context, info CommandInfo) { infos <- info }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out, err := c.Process(ctx, strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(out.Message)
+		read <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Error("no error from reading a closed message")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read not done after the context was done")
+	}
+	select {
+	case <-infos:
+	case <-time.After(time.Second):
+		t.Fatal("OnCommand not called")
+	}
+	_ = out.Message.Close()
+}
+
+func TestCheckFull(t *testing.T) {
+	c := newClient(strings.Replace(normalizeSpace(`
+		SPAMD/1.1 0 EX_OK
+		Content-length: 50
+		Spam: True ; 6.6 / 5.0
+
+		Spam detection software, running on the system "d311d8df23f8",
+		has identified this incoming email as possible spam.
+
+		Content analysis details:   (6.6 points, 5.0 required)
+
+		 pts rule name              description
+		---- ---------------------- --------------------------------------------------
+		 5.4 BAYES_99               BODY: Bayes spam probability is 99 to 100%
+		 1.2 MISSING_HEADERS        Missing To: header
+	`), "\n", "\r\n", -1))
+
+	out, err := c.CheckFull(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantScore := ResponseScore{IsSpam: true, Score: 6.6, BaseScore: 5}
+	if out.ResponseScore != wantScore {
+		t.Errorf("score\nout:  %#v\nwant: %#v\n", out.ResponseScore, wantScore)
+	}
+	wantSymbols := SymbolSet{"BAYES_99", "MISSING_HEADERS"}
+	if !reflect.DeepEqual(out.Symbols, wantSymbols) {
+		t.Errorf("symbols\nout:  %#v\nwant: %#v\n", out.Symbols, wantSymbols)
+	}
+	if len(out.Report.Table) != 2 || !strings.HasPrefix(out.Report.Intro, "Spam detection software") {
+		t.Errorf("report: %#v", out.Report)
+	}
+}
+
 func TestProcess(t *testing.T) {
 	cases := []struct {
 		in      string
@@ -223,7 +505,7 @@ func TestProcess(t *testing.T) {
 		{
 			strings.Replace(normalizeSpace(`
 				SPAMD/1.1 0 EX_OK
-				Content-length: 50
+				Content-length: 32
 				Spam: False ; 1.6 / 5.0
 
 				Subject: foo
@@ -237,6 +519,7 @@ func TestProcess(t *testing.T) {
 					Score:     1.6,
 					BaseScore: 5.0,
 				},
+				ResponseHeader: Header{"Content-length": "32", "Spam": "False ; 1.6 / 5.0"},
 			},
 			"Subject: foo\r\nX-Spam: yes\r\n\r\nasd",
 			"",
@@ -282,7 +565,7 @@ func TestHeaders(t *testing.T) {
 		{
 			strings.Replace(normalizeSpace(`
 				SPAMD/1.1 0 EX_OK
-				Content-length: 50
+				Content-length: 25
 				Spam: False ; 1.6 / 5.0
 
 				Subject: foo
@@ -294,10 +577,32 @@ func TestHeaders(t *testing.T) {
 					Score:     1.6,
 					BaseScore: 5.0,
 				},
+				ResponseHeader: Header{"Content-length": "25", "Spam": "False ; 1.6 / 5.0"},
 			},
 			"Subject: foo\r\nX-Spam: yes",
 			"",
 		},
+		{
+			"SPAMD/1.1 0 EX_OK\r\n" +
+				"Spam: True ; 16.6 / 5.0\r\n" +
+				"\r\n" +
+				"Subject: foo\r\n" +
+				"X-Spam-Status: Yes, score=16.6 required=5.0 tests=A,B\r\n" +
+				"\tautolearn=spam version=3.4.2\r\n" +
+				"\r\n",
+			&ResponseProcess{
+				ResponseScore: ResponseScore{
+					IsSpam:    true,
+					Score:     16.6,
+					BaseScore: 5.0,
+				},
+				ResponseHeader: Header{"Spam": "True ; 16.6 / 5.0"},
+				Autolearn:      AutolearnSpam,
+			},
+			"Subject: foo\r\nX-Spam-Status: Yes, score=16.6 required=5.0 tests=A,B\r\n" +
+				"\tautolearn=spam version=3.4.2\r\n\r\n",
+			"",
+		},
 	}
 
 	for i, tc := range cases {
@@ -329,6 +634,136 @@ func TestHeaders(t *testing.T) {
 	}
 }
 
+func TestProcessSplit(t *testing.T) {
+	cases := []struct {
+		in            string
+		wantHeader    textproto.MIMEHeader
+		wantRawHeader string
+		wantBody      string
+		wantErr       string
+	}{
+		{
+			"Subject: foo\r\nX-Spam: yes\r\n\r\nBody\r\n\r\nMore",
+			textproto.MIMEHeader{"Subject": {"foo"}, "X-Spam": {"yes"}},
+			"Subject: foo\r\nX-Spam: yes\r\n\r\n",
+			"Body\r\n\r\nMore",
+			"",
+		},
+		{
+			"Subject: foo\nX-Long: " + strings.Repeat("x", 5000) + "\n\nBody",
+			textproto.MIMEHeader{"Subject": {"foo"}, "X-Long": {strings.Repeat("x", 5000)}},
+			"Subject: foo\nX-Long: " + strings.Repeat("x", 5000) + "\n\n",
+			"Body",
+			"",
+		},
+		{
+			"Subject: foo",
+			textproto.MIMEHeader{"Subject": {"foo"}},
+			"Subject: foo",
+			"",
+			"",
+		},
+		{"not a header\r\n\r\nBody", nil, "", "", "could not parse headers"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			r, err := newClient(fmt.Sprintf(
+				"SPAMD/1.1 0 EX_OK\r\nContent-length: %d\r\nSpam: False ; 1.6 / 5.0\r\n\r\n%s",
+				len(tc.in), tc.in)).
+				Process(context.Background(), strings.NewReader("A message"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := r.Split()
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %#v\nwant: %#v\n", err, tc.wantErr)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+			defer m.Body.Close() // nolint: errcheck
+
+			if !reflect.DeepEqual(m.Header, tc.wantHeader) {
+				t.Errorf("header wrong\nout:  %#v\nwant: %#v\n", m.Header, tc.wantHeader)
+			}
+			if string(m.RawHeader) != tc.wantRawHeader {
+				t.Errorf("raw header wrong\nout:  %#v\nwant: %#v\n", string(m.RawHeader), tc.wantRawHeader)
+			}
+			body, err := ioutil.ReadAll(m.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tc.wantBody {
+				t.Errorf("body wrong\nout:  %#v\nwant: %#v\n", string(body), tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestHeadersMIME(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    *ResponseHeaders
+		wantErr string
+	}{
+		{
+			"SPAMD/1.1 0 EX_OK\r\n" +
+				"Content-length: 47\r\n" +
+				"Spam: True ; 6.6 / 5.0\r\n" +
+				"\r\n" +
+				"Subject: foo\r\n" +
+				"X-Spam-Status: Yes, score=6.6\r\n" +
+				"\r\n",
+			&ResponseHeaders{
+				ResponseScore:  ResponseScore{IsSpam: true, Score: 6.6, BaseScore: 5.0},
+				ResponseHeader: Header{"Content-length": "47", "Spam": "True ; 6.6 / 5.0"},
+				Header: textproto.MIMEHeader{
+					"Subject":       {"foo"},
+					"X-Spam-Status": {"Yes, score=6.6"},
+				},
+				RawHeader: []byte("Subject: foo\r\nX-Spam-Status: Yes, score=6.6\r\n\r\n"),
+			},
+			"",
+		},
+		{
+			"SPAMD/1.1 0 EX_OK\r\n" +
+				"Spam: False ; 1.6 / 5.0\r\n" +
+				"\r\n" +
+				"Subject: foo",
+			&ResponseHeaders{
+				ResponseScore:  ResponseScore{IsSpam: false, Score: 1.6, BaseScore: 5.0},
+				ResponseHeader: Header{"Spam": "False ; 1.6 / 5.0"},
+				Header:         textproto.MIMEHeader{"Subject": {"foo"}},
+				RawHeader:      []byte("Subject: foo"),
+			},
+			"",
+		},
+		{
+			"SPAMD/1.1 0 EX_OK\r\n" +
+				"Spam: False ; 1.6 / 5.0\r\n" +
+				"\r\n" +
+				"not a header\r\n",
+			nil,
+			"could not parse headers",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out, err := newClient(tc.in).
+				HeadersMIME(context.Background(), strings.NewReader("A message"), nil)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %#v\nwant: %#v\n", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
 func TestTell(t *testing.T) {
 	cases := []struct {
 		in      string
@@ -363,19 +798,190 @@ func TestTell(t *testing.T) {
 }
 
 type testDialer struct {
-	conn fakeconn.Conn
+	conn  fakeconn.Conn
+	addrs []string
 }
 
 func (d *testDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.addrs = append(d.addrs, address)
 	return d.conn, nil
 }
 
+// replyDialer creates a new connection for every dial, which replies with the
+// output of reply() for the request that was written to it.
+type replyDialer struct {
+	reply func(req string) string
+}
+
+func (d replyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return &replyConn{Conn: fakeconn.New(), reply: d.reply}, nil
+}
+
+type replyConn struct {
+	fakeconn.Conn
+	reply   func(req string) string
+	replied bool
+}
+
+func (c *replyConn) Read(b []byte) (int, error) {
+	if !c.replied {
+		c.replied = true
+		c.ReadFrom.WriteString(c.reply(c.Written.String()))
+	}
+	return c.Conn.Read(b)
+}
+
+// dialerFunc is an adapter to use a function as a Dialer.
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
 func newClient(resp string) *Client {
 	d := &testDialer{conn: fakeconn.New()}
 	d.conn.ReadFrom.WriteString(resp)
 	return New("", d)
 }
 
+func TestRouter(t *testing.T) {
+	cases := []struct {
+		router      Router
+		defaultUser string
+		hdr         Header
+		want        string
+	}{
+		{nil, "", Header{}.Set("User", "a"), "default:783"},
+		{RouteMap{"a": "a:783"}, "", Header{}.Set("User", "a"), "a:783"},
+		{RouteMap{"a": "a:783"}, "", Header{}.Set("User", "b"), "default:783"},
+		{RouteMap{"a": "a:783"}, "", nil, "default:783"},
+		{RouteMap{"a": "a:783"}, "a", nil, "a:783"},
+		{RouteMap{"a": "a:783"}, "a", Header{}.Set("User", "b"), "default:783"},
+		{RouterFunc(func(u string) string { return u + ":783" }), "", Header{}.Set("User", "x"), "x:783"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			d := &testDialer{conn: fakeconn.New()}
+			d.conn.ReadFrom.WriteString("SPAMD/1.1 0 EX_OK\r\nSpam: no; 1.0 / 5.0\r\n\r\n")
+			c := New("default:783", d)
+			c.Router = tc.router
+			c.DefaultUser = tc.defaultUser
+
+			_, err := c.Check(context.Background(), strings.NewReader("A message"), tc.hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d.addrs) != 1 || d.addrs[0] != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", d.addrs, tc.want)
+			}
+		})
+	}
+}
+
+func TestUserFromMessage(t *testing.T) {
+	cases := []struct {
+		inMsg, inUser, defaultUser string
+		want                       string
+	}{
+		{"Delivered-To: a@example.com\r\n\r\nBody", "", "", "User: a@example.com\r\n"},
+		{"X-Original-To: <b@example.com>\r\n\r\nBody", "", "", "User: b@example.com\r\n"},
+		{"Delivered-To: a@example.com\r\n\r\nBody", "x", "", "User: x\r\n"},
+		{"Subject: Hello\r\n\r\nBody", "", "default", "User: default\r\n"},
+		{"Not a header", "", "default", "User: default\r\n"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			d := &testDialer{conn: fakeconn.New()}
+			d.conn.ReadFrom.WriteString("SPAMD/1.1 0 EX_OK\r\nSpam: no; 1.0 / 5.0\r\n\r\n")
+			c := New("", d)
+			c.UserFromMessage = RecipientUser
+			c.DefaultUser = tc.defaultUser
+
+			var hdr Header
+			if tc.inUser != "" {
+				hdr = Header{}.Set("User", tc.inUser)
+			}
+			_, err := c.Check(context.Background(), strings.NewReader(tc.inMsg), hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := d.conn.Written.String()
+			if !strings.Contains(out, tc.want) {
+				t.Errorf("User header missing\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+			if !strings.HasSuffix(out, "\r\n\r\n"+tc.inMsg) {
+				t.Errorf("message not sent in full\nout:  %#v\n", out)
+			}
+		})
+	}
+}
+
+func TestCheckUsers(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		switch {
+		case strings.Contains(req, "User: a\r\n"):
+			return "SPAMD/1.1 0 EX_OK\r\nSpam: yes; 6.0 / 5.0\r\n\r\n"
+		case strings.Contains(req, "User: b\r\n"):
+			return "SPAMD/1.1 0 EX_OK\r\nSpam: no; 1.0 / 5.0\r\n\r\n"
+		default:
+			return "SPAMD/1.1 67 EX_NOUSER\r\n\r\n"
+		}
+	}})
+
+	t.Run("ok", func(t *testing.T) {
+		out, err := c.CheckUsers(context.Background(), strings.NewReader("A message"),
+			[]string{"a", "b"}, Header{}.Set("X", "y"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]*ResponseCheck{
+			"a": {
+				ResponseScore:  ResponseScore{IsSpam: true, Score: 6, BaseScore: 5},
+				ResponseHeader: Header{"Spam": "yes; 6.0 / 5.0"},
+			},
+			"b": {
+				ResponseScore:  ResponseScore{IsSpam: false, Score: 1, BaseScore: 5},
+				ResponseHeader: Header{"Spam": "no; 1.0 / 5.0"},
+			},
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		out, err := c.CheckUsers(context.Background(), strings.NewReader("A message"),
+			[]string{"a", "unknown"}, nil)
+		if !test.ErrorContains(err, "user unknown") {
+			t.Errorf("wrong error: %v", err)
+		}
+		if len(out) != 1 || out["a"] == nil {
+			t.Errorf("wrong results: %#v", out)
+		}
+	})
+}
+
+func TestClone(t *testing.T) {
+	base := New("127.0.0.1:783", nil, WithDefaultUser("base"))
+	clone := base.Clone(WithDefaultUser("acct42"), WithTimeout(5*time.Second))
+
+	if base.DefaultUser != "base" || base.Timeout != 0 {
+		t.Errorf("base modified: %#v", base)
+	}
+	if clone.DefaultUser != "acct42" || clone.Timeout != 5*time.Second {
+		t.Errorf("options not applied: %#v", clone)
+	}
+	if clone.addr != base.addr || clone.dialer != base.dialer {
+		t.Errorf("address or dialer not shared: %#v", clone)
+	}
+	if clone.timeout() != 5*time.Second || base.timeout() != 20*time.Second {
+		t.Errorf("wrong timeouts: %v, %v", clone.timeout(), base.timeout())
+	}
+}
+
 func TestHeader(t *testing.T) {
 	t.Run("set", func(t *testing.T) {
 		h := Header{}.Set("xxx", "asD").Set("awe-CV", "zxc")
@@ -396,6 +1002,8 @@ func TestHeader(t *testing.T) {
 		Header{}.Set("set", "local")
 		Header{}.Set("set", "local,remote")
 		Header{}.Set("set", "")
+		Header{}.Set(HeaderRemove, TellLocalRemote)
+		Header{}.Set(HeaderMessageClass, strings.ToUpper(MessageClassSpam))
 	})
 
 	t.Run("panic", func(t *testing.T) {
@@ -421,3 +1029,228 @@ func TestHeader(t *testing.T) {
 		}()
 	})
 }
+
+type deadlineConn struct {
+	fakeconn.Conn
+	deadlines []time.Time
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+	return nil
+}
+
+func TestIdleTimeout(t *testing.T) {
+	conn := &deadlineConn{Conn: fakeconn.New()}
+	conn.ReadFrom.WriteString("SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\n")
+	c := New("", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+		return conn, nil
+	}), WithTimeout(time.Hour), WithIdleTimeout(time.Minute))
+
+	_, err := c.Check(context.Background(), strings.NewReader("Subject: x\r\n\r\nhello"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// At least one write and one read.
+	if len(conn.deadlines) < 2 {
+		t.Fatalf("deadline not refreshed: %v", conn.deadlines)
+	}
+	for _, d := range conn.deadlines {
+		if time.Until(d) > 2*time.Minute {
+			t.Errorf("absolute deadline used: %v", d)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		if strings.Contains(req, "User: spam\r\n") {
+			return "SPAMD/1.1 0 EX_OK\r\nSpam: yes; 6.0 / 5.0\r\n\r\n"
+		}
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: no; 1.0 / 5.0\r\n\r\n"
+	}}, WithDefaultHeaders(Header{}.Set("X", "y")))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := "ham"
+			if i%2 == 0 {
+				user = "spam"
+			}
+			out, err := c.Check(context.Background(), strings.NewReader("A message"),
+				Header{}.Set("User", user))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if out.IsSpam != (user == "spam") {
+				errs <- fmt.Errorf("wrong result for %v: %#v", user, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+type closeConn struct {
+	fakeconn.Conn
+	writeErr error
+	closed   bool
+}
+
+func (c *closeConn) Write(b []byte) (int, error) {
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *closeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestCloseOnError(t *testing.T) {
+	commands := map[string]func(*Client) error{
+		"check": func(c *Client) error {
+			_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+			return err
+		},
+		"symbols": func(c *Client) error {
+			_, err := c.Symbols(context.Background(), strings.NewReader("A message"), nil)
+			return err
+		},
+		"report": func(c *Client) error {
+			_, err := c.Report(context.Background(), strings.NewReader("A message"), nil)
+			return err
+		},
+		"process": func(c *Client) error {
+			_, err := c.Process(context.Background(), strings.NewReader("A message"), nil)
+			return err
+		},
+		"headers": func(c *Client) error {
+			_, err := c.Headers(context.Background(), strings.NewReader("A message"), nil)
+			return err
+		},
+		"tell": func(c *Client) error {
+			_, err := c.Tell(context.Background(), strings.NewReader("A message"), nil)
+			return err
+		},
+	}
+
+	stages := []struct {
+		name     string
+		writeErr error
+		resp     string
+		check    func(error) bool
+	}{
+		{"write", errors.New("broken pipe"), "", IsConnectionError},
+		{"code", nil, "SPAMD/1.1 76 Bad header line\r\n\r\n", IsProtocolError},
+		{"malformed", nil, "HTTP/1.1 200 OK\r\n\r\n", IsProtocolError},
+		{"score", nil, "SPAMD/1.1 0 EX_OK\r\nSpam: maybe; 1 / 5\r\n\r\n", IsProtocolError},
+	}
+
+	for name, cmd := range commands {
+		for _, st := range stages {
+			if name == "tell" && st.name == "score" {
+				continue
+			}
+			t.Run(name+"/"+st.name, func(t *testing.T) {
+				conn := &closeConn{Conn: fakeconn.New(), writeErr: st.writeErr}
+				conn.ReadFrom.WriteString(st.resp)
+				c := New("", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+					return conn, nil
+				}))
+
+				err := cmd(c)
+				if !st.check(err) {
+					t.Errorf("wrong error: %#v", errors.Cause(err))
+				}
+				if !conn.closed {
+					t.Error("connection not closed")
+				}
+				if n := len(c.conns.active); n != 0 {
+					t.Errorf("%d connections still tracked", n)
+				}
+			})
+		}
+	}
+}
+
+func TestTellNotEnabled(t *testing.T) {
+	_, err := newClient("SPAMD/1.1 69 Service unavailable: TELL commands are not enabled\r\n\r\n").
+		Tell(context.Background(), strings.NewReader("A message"), nil)
+	if !test.ErrorContains(err, "--allow-tell") || ExitCode(err, false) != ExUnavailable {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestTellDryRun(t *testing.T) {
+	cases := []struct {
+		in      Header
+		want    string
+		wantErr string
+	}{
+		{
+			Header{}.Set(HeaderMessageClass, MessageClassSpam).Set(HeaderSet, TellLocal),
+			"TELL SPAMC/1.5\r\nContent-length: 9\r\nMessage-class: spam\r\nSet: local\r\nUser: bob\r\n\r\n",
+			"",
+		},
+		{Header{}.Set(HeaderSet, TellLocal), "", "requires the Message-class header"},
+		{Header{}.Set(HeaderMessageClass, MessageClassHam), "", "requires the Set or Remove header"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			l := &testLogger{}
+			c := New("spamd:783", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+				t.Fatal("connected to spamd")
+				return nil, nil
+			}), WithTellDryRun(true), WithDefaultUser("bob"), WithLogger(l))
+
+			out, err := c.Tell(context.Background(), strings.NewReader("A message"), tc.in)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+			if string(out.Wire.Request) != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", string(out.Wire.Request), tc.want)
+			}
+			want := []string{fmt.Sprintf("info: TELL dry run [addr spamd:783 request %v]", tc.want)}
+			if !reflect.DeepEqual(l.msgs, want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", l.msgs, want)
+			}
+		})
+	}
+}
+
+func TestFallbackDelay(t *testing.T) {
+	nd := &net.Dialer{}
+	c := New("spamd:783", nd, WithFallbackDelay(50*time.Millisecond))
+	if out := c.dialer.(*net.Dialer).FallbackDelay; out != 50*time.Millisecond {
+		t.Errorf("wrong FallbackDelay: %v", out)
+	}
+	if nd.FallbackDelay != 0 {
+		t.Errorf("dialer modified: %v", nd.FallbackDelay)
+	}
+
+	if out := New("spamd:783", nil).dialer.(*net.Dialer).FallbackDelay; out != defaultFallbackDelay {
+		t.Errorf("wrong default FallbackDelay: %v", out)
+	}
+
+	// Other dialers are left alone.
+	d := &testDialer{}
+	if New("spamd:783", d, WithFallbackDelay(time.Second)).dialer != d {
+		t.Error("dialer replaced")
+	}
+}
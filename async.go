@@ -0,0 +1,50 @@
+package spamc
+
+import (
+	"context"
+	"io"
+)
+
+// CheckFuture is the pending response of CheckAsync().
+type CheckFuture struct {
+	done chan struct{}
+	resp *ResponseCheck
+	err  error
+}
+
+// Done returns a channel that's closed once the command is finished.
+func (f *CheckFuture) Done() <-chan struct{} { return f.done }
+
+// Wait for the command to finish and return the response.
+func (f *CheckFuture) Wait() (*ResponseCheck, error) {
+	<-f.done
+	return f.resp, f.err
+}
+
+// CheckAsync is like Check(), but returns without waiting for the response.
+//
+// If a limit is set with WithConcurrencyLimit() the command is queued, and
+// ErrQueueFull is returned right away if the queue is full; callers can use
+// this to apply backpressure instead of blocking:
+//
+//   f, err := c.CheckAsync(ctx, msg, nil)
+//   if err == spamc.ErrQueueFull {
+//       return tempfail()
+//   }
+//   ...
+//   <-f.Done()
+//   r, err := f.Wait()
+func (c *Client) CheckAsync(ctx context.Context, msg io.Reader, hdr Header) (*CheckFuture, error) {
+	ctx, unreserve, err := c.reserveSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &CheckFuture{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		defer unreserve()
+		f.resp, f.err = c.Check(ctx, msg, hdr)
+	}()
+	return f, nil
+}
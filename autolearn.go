@@ -0,0 +1,37 @@
+package spamc
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// Autolearn is the result of SpamAssassin's Bayes autolearning, from the
+// autolearn= token in the X-Spam-Status header.
+type Autolearn string
+
+// Autolearn results; other values are returned as-is.
+const (
+	AutolearnUnknown     Autolearn = ""            // Not in the header.
+	AutolearnHam         Autolearn = "ham"         // Learned as ham.
+	AutolearnSpam        Autolearn = "spam"        // Learned as spam.
+	AutolearnNo          Autolearn = "no"          // Not learned.
+	AutolearnDisabled    Autolearn = "disabled"    // Autolearning is disabled.
+	AutolearnFailed      Autolearn = "failed"      // Learning failed.
+	AutolearnUnavailable Autolearn = "unavailable" // Bayes database unavailable.
+)
+
+// Learned reports if the message was learned as ham or spam.
+func (a Autolearn) Learned() bool { return a == AutolearnHam || a == AutolearnSpam }
+
+// parseAutolearn gets the autolearn result from the X-Spam-Status header.
+//
+//   X-Spam-Status: Yes, score=6.6 required=5.0 tests=FOO,BAR
+//           autolearn=no autolearn_force=no version=3.4.2
+func parseAutolearn(h textproto.MIMEHeader) Autolearn {
+	for _, f := range strings.Fields(h.Get("X-Spam-Status")) {
+		if strings.HasPrefix(f, "autolearn=") {
+			return Autolearn(strings.TrimPrefix(f, "autolearn="))
+		}
+	}
+	return AutolearnUnknown
+}
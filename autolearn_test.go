@@ -0,0 +1,34 @@
+package spamc
+
+import (
+	"fmt"
+	"net/textproto"
+	"testing"
+)
+
+func TestParseAutolearn(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Autolearn
+	}{
+		{"", AutolearnUnknown},
+		{"No, score=1.6 required=5.0 tests=NO_RELAYS", AutolearnUnknown},
+		{"No, score=1.6 required=5.0 tests=NO_RELAYS autolearn=no autolearn_force=no version=3.4.2", AutolearnNo},
+		{"Yes, score=16.6 required=5.0 tests=A,B autolearn=spam version=3.4.2", AutolearnSpam},
+		{"No, score=-3.0 required=5.0 tests=A\tautolearn=ham\tversion=3.4.2", AutolearnHam},
+		{"No, score=1 autolearn_force=no autolearn=unavailable", AutolearnUnavailable},
+		{"No, score=1 autolearn=xxx", Autolearn("xxx")},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := parseAutolearn(textproto.MIMEHeader{"X-Spam-Status": {tc.in}})
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+			if out.Learned() != (tc.want == AutolearnHam || tc.want == AutolearnSpam) {
+				t.Errorf("Learned() is %v", out.Learned())
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package spamc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBackendsFull is returned if the backend for a command has reached its
+// connection limit, and there is no other backend which hasn't; see
+// WithBackendLimits().
+var ErrBackendsFull = errors.New("spamc: all spamd backends are at their connection limit")
+
+// WithBackendLimits limits the number of commands that are in progress at the
+// same time on a single backend, in addition to the global limit set with
+// WithConcurrencyLimit(). This should match spamd's --max-children, so that
+// commands are sent to other backends rather than queued by a busy spamd
+// until it returns EX_TEMPFAIL.
+//
+// limits has the limits by address, and max is the limit for backends that
+// aren't in limits; 0 means no limit. Commands fail with ErrBackendsFull if
+// all backends are at their limit. PING commands aren't limited.
+func WithBackendLimits(max int, limits map[string]int) Option {
+	return func(c *Client) {
+		c.BackendLimit = max
+		c.BackendLimits = limits
+	}
+}
+
+// hasBackendLimits reports if any backend limits are set.
+func (c *Client) hasBackendLimits() bool {
+	return c.BackendLimit > 0 || len(c.BackendLimits) > 0
+}
+
+// backendLimit returns the limit for addr, or 0 if there is none.
+func (c *Client) backendLimit(addr string) int {
+	if l, ok := c.BackendLimits[addr]; ok {
+		return l
+	}
+	return c.BackendLimit
+}
+
+// SetBackends replaces the spamd backends that commands are sent to; commands
+// are distributed over the backends with the Balancer, or with round-robin if
+// there is no Balancer. The address passed to New() is used again if this is
+// called without any addresses.
+//
+// This can be called at any time, for example when the spamd fleet is scaled
+// up or down. Commands already sent to a removed backend will finish
+// normally, as every command uses its own connection.
+//
+// The Router takes precedence over the backends. The backends are shared
+// with clones.
+func (c *Client) SetBackends(addrs ...string) {
+	for _, a := range c.backends.set(addrs) {
+		c.health.forget(a)
+	}
+	c.log().Info("spamd backends changed", "backends", addrs)
+}
+
+// Backends returns the backends set with SetBackends().
+func (c *Client) Backends() []string {
+	return c.backends.list()
+}
+
+// Drain stops sending new commands to the backend at addr, and waits until the
+// commands in progress on it are finished or ctx is done. Use this to take a
+// spamd host out for maintenance without failing any commands:
+//
+//   ctx, cancel := context.WithTimeout(ctx, time.Minute)
+//   defer cancel()
+//   err := c.Drain(ctx, "spamd1:783")
+//
+// The backend stays drained until Undrain() is called, also if ctx is done.
+// Only backends set with SetBackends() are drained; commands for users which
+// are routed to addr by the Router are still sent to it. If all backends are
+// drained, commands are sent to the address passed to New().
+//
+// The drained backends are shared with clones.
+func (c *Client) Drain(ctx context.Context, addr string) error {
+	c.backends.setDrained(addr, true)
+	c.log().Info("draining spamd backend", "addr", addr)
+
+	t := time.NewTicker(25 * time.Millisecond)
+	defer t.Stop()
+	for c.conns.activeByAddr()[addr] > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	c.log().Info("spamd backend drained", "addr", addr)
+	return nil
+}
+
+// Undrain starts sending commands to a backend drained with Drain() again.
+func (c *Client) Undrain(addr string) {
+	c.backends.setDrained(addr, false)
+	c.log().Info("spamd backend no longer drained", "addr", addr)
+}
+
+// backends is a list of spamd backends.
+type backends struct {
+	mu      sync.RWMutex
+	addrs   []string
+	drained map[string]bool
+	next    uint32
+}
+
+func (b *backends) setDrained(addr string, drained bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !drained {
+		delete(b.drained, addr)
+		return
+	}
+	if b.drained == nil {
+		b.drained = make(map[string]bool)
+	}
+	b.drained[addr] = true
+}
+
+// isDrained reports if addr is drained.
+func (b *backends) isDrained(addr string) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.drained[addr]
+}
+
+// hasDrained reports if any backends are drained.
+func (b *backends) hasDrained() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.drained) > 0
+}
+
+// listAvailable returns a copy of the addresses that aren't drained.
+func (b *backends) listAvailable() []string {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	addrs := make([]string, 0, len(b.addrs))
+	for _, a := range b.addrs {
+		if !b.drained[a] {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// set the addresses, returning the addresses that were removed.
+func (b *backends) set(addrs []string) []string {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keep := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		keep[a] = struct{}{}
+	}
+	var removed []string
+	for _, a := range b.addrs {
+		if _, ok := keep[a]; !ok {
+			removed = append(removed, a)
+		}
+	}
+
+	b.addrs = append([]string(nil), addrs...)
+	return removed
+}
+
+// list returns a copy of the addresses.
+func (b *backends) list() []string {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]string(nil), b.addrs...)
+}
+
+// pick the next address, or an empty string if there are no addresses.
+func (b *backends) pick() string {
+	if b == nil {
+		return ""
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.addrs) == 0 {
+		return ""
+	}
+	return b.addrs[b.nextIndex(len(b.addrs))]
+}
+
+// nextIndex returns the next round-robin index for a list of n addresses.
+func (b *backends) nextIndex(n int) int {
+	return int((atomic.AddUint32(&b.next, 1) - 1) % uint32(n))
+}
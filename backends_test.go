@@ -0,0 +1,205 @@
+package spamc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/test/fakeconn"
+)
+
+func TestSetBackends(t *testing.T) {
+	d := &testDialer{conn: fakeconn.New()}
+	c := New("default:783", d)
+	ping := func(n int) {
+		for i := 0; i < n; i++ {
+			d.conn.ReadFrom.WriteString("SPAMD/1.5 0 PONG\r\n")
+			c.Ping(context.Background()) // nolint: errcheck
+		}
+	}
+
+	ping(1)
+	c.SetBackends("a:783", "b:783")
+	ping(4)
+	c.Clone().SetBackends("c:783")
+	ping(2)
+	c.SetBackends()
+	ping(1)
+
+	want := []string{"default:783", "a:783", "b:783", "a:783", "b:783", "c:783", "c:783", "default:783"}
+	if !reflect.DeepEqual(d.addrs, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", d.addrs, want)
+	}
+}
+
+func TestSetBackendsRouter(t *testing.T) {
+	d := &testDialer{conn: fakeconn.New()}
+	c := New("default:783", d, WithRouter(RouteMap{"a": "shard:783"}))
+	c.SetBackends("backend:783")
+
+	for _, u := range []string{"a", "b"} {
+		d.conn.ReadFrom.WriteString("SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\n")
+		_, err := c.Check(context.Background(), strings.NewReader("A message"),
+			Header{}.Set("User", u))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"shard:783", "backend:783"}
+	if !reflect.DeepEqual(d.addrs, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", d.addrs, want)
+	}
+}
+
+func TestSetBackendsHealth(t *testing.T) {
+	c := New("default:783", replyDialer{func(string) string { return "SPAMD/1.5 0 PONG\r\n" }})
+	c.SetBackends("a:783", "b:783")
+	if got := len(c.HealthCheck(context.Background())); got != 2 {
+		t.Errorf("wrong number of backends checked: %d", got)
+	}
+
+	c.SetBackends("b:783")
+	status := c.HealthCheck(context.Background())
+	if len(status) != 1 || status[0].Addr != "b:783" || !status[0].Reachable {
+		t.Errorf("wrong status: %#v", status)
+	}
+	if out := c.Backends(); !reflect.DeepEqual(out, []string{"b:783"}) {
+		t.Errorf("wrong backends: %#v", out)
+	}
+}
+
+func TestBackendLimits(t *testing.T) {
+	release := make(chan struct{})
+	c := blockingClient(release, WithBackendLimits(1, map[string]int{"b:783": 2}))
+	c.SetBackends("a:783", "b:783")
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+			errs <- err
+		}()
+	}
+	for i := 0; ; i++ {
+		if reflect.DeepEqual(c.conns.activeByAddr(), map[string]int{"a:783": 1, "b:783": 2}) {
+			break
+		}
+		if i == 200 {
+			t.Fatalf("wrong connections: %v", c.conns.activeByAddr())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+	if errors.Cause(err) != ErrBackendsFull || ExitCode(err, false) != ExTempFail {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if a := c.conns.activeByAddr(); len(a) != 0 {
+		t.Errorf("connections not released: %v", a)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	release := make(chan struct{})
+	var (
+		mu    sync.Mutex
+		addrs []string
+	)
+	reply := replyDialer{func(req string) string {
+		if strings.HasPrefix(req, cmdPing) {
+			return "SPAMD/1.5 0 PONG\r\n"
+		}
+		<-release
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}}
+	c := New("default:783", dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		addrs = append(addrs, addr)
+		mu.Unlock()
+		return reply.DialContext(ctx, network, addr)
+	}))
+	c.SetBackends("a:783", "b:783")
+	ping := func(n int) []string {
+		mu.Lock()
+		addrs = nil
+		mu.Unlock()
+		for i := 0; i < n; i++ {
+			if err := c.Ping(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return addrs
+	}
+
+	checked := make(chan error)
+	go func() {
+		_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+		checked <- err
+	}()
+	for i := 0; c.conns.activeByAddr()["a:783"] != 1; i++ {
+		if i == 200 {
+			t.Fatal("command not started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		if err := c.Drain(ctx, "a:783"); err != context.DeadlineExceeded {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	drained := make(chan error)
+	go func() { drained <- c.Drain(context.Background(), "a:783") }()
+
+	if out, want := ping(3), []string{"b:783", "b:783", "b:783"}; !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned before command finished: %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-checked; err != nil {
+		t.Error(err)
+	}
+	if err := <-drained; err != nil {
+		t.Error(err)
+	}
+
+	c.Drain(context.Background(), "b:783") // nolint: errcheck
+	if out, want := ping(1), []string{"default:783"}; !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	c.Undrain("a:783")
+	c.Undrain("b:783")
+	out := ping(2)
+	sort.Strings(out)
+	if want := []string{"a:783", "b:783"}; !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
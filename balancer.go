@@ -0,0 +1,194 @@
+package spamc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backend is a spamd backend as passed to a Balancer.
+type Backend struct {
+	Addr string
+
+	// Active is the number of commands in progress on the backend.
+	Active int
+
+	// Latency is the time it took to connect to the backend the last time
+	// this succeeded; this is 0 if the client hasn't connected to it yet.
+	Latency time.Duration
+
+	// Failing is set if the last connection to the backend failed.
+	Failing bool
+}
+
+// Balancer selects the backend for a command from the backends set with
+// SetBackends(). Commands are distributed with round-robin if the Client
+// doesn't have a Balancer.
+type Balancer interface {
+	// Pick returns the address of one of the backends; backends is never
+	// empty. This is called concurrently.
+	Pick(backends []Backend) string
+}
+
+// WithBalancer sets the Balancer.
+func WithBalancer(b Balancer) Option {
+	return func(c *Client) { c.Balancer = b }
+}
+
+// pickBackend picks the address from the backends set with SetBackends(), or
+// returns an empty string if there are none. Drained backends are never
+// picked, and backends which are at their connection limit aren't picked
+// unless all of them are.
+//
+// The exclude address isn't picked unless it's the only backend; without a
+// Balancer, the backend after it is picked.
+func (c *Client) pickBackend(exclude string) string {
+	limited := c.hasBackendLimits()
+	if c.Balancer == nil && exclude == "" && !limited && !c.backends.hasDrained() {
+		return c.backends.pick()
+	}
+
+	addrs := c.backends.listAvailable()
+	if len(addrs) == 0 {
+		return ""
+	}
+	active := c.conns.activeByAddr()
+	available := func(addr string) bool {
+		l := c.backendLimit(addr)
+		return !limited || l <= 0 || active[addr] < l
+	}
+
+	if c.Balancer == nil {
+		if exclude != "" && len(addrs) > 1 {
+			for i, a := range addrs {
+				if a != exclude {
+					continue
+				}
+				for j := 1; j < len(addrs); j++ {
+					if next := addrs[(i+j)%len(addrs)]; available(next) {
+						return next
+					}
+				}
+				return addrs[(i+1)%len(addrs)]
+			}
+		}
+		for range addrs {
+			if a := addrs[c.backends.nextIndex(len(addrs))]; available(a) {
+				return a
+			}
+		}
+		return addrs[c.backends.nextIndex(len(addrs))]
+	}
+
+	backend := func(addr string) Backend {
+		st := c.health.status(addr)
+		return Backend{
+			Addr:    addr,
+			Active:  active[addr],
+			Latency: st.LastLatency,
+			Failing: st.ConsecutiveFailures > 0,
+		}
+	}
+	bs := make([]Backend, 0, len(addrs))
+	for _, a := range addrs {
+		if (a != exclude || len(addrs) == 1) && available(a) {
+			bs = append(bs, backend(a))
+		}
+	}
+	if len(bs) == 0 {
+		for _, a := range addrs {
+			bs = append(bs, backend(a))
+		}
+	}
+	return c.Balancer.Pick(bs)
+}
+
+// Weighted returns a Balancer which distributes commands in proportion to the
+// weights of the backends, for fleets where some hosts can handle more load
+// than others:
+//
+//   WithBalancer(Weighted(map[string]int{"new:783": 3, "old:783": 1}))
+//
+// Backends which aren't in weights have a weight of 1. Commands are spread
+// out evenly, rather than sending several commands in a row to the same
+// backend.
+func Weighted(weights map[string]int) Balancer {
+	return &weighted{weights: weights, current: make(map[string]int)}
+}
+
+// weighted is the "smooth weighted round-robin" algorithm from nginx.
+type weighted struct {
+	weights map[string]int
+
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (w *weighted) Pick(backends []Backend) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var (
+		best  string
+		total int
+	)
+	for _, b := range backends {
+		weight := weightOf(w.weights, b.Addr)
+		total += weight
+		w.current[b.Addr] += weight
+		if best == "" || w.current[b.Addr] > w.current[best] {
+			best = b.Addr
+		}
+	}
+	w.current[best] -= total
+
+	// Forget backends that were removed.
+	if len(w.current) > len(backends) {
+		for a := range w.current {
+			found := false
+			for _, b := range backends {
+				found = found || b.Addr == a
+			}
+			if !found {
+				delete(w.current, a)
+			}
+		}
+	}
+	return best
+}
+
+// LeastActive returns a Balancer which sends commands to the backend with the
+// fewest commands in progress, relative to its weight. Backends which aren't
+// in weights have a weight of 1; weights may be nil.
+//
+// Ties are broken with round-robin.
+func LeastActive(weights map[string]int) Balancer {
+	return &leastActive{weights: weights}
+}
+
+type leastActive struct {
+	weights map[string]int
+	next    uint32
+}
+
+func (l *leastActive) Pick(backends []Backend) string {
+	start := int(atomic.AddUint32(&l.next, 1)-1) % len(backends)
+
+	best, bestWeight := backends[start], weightOf(l.weights, backends[start].Addr)
+	for i := 1; i < len(backends); i++ {
+		b := backends[(start+i)%len(backends)]
+		weight := weightOf(l.weights, b.Addr)
+		// b.Active/weight < best.Active/bestWeight
+		if b.Active*bestWeight < best.Active*weight {
+			best, bestWeight = b, weight
+		}
+	}
+	return best.Addr
+}
+
+func weightOf(weights map[string]int, addr string) int {
+	if w, ok := weights[addr]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
@@ -0,0 +1,112 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type balancerFunc func([]Backend) string
+
+func (f balancerFunc) Pick(b []Backend) string { return f(b) }
+
+func TestWeighted(t *testing.T) {
+	b := Weighted(map[string]int{"a": 3, "c": 0})
+	backends := []Backend{{Addr: "a"}, {Addr: "b"}, {Addr: "c"}}
+
+	var out []string
+	for i := 0; i < 10; i++ {
+		out = append(out, b.Pick(backends))
+	}
+	want := []string{"a", "b", "a", "c", "a", "a", "b", "a", "c", "a"}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	// Removed backends are forgotten.
+	b.Pick([]Backend{{Addr: "a"}})
+	if l := len(b.(*weighted).current); l != 1 {
+		t.Errorf("removed backends not forgotten: %v", b.(*weighted).current)
+	}
+}
+
+func TestLeastActive(t *testing.T) {
+	cases := []struct {
+		weights  map[string]int
+		backends []Backend
+		want     []string
+	}{
+		{nil, []Backend{{Addr: "a", Active: 2}, {Addr: "b", Active: 1}, {Addr: "c", Active: 3}}, []string{"b", "b", "b"}},
+		{nil, []Backend{{Addr: "a", Active: 1}, {Addr: "b", Active: 1}, {Addr: "c", Active: 3}}, []string{"a", "b", "a"}},
+		{map[string]int{"a": 3}, []Backend{{Addr: "a", Active: 5}, {Addr: "b", Active: 2}}, []string{"a", "a", "a"}},
+		{map[string]int{"a": 3}, []Backend{{Addr: "a", Active: 7}, {Addr: "b", Active: 2}}, []string{"b", "b", "b"}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			b := LeastActive(tc.weights)
+			var out []string
+			for range tc.want {
+				out = append(out, b.Pick(tc.backends))
+			}
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestBalancer(t *testing.T) {
+	release := make(chan struct{})
+	reply := replyDialer{func(req string) string {
+		if strings.HasPrefix(req, cmdPing) {
+			return "SPAMD/1.5 0 PONG\r\n"
+		}
+		<-release
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}}
+
+	var (
+		mu     sync.Mutex
+		picked [][]Backend
+	)
+	c := New("default:783", dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return reply.DialContext(ctx, network, addr)
+	}), WithBalancer(balancerFunc(func(b []Backend) string {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := range b {
+			b[i].Latency = 0
+		}
+		picked = append(picked, b)
+		return "b:783"
+	})))
+	c.SetBackends("a:783", "b:783")
+
+	go c.Check(context.Background(), strings.NewReader("A message"), nil) // nolint: errcheck
+	for i := 0; c.conns.activeByAddr()["b:783"] != 1; i++ {
+		if i == 200 {
+			t.Fatal("command not started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	want := [][]Backend{
+		{{Addr: "a:783"}, {Addr: "b:783"}},
+		{{Addr: "a:783"}, {Addr: "b:783", Active: 1}},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(picked, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", picked, want)
+	}
+}
@@ -0,0 +1,85 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/spamc/spamdtest"
+)
+
+// The benchmarks below send commands to a spamdtest server, to measure the
+// full send and parse path. spamd closes the connection after every command,
+// so there is no connection pool; every command uses a new connection.
+//
+// Run with:
+//
+//   go test -run '^$' -bench Server -benchmem
+
+var benchMessage = BuildMessage(map[string][]string{
+	"From":    {"sender@example.com"},
+	"To":      {"rcpt@example.com"},
+	"Subject": {"Benchmark"},
+}, strings.Repeat("A message line which is repeated a few times.\r\n", 200))
+
+func benchServer(b *testing.B, cmd string, compress, parallel bool) {
+	srv := spamdtest.NewServer(nil)
+	defer srv.Close()
+	c := New(srv.Addr, nil)
+	ctx := context.Background()
+
+	msg := make([]byte, benchMessage.Size())
+	if _, err := benchMessage.ReadAt(msg, 0); err != nil {
+		b.Fatal(err)
+	}
+
+	run := func() error {
+		read, hdr, tp, err := c.do(ctx, &Request{
+			Command:  cmd,
+			Message:  bytes.NewReader(msg),
+			Compress: compress,
+		})
+		if err != nil {
+			return err
+		}
+		defer read.Close() // nolint: errcheck
+		_, err = parser(cmd)(RawResponse{Header: hdr, Body: tp.R, client: c})
+		return err
+	}
+
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	if !parallel {
+		for n := 0; n < b.N; n++ {
+			if err := run(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := run(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkServer(b *testing.B) {
+	for _, cmd := range []string{cmdCheck, cmdSymbols, cmdReport} {
+		for _, compress := range []bool{false, true} {
+			for _, parallel := range []bool{false, true} {
+				name := fmt.Sprintf("%s/compress=%t/parallel=%t", cmd, compress, parallel)
+				b.Run(name, func(b *testing.B) {
+					benchServer(b, cmd, compress, parallel)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package spamc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer is the maximum capacity of buffers that are returned to the
+// pool; larger buffers are left for the GC so a single large message doesn't
+// keep a lot of memory in use.
+const maxPooledBuffer = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer gets an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns the buffer to the pool; it must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// copyBufferSize is the size of the buffers used to copy messages to spamd.
+const copyBufferSize = 32 * 1024
+
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
+// getCopyBuffer gets a buffer for io.CopyBuffer() from the pool.
+func getCopyBuffer() *[]byte { return copyBufferPool.Get().(*[]byte) }
+
+// putCopyBuffer returns the buffer to the pool.
+func putCopyBuffer(b *[]byte) { copyBufferPool.Put(b) }
+
+// writeBuffered writes the preamble followed by the message to w, using buf
+// as the write buffer. Small commands are sent with a single write.
+func writeBuffered(w io.Writer, preamble []byte, message io.Reader, buf []byte) error {
+	n := 0
+	if len(preamble) < len(buf) {
+		n = copy(buf, preamble)
+	} else if _, err := w.Write(preamble); err != nil {
+		return err
+	}
+
+	for {
+		m, rerr := message.Read(buf[n:])
+		n += m
+		if rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+
+		if n == len(buf) || (rerr == io.EOF && n > 0) {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			n = 0
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// countReader counts the number of bytes read.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// sortStrings sorts a small slice of strings with an insertion sort; unlike
+// sort.Strings() this doesn't allocate.
+func sortStrings(s []string) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j] < s[j-1]; j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
+
+// readLine reads a single line without the line ending. The returned slice is
+// only valid until the next call; buf is used for lines which don't fit in the
+// bufio.Reader's buffer.
+//
+// The error is io.EOF if there are no more lines.
+func readLine(r *bufio.Reader, buf *bytes.Buffer) ([]byte, error) {
+	buf.Reset()
+	for {
+		line, isPrefix, err := r.ReadLine()
+		if err != nil {
+			if err == io.EOF && buf.Len() > 0 {
+				return buf.Bytes(), nil
+			}
+			return nil, err
+		}
+		if !isPrefix && buf.Len() == 0 {
+			return line, nil
+		}
+
+		buf.Write(line)
+		if !isPrefix {
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+// copyBody copies the body from r to buf, converting all line endings to CRLF.
+func copyBody(buf *bytes.Buffer, r *bufio.Reader) error {
+	for {
+		line, isPrefix, err := r.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		buf.Write(line)
+		if !isPrefix {
+			buf.WriteString("\r\n")
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package spamc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a\nb\r\n\r\nc", []string{"a", "b", "", "c"}},
+		{long + "\r\n" + long, []string{long, long}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tc.in), 16)
+			buf := new(bytes.Buffer)
+
+			var out []string
+			for {
+				line, err := readLine(r, buf)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				out = append(out, string(line))
+			}
+
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestCopyBody(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	r := bufio.NewReaderSize(strings.NewReader("a\n"+long+"\r\nb"), 16)
+	buf := new(bytes.Buffer)
+	if err := copyBody(buf, r); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a\r\n" + long + "\r\nb\r\n"
+	if out := buf.String(); out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
@@ -0,0 +1,123 @@
+package spamc
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Chaos is a Dialer which injects faults, so that applications can test how
+// they deal with a slow or failing spamd in staging, without touching spamd:
+//
+//   c := New(addr, &Chaos{
+//       Latency:      200 * time.Millisecond,
+//       Jitter:       300 * time.Millisecond,
+//       TempFailRate: 0.05,
+//       ResetRate:    0.01,
+//   }, WithTimeout(5*time.Second))
+//
+// The Dialer's Timeout isn't used as the Client's Timeout, so set it with
+// WithTimeout(). Injected EX_TEMPFAIL responses don't work with TLS, as no
+// connection is made to spamd.
+type Chaos struct {
+	// Dialer is used to connect to spamd; this defaults to a net.Dialer.
+	Dialer Dialer
+
+	// Latency is added to every connection, plus a random duration of up to
+	// Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// TempFailRate is the fraction of commands, from 0 to 1, that fail with
+	// EX_TEMPFAIL without being sent to spamd.
+	TempFailRate float64
+
+	// ResetRate is the fraction of commands, from 0 to 1, for which the
+	// connection is reset after the command was sent.
+	ResetRate float64
+
+	// Rand returns a random number in [0, 1); this defaults to
+	// rand.Float64. Set it to get reproducible faults.
+	Rand func() float64
+}
+
+// DialContext connects to spamd, after the latency. The connection may fail
+// with EX_TEMPFAIL or a reset.
+func (c *Chaos) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d := c.Latency + time.Duration(c.rand()*float64(c.Jitter)); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	if c.rand() < c.TempFailRate {
+		return &tempFailConn{r: strings.NewReader("SPAMD/1.1 75 EX_TEMPFAIL\r\n\r\n")}, nil
+	}
+
+	conn, err := c.getDialer().DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if c.rand() < c.ResetRate {
+		return &resetConn{Conn: conn}, nil
+	}
+	return conn, nil
+}
+
+func (c *Chaos) rand() float64 {
+	if c.Rand != nil {
+		return c.Rand()
+	}
+	return rand.Float64()
+}
+
+var chaosDialer = &net.Dialer{Timeout: 20 * time.Second, FallbackDelay: defaultFallbackDelay}
+
+func (c *Chaos) getDialer() Dialer {
+	if c.Dialer == nil {
+		return chaosDialer
+	}
+	return c.Dialer
+}
+
+// tempFailConn discards the command and replies with EX_TEMPFAIL.
+type tempFailConn struct {
+	r *strings.Reader
+}
+
+func (c *tempFailConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c *tempFailConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *tempFailConn) Close() error                       { return nil }
+func (c *tempFailConn) CloseWrite() error                  { return nil }
+func (c *tempFailConn) LocalAddr() net.Addr                { return nil }
+func (c *tempFailConn) RemoteAddr() net.Addr               { return nil }
+func (c *tempFailConn) SetDeadline(t time.Time) error      { return nil }
+func (c *tempFailConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *tempFailConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// resetConn sends the command, and fails with ECONNRESET when the response is
+// read.
+type resetConn struct {
+	net.Conn
+}
+
+func (c *resetConn) Read(b []byte) (int, error) {
+	c.Conn.Close() // nolint: errcheck
+	return 0, &net.OpError{Op: "read", Net: "tcp", Addr: c.RemoteAddr(), Err: syscall.ECONNRESET}
+}
+
+func (c *resetConn) CloseWrite() error {
+	if cw, ok := c.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+var _ net.Conn = &tempFailConn{}
@@ -0,0 +1,57 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func TestChaos(t *testing.T) {
+	cases := []struct {
+		in          Chaos
+		rand        []float64
+		wantErr     string
+		wantTemp    bool
+		wantLatency time.Duration
+	}{
+		{Chaos{}, nil, "", false, 0},
+		{Chaos{TempFailRate: 0.5}, []float64{0, 0.4}, "EX_TEMPFAIL", true, 0},
+		{Chaos{TempFailRate: 0.5}, []float64{0, 0.6, 0.9}, "", false, 0},
+		{Chaos{ResetRate: 0.5}, []float64{0, 0.9, 0.1}, "connection reset", true, 0},
+		{Chaos{Latency: 20 * time.Millisecond, Jitter: 100 * time.Millisecond},
+			[]float64{0.3, 0.9, 0.9}, "", false, 50 * time.Millisecond},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			tc.in.Dialer = replyDialer{func(req string) string {
+				return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.6 / 5.0\r\n\r\n"
+			}}
+			tc.in.Rand = func() float64 {
+				if len(tc.rand) == 0 {
+					return 0.99
+				}
+				r := tc.rand[0]
+				tc.rand = tc.rand[1:]
+				return r
+			}
+
+			c := New("", &tc.in)
+			start := time.Now()
+			_, err := c.Check(context.Background(), strings.NewReader("Message"), nil)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if err != nil && IsTemporary(err) != tc.wantTemp {
+				t.Errorf("IsTemporary: %v", IsTemporary(err))
+			}
+			if d := time.Since(start); d < tc.wantLatency {
+				t.Errorf("latency too low: %v", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package spamc
+
+// Class is the classification of a spam score; see
+// ResponseScore.Classification().
+type Class int
+
+// Classification bands, from least to most spammy.
+const (
+	ClassHam            Class = iota // Not spam.
+	ClassSuspicious                  // Not spam, but close to it.
+	ClassSpam                        // Spam.
+	ClassHighConfidence              // Spam with a score well over the threshold.
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassHam:
+		return "ham"
+	case ClassSuspicious:
+		return "suspicious"
+	case ClassSpam:
+		return "spam"
+	case ClassHighConfidence:
+		return "high-confidence"
+	default:
+		return "unknown"
+	}
+}
+
+// Bands are the score cut-offs for classifying a score. A score is in a band
+// if it's equal to or higher than the cut-off, and lower than the cut-off of
+// the next band.
+type Bands struct {
+	Suspicious     float64
+	Spam           float64
+	HighConfidence float64
+}
+
+// DefaultBands returns the bands relative to the server's required score:
+// suspicious from half the required score, and high-confidence from twice the
+// required score.
+func DefaultBands(required float64) Bands {
+	return Bands{
+		Suspicious:     required / 2,
+		Spam:           required,
+		HighConfidence: required * 2,
+	}
+}
+
+// Classify the score.
+func (b Bands) Classify(score float64) Class {
+	switch {
+	case score >= b.HighConfidence:
+		return ClassHighConfidence
+	case score >= b.Spam:
+		return ClassSpam
+	case score >= b.Suspicious:
+		return ClassSuspicious
+	default:
+		return ClassHam
+	}
+}
+
+// defaultRequiredScore is spamd's default required score.
+const defaultRequiredScore = 5
+
+// Classification returns the classification of the score using the
+// DefaultBands() for the score from which the message is spam, so that it
+// agrees with IsSpam. This is the Client's Threshold if it was set, or the
+// BaseScore otherwise; spamd's default of 5 is used if the BaseScore is
+// missing or not positive. Use Bands.Classify() for different cut-offs:
+//
+//   Bands{Suspicious: 3, Spam: 6, HighConfidence: 15}.Classify(r.Score)
+func (r ResponseScore) Classification() Class {
+	required := r.threshold
+	if required == 0 {
+		required = r.BaseScore
+		if required <= 0 {
+			required = defaultRequiredScore
+		}
+	}
+	return DefaultBands(required).Classify(r.Score)
+}
@@ -0,0 +1,75 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestClassification(t *testing.T) {
+	cases := []struct {
+		in   ResponseScore
+		want Class
+	}{
+		{ResponseScore{Score: -1, BaseScore: 5}, ClassHam},
+		{ResponseScore{Score: 2.4, BaseScore: 5}, ClassHam},
+		{ResponseScore{Score: 2.5, BaseScore: 5}, ClassSuspicious},
+		{ResponseScore{Score: 4.9, BaseScore: 5}, ClassSuspicious},
+		{ResponseScore{Score: 5, BaseScore: 5}, ClassSpam},
+		{ResponseScore{Score: 9.9, BaseScore: 5}, ClassSpam},
+		{ResponseScore{Score: 10, BaseScore: 5}, ClassHighConfidence},
+		{ResponseScore{Score: 1000, BaseScore: 5}, ClassHighConfidence},
+
+		// Missing or negative base score.
+		{ResponseScore{Score: 1}, ClassHam},
+		{ResponseScore{Score: 6}, ClassSpam},
+		{ResponseScore{Score: 1, BaseScore: -2}, ClassHam},
+
+		// Client Threshold.
+		{ResponseScore{Score: 4, BaseScore: 5, threshold: 3}, ClassSpam},
+		{ResponseScore{Score: 6, BaseScore: 5, threshold: 8}, ClassSuspicious},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := tc.in.Classification()
+			if out != tc.want {
+				t.Errorf("\nout:  %v\nwant: %v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestBandsClassify(t *testing.T) {
+	b := Bands{Suspicious: 3, Spam: 6, HighConfidence: 15}
+	cases := []struct {
+		in   float64
+		want Class
+	}{
+		{2.9, ClassHam},
+		{3, ClassSuspicious},
+		{6, ClassSpam},
+		{15, ClassHighConfidence},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := b.Classify(tc.in)
+			if out != tc.want {
+				t.Errorf("\nout:  %v\nwant: %v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestClassificationMissingBaseScore(t *testing.T) {
+	c := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.5\r\n\r\n")
+	out, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.IsSpam || out.BaseScore != 0 || out.Classification() != ClassHam {
+		t.Errorf("wrong classification: %v for %#v", out.Classification(), out.ResponseScore)
+	}
+}
@@ -0,0 +1,207 @@
+package spamc
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrClientClosed is returned for commands sent after Close() was called.
+var ErrClientClosed = errors.New("spamc: client is closed")
+
+// Close the client: new commands are rejected with ErrClientClosed and Close
+// waits for commands that are in progress to finish. Connections that are
+// still open when ctx is done are closed.
+//
+// Clones share their connections with the Client they were cloned from, so
+// closing a Client also closes all its clones.
+func (c *Client) Close(ctx context.Context) error {
+	done := c.conns.close()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.log().Warn("closing connections that are still in use", "error", ctx.Err())
+		c.conns.closeAll()
+		return ctx.Err()
+	}
+}
+
+// conns tracks the open connections of a Client.
+type conns struct {
+	mu     sync.Mutex
+	closed bool
+	active map[*trackedConn]struct{}
+	byAddr map[string]int // Number of reserved connections by address.
+	done   chan struct{}  // Closed once there are no active connections after close().
+}
+
+func newConns() *conns {
+	return &conns{
+		active: make(map[*trackedConn]struct{}),
+		byAddr: make(map[string]int),
+		done:   make(chan struct{}),
+	}
+}
+
+// isClosed reports if close() was called.
+func (cs *conns) isClosed() bool {
+	if cs == nil {
+		return false
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.closed
+}
+
+// reserve a connection to addr, if there are fewer than limit connections to
+// it; limit is ignored if it's 0 or lower. The reservation is released once
+// the tracked connection is closed, or with unreserve() if the connection
+// failed.
+func (cs *conns) reserve(addr string, limit int) bool {
+	if cs == nil {
+		return true
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if limit > 0 && cs.byAddr[addr] >= limit {
+		return false
+	}
+	cs.byAddr[addr]++
+	return true
+}
+
+// unreserve releases a reservation made with reserve().
+func (cs *conns) unreserve(addr string) {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.unreserveLocked(addr)
+}
+
+func (cs *conns) unreserveLocked(addr string) {
+	cs.byAddr[addr]--
+	if cs.byAddr[addr] <= 0 {
+		delete(cs.byAddr, addr)
+	}
+}
+
+// track the connection to addr until it's closed; the connection must be
+// reserved with reserve(). The connection is closed and ErrClientClosed is
+// returned if close() was called.
+func (cs *conns) track(conn net.Conn, addr string) (net.Conn, error) {
+	if cs == nil {
+		return conn, nil
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		conn.Close() // nolint: errcheck
+		cs.unreserveLocked(addr)
+		return nil, ErrClientClosed
+	}
+
+	tc := &trackedConn{Conn: conn, conns: cs, addr: addr}
+	cs.active[tc] = struct{}{}
+	return tc, nil
+}
+
+// activeByAddr returns the number of reserved connections for every address
+// that has any.
+func (cs *conns) activeByAddr() map[string]int {
+	if cs == nil {
+		return nil
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	m := make(map[string]int, len(cs.byAddr))
+	for a, n := range cs.byAddr {
+		m[a] = n
+	}
+	return m
+}
+
+// release stops tracking the connection.
+func (cs *conns) release(tc *trackedConn) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.active, tc)
+	cs.unreserveLocked(tc.addr)
+	if cs.closed && len(cs.active) == 0 {
+		closeOnce(cs.done)
+	}
+}
+
+// close marks the client as closed; the returned channel is closed once all
+// active connections are closed.
+func (cs *conns) close() <-chan struct{} {
+	if cs == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.closed = true
+	if len(cs.active) == 0 {
+		closeOnce(cs.done)
+	}
+	return cs.done
+}
+
+// closeAll closes all active connections.
+func (cs *conns) closeAll() {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	active := make([]*trackedConn, 0, len(cs.active))
+	for tc := range cs.active {
+		active = append(active, tc)
+	}
+	cs.mu.Unlock()
+
+	for _, tc := range active {
+		tc.Close() // nolint: errcheck
+	}
+}
+
+func closeOnce(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// trackedConn is a connection that is released from conns once it's closed.
+type trackedConn struct {
+	net.Conn
+	conns *conns
+	addr  string
+	once  sync.Once
+}
+
+func (tc *trackedConn) Close() error {
+	err := tc.Conn.Close()
+	tc.once.Do(func() { tc.conns.release(tc) })
+	return err
+}
+
+func (tc *trackedConn) CloseWrite() error {
+	if cc, ok := tc.Conn.(closeWriter); ok {
+		return cc.CloseWrite()
+	}
+	return nil
+}
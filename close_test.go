@@ -0,0 +1,73 @@
+package spamc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestClose(t *testing.T) {
+	t.Run("rejects", func(t *testing.T) {
+		c := newClient("SPAMD/1.5 0 PONG\r\n")
+		clone := c.Clone()
+		if err := c.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, cl := range []*Client{c, clone} {
+			err := cl.Ping(context.Background())
+			if errors.Cause(err) != ErrClientClosed {
+				t.Errorf("wrong error: %v", err)
+			}
+		}
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		if err := (&Client{}).Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("in progress", func(t *testing.T) {
+		client, server := net.Pipe()
+		c := New("", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+			return client, nil
+		}))
+
+		// Signal once the command is written; spamd never replies.
+		started := make(chan struct{})
+		go func() {
+			b := make([]byte, 1)
+			server.Read(b) // nolint: errcheck
+			close(started)
+			for {
+				if _, err := server.Read(b); err != nil {
+					return
+				}
+			}
+		}()
+
+		checkErr := make(chan error)
+		go func() {
+			_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+			checkErr <- err
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := c.Close(ctx); err != context.DeadlineExceeded {
+			t.Errorf("wrong error from Close: %v", err)
+		}
+		if err := <-checkErr; err == nil {
+			t.Error("Check didn't fail")
+		}
+		if n := len(c.conns.active); n != 0 {
+			t.Errorf("%d connections still active", n)
+		}
+	})
+}
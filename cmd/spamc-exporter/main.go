@@ -0,0 +1,126 @@
+// Command spamc-exporter exposes Prometheus metrics about the verdicts of
+// spamc clients, and the availability and latency of spamd backends:
+//
+//   spamc-exporter -listen :9783 -spamd 10.0.0.1:783,10.0.0.2:783 -secret-file /etc/spamc/hook
+//
+// Verdicts are only known to the process that sends the messages, so mail
+// gateways send them to the exporter with the webhook package; set the
+// Threshold to -Inf so that all verdicts are sent, rather than only spam:
+//
+//   n := webhook.New("http://exporter:9783/verdicts", secret, math.Inf(-1))
+//   client := spamc.New(addr, nil, spamc.WithVerdictSink(n))
+//
+// The verdicts are recorded in the spamc_verdicts_total counter and the
+// spamc_score histogram. The spamd backends are probed with PING, and their
+// latency is recorded in spamc_backend_latency_seconds and
+// spamc_command_duration_seconds. Probing is disabled if -spamd is empty.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/teamwork/spamc"
+	"github.com/teamwork/spamc/promexport"
+	"github.com/teamwork/spamc/webhook"
+)
+
+func main() {
+	listen := flag.String("listen", ":9783", "address to serve metrics and receive verdicts on")
+	addrs := flag.String("spamd", spamc.DefaultAddress, "comma-separated spamd addresses to probe")
+	interval := flag.Duration("interval", 15*time.Second, "time between probes")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout for a probe")
+	secretFile := flag.String("secret-file", "", "file with the secret that verdicts are signed with")
+	flag.Parse()
+
+	var secret []byte
+	if *secretFile != "" {
+		var err error
+		secret, err = ioutil.ReadFile(*secretFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		secret = []byte(strings.TrimSpace(string(secret)))
+	}
+
+	exp := promexport.New()
+	if backends := splitAddrs(*addrs); len(backends) > 0 {
+		client := spamc.New(spamc.DefaultAddress, nil,
+			spamc.WithTimeout(*timeout),
+			spamc.WithOnCommand(exp.OnCommand))
+		client.SetBackends(backends...)
+		go probe(client, exp, *interval, *timeout)
+	}
+
+	http.Handle("/metrics", exp)
+	http.Handle("/verdicts", verdictHandler(exp, secret))
+	if err := http.ListenAndServe(*listen, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// splitAddrs splits a comma-separated list of addresses, ignoring empty
+// entries.
+func splitAddrs(addrs string) []string {
+	var r []string
+	for _, a := range strings.Split(addrs, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			r = append(r, a)
+		}
+	}
+	return r
+}
+
+// probe the backends every interval.
+func probe(client *spamc.Client, exp *promexport.Exporter, interval, timeout time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		for _, s := range client.HealthCheck(ctx) {
+			exp.ObserveBackend(s)
+		}
+		cancel()
+		time.Sleep(interval)
+	}
+}
+
+// verdictHandler records the verdicts sent by a webhook.Notifier. The
+// signature is verified if secret is set.
+func verdictHandler(sink spamc.VerdictSink, secret []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(secret) > 0 && !webhook.Verify(secret, body, r.Header.Get(webhook.SignatureHeader)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var v spamc.Verdict
+		if err := json.Unmarshal(body, &v); err != nil {
+			http.Error(w, "invalid verdict: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := sink.Accept(r.Context(), v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/spamc"
+	"github.com/teamwork/spamc/webhook"
+)
+
+func TestSplitAddrs(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{",", nil},
+		{"a:783", []string{"a:783"}},
+		{"a:783,", []string{"a:783"}},
+		{" a:783 , ,b:783", []string{"a:783", "b:783"}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := splitAddrs(tc.in)
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerdictHandler(t *testing.T) {
+	var got []spamc.Verdict
+	sink := spamc.VerdictSinkFunc(func(ctx context.Context, v spamc.Verdict) error {
+		got = append(got, v)
+		return nil
+	})
+	secret := []byte("secret")
+	body := `{"command":"CHECK","is_spam":true,"score":6.5,"base_score":5}`
+
+	cases := []struct {
+		method, body, signature string
+		want                    int
+	}{
+		{http.MethodPost, body, webhook.Sign(secret, []byte(body)), http.StatusNoContent},
+		{http.MethodPost, body, "", http.StatusUnauthorized},
+		{http.MethodPost, body, webhook.Sign([]byte("other"), []byte(body)), http.StatusUnauthorized},
+		{http.MethodPost, "{", webhook.Sign(secret, []byte("{")), http.StatusBadRequest},
+		{http.MethodGet, "", "", http.StatusMethodNotAllowed},
+	}
+
+	h := verdictHandler(sink, secret)
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/verdicts", strings.NewReader(tc.body))
+			r.Header.Set(webhook.SignatureHeader, tc.signature)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("wrong status %v: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	want := []spamc.Verdict{{Command: "CHECK", IsSpam: true, Score: 6.5, BaseScore: 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", got, want)
+	}
+}
@@ -0,0 +1,252 @@
+package spamc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the Client configuration, for loading it from a configuration
+// file. The zero value for all fields means "use the default".
+type Config struct {
+	// Address of spamd; defaults to DefaultAddress.
+	Address string `json:"address" yaml:"address"`
+
+	// Routes maps users to spamd addresses; see RouteMap.
+	Routes map[string]string `json:"routes" yaml:"routes"`
+
+	// Backends to distribute commands over; see SetBackends().
+	Backends []string `json:"backends" yaml:"backends"`
+
+	DefaultUser    string            `json:"default_user" yaml:"default_user"`
+	DefaultHeaders map[string]string `json:"default_headers" yaml:"default_headers"`
+	Threshold      float64           `json:"threshold" yaml:"threshold"`
+
+	Timeout     Duration `json:"timeout" yaml:"timeout"`
+	IdleTimeout Duration `json:"idle_timeout" yaml:"idle_timeout"`
+
+	KeepAlive Duration `json:"keep_alive" yaml:"keep_alive"`
+	Delay     bool     `json:"delay" yaml:"delay"`
+	Linger    Duration `json:"linger" yaml:"linger"`
+
+	// FallbackDelay before trying the other address family; see
+	// WithFallbackDelay().
+	FallbackDelay Duration `json:"fallback_delay" yaml:"fallback_delay"`
+
+	// Compress messages with zlib; see Client.Compress.
+	Compress bool `json:"compress" yaml:"compress"`
+
+	Retry  ConfigRetry  `json:"retry" yaml:"retry"`
+	Limits ConfigLimits `json:"limits" yaml:"limits"`
+	TLS    ConfigTLS    `json:"tls" yaml:"tls"`
+
+	Debug          bool `json:"debug" yaml:"debug"`
+	DebugBodyLimit int  `json:"debug_body_limit" yaml:"debug_body_limit"`
+}
+
+// ConfigRetry is the retry policy; see RetryPolicy.
+type ConfigRetry struct {
+	Attempts  int      `json:"attempts" yaml:"attempts"`
+	Backoff   Duration `json:"backoff" yaml:"backoff"`
+	RetryTell bool     `json:"retry_tell" yaml:"retry_tell"`
+}
+
+// ConfigLimits are the limits on the number of commands in progress; there is
+// no limit if a field is 0.
+type ConfigLimits struct {
+	// Concurrency and Queue are the global limit and the size of the queue;
+	// see WithConcurrencyLimit(). The queue is unbounded if Queue is
+	// negative.
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+	Queue       int `json:"queue" yaml:"queue"`
+
+	// InteractiveReserve is the number of slots reserved for interactive
+	// commands; see WithInteractiveReserve().
+	InteractiveReserve int `json:"interactive_reserve" yaml:"interactive_reserve"`
+
+	// Backend and Backends are the limits per backend; see
+	// WithBackendLimits().
+	Backend  int            `json:"backend" yaml:"backend"`
+	Backends map[string]int `json:"backends" yaml:"backends"`
+}
+
+// ConfigTLS is the TLS configuration.
+type ConfigTLS struct {
+	Enable     bool   `json:"enable" yaml:"enable"`
+	CA         string `json:"ca" yaml:"ca"`     // File with PEM-encoded CA certificates.
+	Cert       string `json:"cert" yaml:"cert"` // File with a PEM-encoded client certificate.
+	Key        string `json:"key" yaml:"key"`   // File with the key for Cert.
+	ServerName string `json:"server_name" yaml:"server_name"`
+	Insecure   bool   `json:"insecure" yaml:"insecure"` // Don't verify the server's certificate.
+}
+
+// Duration is a time.Duration which is read from and written as a string such
+// as "5s" in configuration files.
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler; durations without a unit
+// are in seconds.
+func (d *Duration) UnmarshalText(v []byte) error {
+	t, err := parseTimeout(string(v))
+	if err != nil {
+		return err
+	}
+	*d = Duration(t)
+	return nil
+}
+
+// Validate the configuration.
+func (c Config) Validate() error {
+	if c.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return errors.Wrap(err, "address")
+		}
+	}
+	for user, addr := range c.Routes {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return errors.Wrapf(err, "route for %q", user)
+		}
+	}
+	for _, addr := range c.Backends {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return errors.Wrap(err, "backends")
+		}
+	}
+	for k, v := range c.DefaultHeaders {
+		if err := checkHeader(Header{}.normalizeKey(k), v); err != nil {
+			return errors.Wrap(err, "default_headers")
+		}
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("timeout: must not be negative")
+	}
+	if c.IdleTimeout < 0 {
+		return errors.New("idle_timeout: must not be negative")
+	}
+	if c.DebugBodyLimit < 0 {
+		return errors.New("debug_body_limit: must not be negative")
+	}
+	if c.Retry.Attempts < 0 || c.Retry.Backoff < 0 {
+		return errors.New("retry: must not be negative")
+	}
+	if err := c.Limits.validate(); err != nil {
+		return errors.Wrap(err, "limits")
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		return errors.New("tls: cert and key must be set together")
+	}
+
+	return nil
+}
+
+func (c ConfigLimits) validate() error {
+	if c.Concurrency < 0 || c.InteractiveReserve < 0 || c.Backend < 0 {
+		return errors.New("must not be negative")
+	}
+	if c.InteractiveReserve > 0 && c.InteractiveReserve >= c.Concurrency {
+		return errors.New("interactive_reserve: must be lower than concurrency")
+	}
+	for addr, l := range c.Backends {
+		if l < 0 {
+			return errors.Errorf("backend %q: must not be negative", addr)
+		}
+	}
+	return nil
+}
+
+// NewFromConfig creates a new Client from the configuration. The opts are
+// applied after the configuration.
+func NewFromConfig(cfg Config, opts ...Option) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid configuration")
+	}
+
+	addr := cfg.Address
+	if addr == "" {
+		addr = DefaultAddress
+	}
+
+	tcfg, err := cfg.TLS.config()
+	if err != nil {
+		return nil, errors.Wrap(err, "tls")
+	}
+
+	cfgOpts := []Option{
+		WithDefaultUser(cfg.DefaultUser),
+		WithThreshold(cfg.Threshold),
+		WithTimeout(time.Duration(cfg.Timeout)),
+		WithIdleTimeout(time.Duration(cfg.IdleTimeout)),
+		WithSocketOptions(SocketOptions{
+			KeepAlive: time.Duration(cfg.KeepAlive),
+			Delay:     cfg.Delay,
+			Linger:    time.Duration(cfg.Linger),
+		}),
+		WithTLS(tcfg),
+		WithCompression(cfg.Compress),
+		WithRetry(RetryPolicy{
+			Attempts:  cfg.Retry.Attempts,
+			Backoff:   time.Duration(cfg.Retry.Backoff),
+			RetryTell: cfg.Retry.RetryTell,
+		}),
+		WithConcurrencyLimit(cfg.Limits.Concurrency, cfg.Limits.Queue),
+		WithInteractiveReserve(cfg.Limits.InteractiveReserve),
+		WithBackendLimits(cfg.Limits.Backend, cfg.Limits.Backends),
+	}
+	if len(cfg.Routes) > 0 {
+		cfgOpts = append(cfgOpts, WithRouter(RouteMap(cfg.Routes)))
+	}
+	if len(cfg.DefaultHeaders) > 0 {
+		cfgOpts = append(cfgOpts, WithDefaultHeaders(Header(cfg.DefaultHeaders)))
+	}
+	if cfg.FallbackDelay != 0 {
+		cfgOpts = append(cfgOpts, WithFallbackDelay(time.Duration(cfg.FallbackDelay)))
+	}
+	if cfg.Debug {
+		cfgOpts = append(cfgOpts, WithDebug(cfg.DebugBodyLimit))
+	}
+
+	c := New(addr, nil, append(cfgOpts, opts...)...)
+	if len(cfg.Backends) > 0 {
+		c.SetBackends(cfg.Backends...)
+	}
+	return c, nil
+}
+
+// config creates the tls.Config; it returns nil if TLS isn't enabled.
+func (c ConfigTLS) config() (*tls.Config, error) {
+	if !c.Enable {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.Insecure}
+	if c.CA != "" {
+		pem, err := ioutil.ReadFile(c.CA)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read CA")
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates in %v", c.CA)
+		}
+	}
+
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,117 @@
+package spamc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		in      Config
+		wantErr string
+	}{
+		{Config{}, ""},
+		{Config{Address: "spamd:783", Routes: map[string]string{"a": "shard1:783"}}, ""},
+		{Config{Address: "spamd"}, "address"},
+		{Config{Routes: map[string]string{"a": "shard1"}}, `route for "a"`},
+		{Config{Timeout: -1}, "timeout"},
+		{Config{IdleTimeout: -1}, "idle_timeout"},
+		{Config{DebugBodyLimit: -1}, "debug_body_limit"},
+		{Config{TLS: ConfigTLS{Cert: "cert.pem"}}, "cert and key"},
+		{Config{Backends: []string{"spamd1:783", "spamd2"}}, "backends"},
+		{Config{DefaultHeaders: map[string]string{"message-class": "eggs"}}, "default_headers: unknown value"},
+		{Config{DefaultHeaders: map[string]string{"set": "local,nowhere"}}, "default_headers: unknown value"},
+		{Config{Retry: ConfigRetry{Attempts: -1}}, "retry"},
+		{Config{Limits: ConfigLimits{Concurrency: -1}}, "limits"},
+		{Config{Limits: ConfigLimits{Concurrency: 2, InteractiveReserve: 2}}, "interactive_reserve"},
+		{Config{Limits: ConfigLimits{InteractiveReserve: 1}}, "interactive_reserve"},
+		{Config{Limits: ConfigLimits{Backends: map[string]int{"spamd1:783": -1}}}, `backend "spamd1:783"`},
+		{Config{Limits: ConfigLimits{Concurrency: 4, Queue: -1, InteractiveReserve: 1, Backend: 2}}, ""},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			err := tc.in.Validate()
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Errorf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{
+		"address":         "spamd:783",
+		"routes":          {"acct42": "shard1:783"},
+		"default_user":    "nobody",
+		"default_headers": {"x-tenant": "42"},
+		"timeout":         "5s",
+		"idle_timeout":    "30",
+		"keep_alive":      "1m",
+		"fallback_delay":  "100ms",
+		"debug":           true,
+		"backends":        ["spamd1:783", "spamd2:783"],
+		"compress":        true,
+		"retry":           {"attempts": 3, "backoff": "50ms"},
+		"limits":          {"concurrency": 8, "queue": -1, "backend": 4, "backends": {"spamd2:783": 2}}
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.addr != "spamd:783" || c.DefaultUser != "nobody" || c.Timeout != 5*time.Second ||
+		c.IdleTimeout != 30*time.Second || c.Socket.KeepAlive != time.Minute ||
+		!c.Debug || c.TLSConfig != nil ||
+		c.dialer.(*net.Dialer).FallbackDelay != 100*time.Millisecond {
+		t.Errorf("wrong client: %#v", c)
+	}
+	if v, _ := c.DefaultHeaders.Get("X-Tenant"); v != "42" {
+		t.Errorf("wrong DefaultHeaders: %#v", c.DefaultHeaders)
+	}
+	if !c.Compress || c.Retry.Attempts != 3 || c.Retry.Backoff != 50*time.Millisecond ||
+		c.QueueStats().Max != 8 || c.BackendLimit != 4 || c.backendLimit("spamd2:783") != 2 {
+		t.Errorf("wrong client: %#v", c)
+	}
+	if b := c.Backends(); !reflect.DeepEqual(b, []string{"spamd1:783", "spamd2:783"}) {
+		t.Errorf("wrong Backends: %#v", b)
+	}
+	if c.route(Header{}.Set("User", "acct42")) != "shard1:783" {
+		t.Errorf("wrong Router: %#v", c.Router)
+	}
+
+	_, err = NewFromConfig(Config{Address: "spamd"})
+	if !test.ErrorContains(err, "invalid configuration") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	_, err = NewFromConfig(Config{DefaultHeaders: map[string]string{"Message-class": "eggs"}})
+	if !test.ErrorContains(err, "invalid configuration") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	_, err = NewFromConfig(Config{TLS: ConfigTLS{Enable: true, CA: "/nonexistent"}})
+	if !test.ErrorContains(err, "could not read CA") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	out, err := json.Marshal(struct{ D Duration }{Duration(90 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"D":"1m30s"}`; string(out) != want {
+		t.Errorf("\nout:  %s\nwant: %s\n", out, want)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build go1.16
+// +build go1.16
+
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CorpusResult is the result of a command for one file in RunCorpus().
+type CorpusResult struct {
+	// Response is the parsed response; the type depends on the command, for
+	// example *ResponseCheck for CHECK. See Exec().
+	Response interface{}
+
+	// Err is the error if the command failed.
+	Err error
+}
+
+// RunCorpus sends cmd for every .eml file in fsys, with at most concurrency
+// commands in progress at the same time. The returned map has the results by
+// path. For example with an embedded corpus:
+//
+//   //go:embed testdata/spam
+//   var spam embed.FS
+//
+//   results, err := c.RunCorpus(ctx, spam, "CHECK", 4)
+//
+// The command can be any command that has a parser; see RegisterParser(). The
+// error is only set if fsys couldn't be read; errors for individual messages
+// are in the results.
+func (c *Client) RunCorpus(
+	ctx context.Context,
+	fsys fs.FS,
+	cmd string,
+	concurrency int,
+) (map[string]CorpusResult, error) {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		sem     = make(chan struct{}, concurrency)
+		results = make(map[string]CorpusResult)
+	)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(path.Ext(p), ".eml") {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		msg, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			r, err := c.Exec(ctx, cmd, bytes.NewReader(msg), nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[p] = CorpusResult{Response: r, Err: err}
+		}()
+		return nil
+	})
+	wg.Wait()
+	if err != nil {
+		return results, errors.Wrap(err, "could not read corpus")
+	}
+	return results, nil
+}
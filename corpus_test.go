@@ -0,0 +1,62 @@
+//go:build go1.16
+// +build go1.16
+
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunCorpus(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		if strings.HasSuffix(req, "broken") {
+			return "SPAMD/1.1 76 EX_PROTOCOL\r\n\r\n"
+		}
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.0 / 5.0\r\n\r\n"
+	}})
+
+	fsys := fstest.MapFS{
+		"spam/1.eml":    {Data: []byte("Subject: one\r\n\r\nspam")},
+		"spam/2.EML":    {Data: []byte("Subject: two\r\n\r\nspam")},
+		"spam/3.eml":    {Data: []byte("broken")},
+		"spam/README":   {Data: []byte("not a message")},
+		"ham/empty.eml": {Data: []byte("")},
+	}
+
+	results, err := c.RunCorpus(context.Background(), fsys, "CHECK", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(map[string]string)
+	for p, r := range results {
+		if r.Err != nil {
+			out[p] = fmt.Sprintf("%v", ExitCode(r.Err, false))
+			continue
+		}
+		out[p] = fmt.Sprintf("%v", r.Response.(*ResponseCheck).Score)
+	}
+	want := map[string]string{
+		"spam/1.eml":    "6",
+		"spam/2.EML":    "6",
+		"spam/3.eml":    "76",
+		"ham/empty.eml": "6",
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := c.RunCorpus(ctx, fsys, "CHECK", 2)
+		if err == nil {
+			t.Error("error is nil")
+		}
+	})
+}
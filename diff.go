@@ -0,0 +1,102 @@
+package spamc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuleDiff is the difference of a single rule between two reports.
+type RuleDiff struct {
+	Rule        string
+	Description string
+	Old         float64 // Points in the old report; 0 if it's not present.
+	New         float64 // Points in the new report; 0 if it's not present.
+}
+
+// Delta is the change in points.
+func (d RuleDiff) Delta() float64 { return d.New - d.Old }
+
+// ReportDiff is the difference between two reports; see DiffReports().
+type ReportDiff struct {
+	Added   []RuleDiff // Rules that are only in the new report.
+	Removed []RuleDiff // Rules that are only in the old report.
+	Changed []RuleDiff // Rules that are in both reports with different points.
+}
+
+// DiffReports compares the reports from before and after a change; this is
+// useful to evaluate the effects of rule or SpamAssassin upgrades.
+//
+// Rules are listed in the order they appear in the reports.
+func DiffReports(before, after Report) ReportDiff {
+	var d ReportDiff
+	oldRules := reportRules(before)
+	newRules := reportRules(after)
+
+	for _, t := range before.Table {
+		n, ok := newRules[t.Rule]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, RuleDiff{
+				Rule: t.Rule, Description: t.Description, Old: t.Points,
+			})
+		case n.Points != t.Points:
+			d.Changed = append(d.Changed, RuleDiff{
+				Rule: t.Rule, Description: n.Description, Old: t.Points, New: n.Points,
+			})
+		}
+	}
+
+	for _, t := range after.Table {
+		if _, ok := oldRules[t.Rule]; !ok {
+			d.Added = append(d.Added, RuleDiff{
+				Rule: t.Rule, Description: t.Description, New: t.Points,
+			})
+			oldRules[t.Rule] = t
+		}
+	}
+
+	return d
+}
+
+// reportRules indexes the report table by rule name.
+func reportRules(r Report) map[string]ReportRow {
+	m := make(map[string]ReportRow, len(r.Table))
+	for _, t := range r.Table {
+		if _, ok := m[t.Rule]; !ok {
+			m[t.Rule] = t
+		}
+	}
+	return m
+}
+
+// Empty reports if there are no differences.
+func (d ReportDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// ScoreDelta is the total change in points of all rules.
+func (d ReportDiff) ScoreDelta() float64 {
+	var delta float64
+	for _, l := range [][]RuleDiff{d.Added, d.Removed, d.Changed} {
+		for _, r := range l {
+			delta += r.Delta()
+		}
+	}
+	return delta
+}
+
+// String formats the differences as a list with one rule per line, prefixed
+// with "+" for added, "-" for removed, and "~" for changed rules.
+func (d ReportDiff) String() string {
+	var b strings.Builder
+	for _, r := range d.Added {
+		fmt.Fprintf(&b, "+ %v %+.1f\n", r.Rule, r.New)
+	}
+	for _, r := range d.Removed {
+		fmt.Fprintf(&b, "- %v %+.1f\n", r.Rule, -r.Old)
+	}
+	for _, r := range d.Changed {
+		fmt.Fprintf(&b, "~ %v %.1f -> %.1f (%+.1f)\n", r.Rule, r.Old, r.New, r.Delta())
+	}
+	return b.String()
+}
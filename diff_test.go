@@ -0,0 +1,47 @@
+package spamc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/teamwork/test/diff"
+)
+
+func TestDiffReports(t *testing.T) {
+	before := Report{Table: []ReportRow{
+		{Points: 0.4, Rule: "INVALID_DATE", Description: "Invalid Date: header (not RFC 2822)"},
+		{Points: 1.2, Rule: "MISSING_HEADERS", Description: "Missing To: header"},
+		{Points: -0.0, Rule: "NO_RELAYS", Description: "Informational: message was not relayed via SMTP"},
+	}}
+	after := Report{Table: []ReportRow{
+		{Points: 2.0, Rule: "BAYES_99", Description: "Bayes spam probability is 99 to 100%"},
+		{Points: 1.5, Rule: "MISSING_HEADERS", Description: "Missing To: header"},
+		{Points: -0.0, Rule: "NO_RELAYS", Description: "Informational: message was not relayed via SMTP"},
+	}}
+
+	out := DiffReports(before, after)
+	want := ReportDiff{
+		Added:   []RuleDiff{{"BAYES_99", "Bayes spam probability is 99 to 100%", 0, 2.0}},
+		Removed: []RuleDiff{{"INVALID_DATE", "Invalid Date: header (not RFC 2822)", 0.4, 0}},
+		Changed: []RuleDiff{{"MISSING_HEADERS", "Missing To: header", 1.2, 1.5}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	if out.Empty() {
+		t.Error("Empty() is true")
+	}
+	if d := out.ScoreDelta(); d < 1.899 || d > 1.901 {
+		t.Errorf("wrong ScoreDelta: %v", d)
+	}
+
+	wantStr := "+ BAYES_99 +2.0\n- INVALID_DATE -0.4\n~ MISSING_HEADERS 1.2 -> 1.5 (+0.3)\n"
+	if d := diff.TextDiff(out.String(), wantStr); d != "" {
+		t.Errorf("String() wrong\n%v", d)
+	}
+
+	if !DiffReports(before, before).Empty() {
+		t.Error("diff with itself not empty")
+	}
+}
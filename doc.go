@@ -6,11 +6,16 @@
 // of Headers (which can be nil).
 //
 // The Content-length header is mandatory. If the passed io.Reader is an
-// strings.Reader, bytes.Reader, or os.File if will be added automatically. For
-// other types you'll have to add it yourself:
+// strings.Reader, bytes.Reader, io.SectionReader, or os.File if will be added
+// automatically. For other types you'll have to add it yourself:
 //
 //   conn.Check(ctx, msg, Header{}.Set("Content-length", size))
 //
+// Messages stored in a larger file (such as a spool file) can be sent without
+// copying them with an io.SectionReader:
+//
+//   conn.Check(ctx, io.NewSectionReader(spool, offset, length), nil)
+//
 // It is *strongly* recommended that the Header.Set function is used instead of
 // directly setting the map. This ensures that the correct capitalisation is
 // used; using the Content-Length header is a fatal error ("l" in length needs
@@ -0,0 +1,111 @@
+package spamc
+
+import (
+	"crypto/tls"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAddress is the address of spamd if none is given.
+const DefaultAddress = "127.0.0.1:783"
+
+// FromEnv creates a new Client configured from environment variables:
+//
+//   SPAMC_ADDRESS           Address of spamd; defaults to DefaultAddress.
+//   SPAMC_TIMEOUT           Timeout, as a duration ("5s") or in seconds.
+//   SPAMC_USER              DefaultUser.
+//   SPAMC_TLS               Enable TLS.
+//   SPAMC_TLS_CA            File with PEM-encoded CA certificates.
+//   SPAMC_TLS_CERT          File with a PEM-encoded client certificate.
+//   SPAMC_TLS_KEY           File with the key for SPAMC_TLS_CERT.
+//   SPAMC_TLS_SERVER_NAME   Server name to verify the certificate against.
+//   SPAMC_TLS_INSECURE      Don't verify the server's certificate.
+//
+// TLS is enabled if any of the SPAMC_TLS_* variables are set. The opts are
+// applied after the configuration from the environment.
+func FromEnv(opts ...Option) (*Client, error) {
+	return fromEnv(os.LookupEnv, opts...)
+}
+
+func fromEnv(
+	lookup func(string) (string, bool),
+	opts ...Option,
+) (*Client, error) {
+
+	get := func(k string) string {
+		v, _ := lookup(k)
+		return strings.TrimSpace(v)
+	}
+
+	var envOpts []Option
+	if v := get("SPAMC_TIMEOUT"); v != "" {
+		d, err := parseTimeout(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "SPAMC_TIMEOUT")
+		}
+		envOpts = append(envOpts, WithTimeout(d))
+	}
+	if v := get("SPAMC_USER"); v != "" {
+		envOpts = append(envOpts, WithDefaultUser(v))
+	}
+
+	cfg, err := tlsFromEnv(get)
+	if err != nil {
+		return nil, err
+	}
+	if cfg != nil {
+		envOpts = append(envOpts, WithTLS(cfg))
+	}
+
+	addr := get("SPAMC_ADDRESS")
+	if addr == "" {
+		addr = DefaultAddress
+	}
+	return New(addr, nil, append(envOpts, opts...)...), nil
+}
+
+// parseTimeout parses a duration, or a number of seconds.
+func parseTimeout(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// tlsFromEnv creates the TLS configuration from the SPAMC_TLS_* variables; it
+// returns nil if none of them are set.
+func tlsFromEnv(get func(string) string) (*tls.Config, error) {
+	enable, insecure := get("SPAMC_TLS"), get("SPAMC_TLS_INSECURE")
+	cfg := ConfigTLS{
+		CA:         get("SPAMC_TLS_CA"),
+		Cert:       get("SPAMC_TLS_CERT"),
+		Key:        get("SPAMC_TLS_KEY"),
+		ServerName: get("SPAMC_TLS_SERVER_NAME"),
+	}
+	if enable+insecure+cfg.CA+cfg.Cert+cfg.Key+cfg.ServerName == "" {
+		return nil, nil
+	}
+
+	cfg.Enable = true
+	if enable != "" {
+		on, err := strconv.ParseBool(enable)
+		if err != nil {
+			return nil, errors.Wrap(err, "SPAMC_TLS")
+		}
+		cfg.Enable = on
+	}
+	if insecure != "" {
+		skip, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, errors.Wrap(err, "SPAMC_TLS_INSECURE")
+		}
+		cfg.Insecure = skip
+	}
+
+	tcfg, err := cfg.config()
+	return tcfg, errors.Wrap(err, "SPAMC_TLS")
+}
@@ -0,0 +1,101 @@
+package spamc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func TestFromEnv(t *testing.T) {
+	cases := []struct {
+		in       map[string]string
+		wantAddr string
+		wantUser string
+		wantTime time.Duration
+		wantTLS  bool
+		wantErr  string
+	}{
+		{map[string]string{}, DefaultAddress, "", 0, false, ""},
+		{map[string]string{
+			"SPAMC_ADDRESS": "spamd:783",
+			"SPAMC_USER":    "acct42",
+			"SPAMC_TIMEOUT": "5",
+		}, "spamd:783", "acct42", 5 * time.Second, false, ""},
+		{map[string]string{"SPAMC_TIMEOUT": "1m"}, DefaultAddress, "", time.Minute, false, ""},
+		{map[string]string{"SPAMC_TLS": "1"}, DefaultAddress, "", 0, true, ""},
+		{map[string]string{"SPAMC_TLS": "0"}, DefaultAddress, "", 0, false, ""},
+		{map[string]string{"SPAMC_TLS_INSECURE": "true"}, DefaultAddress, "", 0, true, ""},
+
+		{map[string]string{"SPAMC_TIMEOUT": "soon"}, "", "", 0, false, "SPAMC_TIMEOUT"},
+		{map[string]string{"SPAMC_TLS": "maybe"}, "", "", 0, false, "SPAMC_TLS"},
+		{map[string]string{"SPAMC_TLS_CA": "/nonexistent"}, "", "", 0, false, "could not read CA"},
+		{map[string]string{"SPAMC_TLS_CERT": "/nonexistent"}, "", "", 0, false, "could not load certificate"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			c, err := fromEnv(func(k string) (string, bool) {
+				v, ok := tc.in[k]
+				return v, ok
+			})
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			if c.addr != tc.wantAddr || c.DefaultUser != tc.wantUser ||
+				c.Timeout != tc.wantTime || (c.TLSConfig != nil) != tc.wantTLS {
+				t.Errorf("wrong client: %#v", c)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	out := tlsConfig(&tls.Config{}, "spamd.example.com:783")
+	if out.ServerName != "spamd.example.com" {
+		t.Errorf("wrong ServerName: %q", out.ServerName)
+	}
+
+	in := &tls.Config{ServerName: "other"}
+	if out := tlsConfig(in, "spamd.example.com:783"); out != in {
+		t.Errorf("config modified: %#v", out)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	// Borrow the certificate from httptest.
+	srv := httptest.NewTLSServer(nil)
+	srv.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer l.Close() // nolint: errcheck
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()                         // nolint: errcheck
+		bufio.NewReader(conn).ReadString('\n')     // nolint: errcheck
+		conn.Write([]byte("SPAMD/1.5 0 PONG\r\n")) // nolint: errcheck
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	c := New(l.Addr().String(), nil, WithTLS(&tls.Config{RootCAs: pool}))
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
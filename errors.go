@@ -0,0 +1,178 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// OpError is returned if talking to spamd failed.
+type OpError struct {
+	// Op is the operation that failed: "dial", "write", or "read".
+	Op string
+
+	// Addr is the address of the spamd backend; this may be empty.
+	Addr string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *OpError) Error() string {
+	if e.Addr == "" {
+		return fmt.Sprintf("%v: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%v %v: %v", e.Op, e.Addr, e.Err)
+}
+
+// Timeout reports if the operation timed out.
+func (e *OpError) Timeout() bool {
+	if e.Err == context.DeadlineExceeded {
+		return true
+	}
+	t, ok := e.Err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error { return e.Err }
+
+// TimeoutError is the underlying error of an OpError if the deadline was
+// exceeded. It matches context.DeadlineExceeded with errors.Is(), so callers
+// can handle timeouts from spamd and from the context in the same way.
+type TimeoutError struct {
+	// Op is the operation that timed out: "dial", "write", or "read".
+	Op string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout during %v: %v", e.Op, e.Err)
+}
+
+// Timeout always returns true.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// Temporary always returns true.
+func (e *TimeoutError) Temporary() bool { return true }
+
+// Is reports if target is context.DeadlineExceeded.
+func (e *TimeoutError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+// Unwrap returns the underlying error.
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// newOpError creates a new OpError; timeouts are wrapped in a TimeoutError.
+func newOpError(op, addr string, err error) *OpError {
+	if t, ok := err.(interface{ Timeout() bool }); (ok && t.Timeout()) || err == context.DeadlineExceeded {
+		err = &TimeoutError{Op: op, Err: err}
+	}
+	return &OpError{Op: op, Addr: addr, Err: err}
+}
+
+// ProtocolError is returned if spamd's response couldn't be parsed.
+type ProtocolError struct {
+	msg string
+}
+
+func (e *ProtocolError) Error() string { return e.msg }
+
+func protocolErrorf(format string, args ...interface{}) error {
+	return &ProtocolError{msg: fmt.Sprintf(format, args...)}
+}
+
+// ContentLengthError is returned if the Content-length header doesn't match
+// the size of the message.
+type ContentLengthError struct {
+	// Header is the size from the Content-length header.
+	Header int64
+
+	// Actual is the size of the message. This is -1 if the message was
+	// streamed and was longer than Header, as the rest isn't read.
+	Actual int64
+}
+
+func (e *ContentLengthError) Error() string {
+	if e.Actual < 0 {
+		return fmt.Sprintf("message is longer than the Content-length of %d bytes", e.Header)
+	}
+	return fmt.Sprintf("message is %d bytes, but Content-length is %d bytes", e.Actual, e.Header)
+}
+
+// IsConnectionError reports if err is caused by a failure to connect to,
+// write to, or read from spamd.
+func IsConnectionError(err error) bool {
+	cause := errors.Cause(err)
+	if cause == context.DeadlineExceeded { // Implements net.Error.
+		return false
+	}
+	switch cause.(type) {
+	case *OpError, net.Error:
+		return true
+	}
+	return false
+}
+
+// IsProtocolError reports if err is caused by spamd returning an error code
+// or a response that couldn't be parsed.
+func IsProtocolError(err error) bool {
+	switch errors.Cause(err).(type) {
+	case Error, *ProtocolError:
+		return true
+	}
+	return false
+}
+
+// IsUnavailable reports if err is caused by spamd being unavailable: the
+// connection to spamd failed, or spamd returned EX_UNAVAILABLE.
+func IsUnavailable(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case Error:
+		return cause.Code == ExUnavailable
+	case *OpError:
+		return cause.Op == "dial" && !isCanceled(cause)
+	}
+	return false
+}
+
+// IsTemporary reports if err is a temporary failure, in which case the command
+// can be retried later or on a different backend.
+//
+// Connection errors, timeouts (including ErrQueueTimeout), and the
+// EX_TEMPFAIL, EX_UNAVAILABLE, and EX_TIMEOUT codes from spamd are temporary.
+// Protocol errors, other codes, and canceled contexts are not.
+func IsTemporary(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case Error:
+		switch cause.Code {
+		case ExTempFail, ExUnavailable, ExTimeout:
+			return true
+		}
+		return false
+	case *OpError:
+		return !isCanceled(cause)
+	case net.Error:
+		return cause.Timeout() || cause.Temporary()
+	}
+
+	switch errors.Cause(err) {
+	case context.DeadlineExceeded, ErrQueueTimeout:
+		return true
+	}
+	return false
+}
+
+// isCanceled reports if err is caused by a canceled context. The errors of
+// dialers from the net package match context.Canceled if the dial was
+// canceled; timeouts never are.
+func isCanceled(err error) bool {
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return false
+	}
+	return errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,127 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestErrorHelpers(t *testing.T) {
+	cases := []struct {
+		in                                     error
+		wantConn, wantProto, wantTemp, wantUna bool
+	}{
+		{errors.New("oh noes"), false, false, false, false},
+		{Error{Code: ExTempFail}, false, true, true, false},
+		{Error{Code: ExUnavailable}, false, true, true, true},
+		{errors.Wrap(Error{Code: ExNoUser}, "wrapped"), false, true, false, false},
+		{protocolErrorf("short response"), false, true, false, false},
+		{errors.Wrap(&OpError{Op: "dial", Err: errors.New("connection refused")}, "x"), true, false, true, true},
+		{&OpError{Op: "dial", Err: context.Canceled}, true, false, false, false},
+		{&OpError{Op: "read", Err: context.Canceled}, true, false, false, false},
+		{&OpError{Op: "dial", Err: canceledDial()}, true, false, false, false},
+		{&OpError{Op: "dial", Err: &net.OpError{Op: "dial", Err: errors.New("operation was canceled")}}, true, false, true, true},
+		{&OpError{Op: "read", Err: errors.New("connection reset")}, true, false, true, false},
+		{&net.OpError{Op: "read", Err: timeoutErr{}}, true, false, true, false},
+		{errors.Wrap(context.DeadlineExceeded, "wrapped"), false, false, true, false},
+		{context.Canceled, false, false, false, false},
+		{errors.Wrap(ErrQueueTimeout, "x"), false, false, true, false},
+		{ErrQueueFull, false, false, false, false},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := []bool{IsConnectionError(tc.in), IsProtocolError(tc.in), IsTemporary(tc.in), IsUnavailable(tc.in)}
+			want := []bool{tc.wantConn, tc.wantProto, tc.wantTemp, tc.wantUna}
+			if fmt.Sprint(out) != fmt.Sprint(want) {
+				t.Errorf("\nout:  %v\nwant: %v\n", out, want)
+			}
+		})
+	}
+}
+
+// canceledDial returns the error of a net.Dialer with a canceled context.
+func canceledDial() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := (&net.Dialer{}).DialContext(ctx, "tcp", "127.0.0.1:783")
+	return err
+}
+
+func TestCanceledDial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := New("127.0.0.1:783", &net.Dialer{}).Check(ctx, strings.NewReader("A message"), nil)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if IsTemporary(err) || IsUnavailable(err) {
+		t.Errorf("canceled dial is temporary or unavailable: %v", err)
+	}
+}
+
+func TestErrorOps(t *testing.T) {
+	t.Run("dial", func(t *testing.T) {
+		c := New("spamd:783", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		}))
+		err := c.Ping(context.Background())
+		if op, ok := errors.Cause(err).(*OpError); !ok || op.Op != "dial" || op.Addr != "spamd:783" {
+			t.Errorf("wrong error: %#v", errors.Cause(err))
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		client, server := net.Pipe()
+		server.Close() // nolint: errcheck
+		c := New("spamd:783", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+			return client, nil
+		}))
+		_, err := c.Check(context.Background(), strings.NewReader(""), nil)
+		if !IsConnectionError(err) {
+			t.Errorf("wrong error: %#v", errors.Cause(err))
+		}
+	})
+
+	t.Run("protocol", func(t *testing.T) {
+		_, err := newClient("HTTP/1.1 200 OK\r\n\r\n").
+			Check(context.Background(), strings.NewReader("A message"), nil)
+		if !IsProtocolError(err) || ExitCode(err, false) != ExProtocol {
+			t.Errorf("wrong error: %#v", errors.Cause(err))
+		}
+	})
+}
+
+func TestTimeoutError(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close() // nolint: errcheck
+	go func() {
+		b := make([]byte, 512)
+		for {
+			if _, err := server.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := New("spamd:783", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+		return client, nil
+	}), WithTimeout(20*time.Millisecond))
+	_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("not DeadlineExceeded: %v", err)
+	}
+	var terr *TimeoutError
+	if !errors.As(err, &terr) || terr.Op != "read" {
+		t.Errorf("wrong error: %#v", terr)
+	}
+	if ExitCode(err, false) != ExTimeout || !IsTemporary(err) {
+		t.Errorf("wrong classification: %v", err)
+	}
+}
@@ -27,8 +27,8 @@ func Example() {
 
 	// Report ham for training.
 	tell, err := c.Tell(ctx, msg, Header{}.
-		Set("Message-class", "ham").
-		Set("Set", "local"))
+		Set(HeaderMessageClass, MessageClassHam).
+		Set(HeaderSet, TellLocal))
 	if err != nil {
 		log.Fatal(err)
 	}
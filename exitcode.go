@@ -0,0 +1,64 @@
+package spamc
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ExitCode maps the result of a command to the exit code the spamc C client
+// would use, so that wrappers can behave identically in shell scripts.
+//
+// If err is nil this will return ExIsSpam if isSpam is true, or ExOK if it's
+// false. Errors from spamd return spamd's exit code, and other errors are
+// mapped to the closest EX_* code.
+func ExitCode(err error, isSpam bool) int {
+	if err == nil {
+		if isSpam {
+			return ExIsSpam
+		}
+		return ExOK
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case Error:
+		return int(cause.Code)
+	case *ProtocolError:
+		return ExProtocol
+	case *ContentLengthError:
+		return ExDataErr
+	case *OpError:
+		if code := ExitCode(cause.Err, false); code != ExSoftware {
+			return code
+		}
+		if cause.Op == "dial" {
+			return ExUnavailable
+		}
+		return ExIOErr
+	case *net.DNSError:
+		return ExNoHost
+	case *net.OpError:
+		if cause.Timeout() {
+			return ExTimeout
+		}
+		if cause.Op == "dial" {
+			return ExUnavailable
+		}
+		return ExIOErr
+	case net.Error:
+		if cause.Timeout() {
+			return ExTimeout
+		}
+		return ExIOErr
+	}
+
+	switch errors.Cause(err) {
+	case context.DeadlineExceeded, ErrQueueTimeout:
+		return ExTimeout
+	case context.Canceled, ErrQueueFull, ErrBackendsFull:
+		return ExTempFail
+	}
+
+	return ExSoftware
+}
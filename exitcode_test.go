@@ -0,0 +1,62 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		inErr    error
+		inIsSpam bool
+		want     int
+	}{
+		{nil, false, ExOK},
+		{nil, true, ExIsSpam},
+		{Error{Code: 69}, false, ExUnavailable},
+		{errors.Wrap(Error{Code: 75}, "wrapped"), true, ExTempFail},
+		{errors.Wrap(&net.DNSError{Err: "no such host"}, "wrapped"), false, ExNoHost},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, false, ExUnavailable},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset")}, false, ExIOErr},
+		{&net.OpError{Op: "read", Err: timeoutErr{}}, false, ExTimeout},
+		{errors.Wrap(timeoutErr{}, "wrapped"), false, ExTimeout},
+		{errors.Wrap(&OpError{Op: "dial", Err: errors.New("connection refused")}, "wrapped"), false, ExUnavailable},
+		{&OpError{Op: "read", Err: &net.OpError{Op: "read", Err: timeoutErr{}}}, false, ExTimeout},
+		{&OpError{Op: "write", Err: errors.New("broken pipe")}, false, ExIOErr},
+		{protocolErrorf("short response"), false, ExProtocol},
+		{&ContentLengthError{Header: 3, Actual: 7}, false, ExDataErr},
+		{errors.Wrap(context.DeadlineExceeded, "wrapped"), false, ExTimeout},
+		{context.Canceled, false, ExTempFail},
+		{errors.Wrap(ErrQueueFull, "x"), false, ExTempFail},
+		{errors.Wrap(ErrQueueTimeout, "x"), false, ExTimeout},
+		{errors.New("oh noes"), false, ExSoftware},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := ExitCode(tc.inErr, tc.inIsSpam)
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeFromSpamd(t *testing.T) {
+	_, err := newClient("SPAMD/1.1 67 EX_NOUSER\r\n\r\n").
+		Check(context.Background(), strings.NewReader("A message"), nil)
+	if out := ExitCode(err, false); out != ExNoUser {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, ExNoUser)
+	}
+}
@@ -0,0 +1,77 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// FallbackFunc returns a verdict for a message if spamd is unavailable; see
+// Client.OnUnavailable.
+type FallbackFunc func(ctx context.Context, msg io.Reader) (Verdict, error)
+
+// WithOnUnavailable sets the OnUnavailable fallback.
+func WithOnUnavailable(f FallbackFunc) Option {
+	return func(c *Client) { c.OnUnavailable = f }
+}
+
+// FailOpen is a FallbackFunc which accepts every message, with a score of 0.
+func FailOpen(ctx context.Context, msg io.Reader) (Verdict, error) {
+	return Verdict{}, nil
+}
+
+// fallback returns the verdict from the OnUnavailable fallback for a command
+// that failed with err.
+func (c *Client) fallback(
+	ctx context.Context,
+	cmd, user string,
+	msg []byte,
+	err error,
+) (Verdict, error) {
+
+	c.log().Warn("spamd is unavailable; using fallback verdict", "cmd", cmd, "error", err)
+	v, err := c.OnUnavailable(ctx, bytes.NewReader(msg))
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	v.Degraded = true
+	if v.Time.IsZero() {
+		v.Time = time.Now()
+	}
+	if v.Command == "" {
+		v.Command = cmd
+	}
+	if v.User == "" {
+		v.User = user
+	}
+	if v.Metadata == nil {
+		v.Metadata = MetadataFromContext(ctx)
+	}
+	c.emitVerdict(ctx, v)
+	return v, nil
+}
+
+// hasFallback reports if the OnUnavailable fallback is used for cmd.
+func (c *Client) hasFallback(cmd string) bool {
+	return c.OnUnavailable != nil && fallbackResponse(cmd, Verdict{}) != nil
+}
+
+// fallbackResponse returns the response to cmd for the fallback verdict v,
+// or nil if there is no response to cmd without spamd; PROCESS and HEADERS
+// return the message as modified by spamd, and custom commands can't be
+// converted.
+func fallbackResponse(cmd string, v Verdict) interface{} {
+	score := ResponseScore{IsSpam: v.IsSpam, Score: v.Score, BaseScore: v.BaseScore}
+	switch strings.ToUpper(cmd) {
+	case cmdCheck:
+		return &ResponseCheck{ResponseScore: score}
+	case cmdSymbols:
+		return &ResponseSymbols{ResponseScore: score, Symbols: v.Symbols}
+	case cmdReport, cmdReportIfspam:
+		return &ResponseReport{ResponseScore: score}
+	}
+	return nil
+}
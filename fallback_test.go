@@ -0,0 +1,152 @@
+package spamc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestOnUnavailable(t *testing.T) {
+	down := dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	t.Run("no fallback", func(t *testing.T) {
+		c := New("spamd:783", down)
+		_, err := c.Scan(context.Background(), []byte("A message"), nil)
+		if !IsUnavailable(err) {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("fail open", func(t *testing.T) {
+		var sunk []Verdict
+		c := New("spamd:783", down, WithOnUnavailable(FailOpen),
+			WithVerdictSink(VerdictSinkFunc(func(ctx context.Context, v Verdict) error {
+				sunk = append(sunk, v)
+				return nil
+			})))
+
+		v, err := c.Scan(context.Background(), []byte("A message"), Metadata{MetadataUser: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(v.Time) > time.Minute {
+			t.Errorf("wrong time: %v", v.Time)
+		}
+		v.Time = time.Time{}
+		want := Verdict{Command: "SYMBOLS", User: "a", Metadata: Metadata{"user": "a"}, Degraded: true}
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", v, want)
+		}
+		if len(sunk) != 1 || !sunk[0].Degraded {
+			t.Errorf("wrong verdicts in sink: %#v", sunk)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		c := New("spamd:783", down, WithDefaultUser("default"),
+			WithOnUnavailable(func(ctx context.Context, msg io.Reader) (Verdict, error) {
+				b, _ := ioutil.ReadAll(msg)
+				if string(b) != "A message" {
+					t.Errorf("wrong message: %q", b)
+				}
+				return Verdict{IsSpam: true, Score: 10}, nil
+			}))
+
+		v, err := c.Scan(context.Background(), []byte("A message"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.IsSpam || v.Score != 10 || !v.Degraded || v.User != "default" {
+			t.Errorf("wrong verdict: %#v", v)
+		}
+	})
+
+	t.Run("fail closed", func(t *testing.T) {
+		closed := errors.New("rejecting messages while spamd is down")
+		c := New("spamd:783", down,
+			WithOnUnavailable(func(ctx context.Context, msg io.Reader) (Verdict, error) {
+				return Verdict{}, closed
+			}))
+
+		_, err := c.Scan(context.Background(), []byte("A message"), nil)
+		if err != closed {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("commands", func(t *testing.T) {
+		var sunk []Verdict
+		c := New("spamd:783", down, WithDefaultUser("default"),
+			WithOnUnavailable(func(ctx context.Context, msg io.Reader) (Verdict, error) {
+				b, _ := ioutil.ReadAll(msg)
+				if string(b) != "A message" {
+					t.Errorf("wrong message: %q", b)
+				}
+				return Verdict{IsSpam: true, Score: 10, BaseScore: 5, Symbols: SymbolSet{"A"}}, nil
+			}),
+			WithVerdictSink(VerdictSinkFunc(func(ctx context.Context, v Verdict) error {
+				sunk = append(sunk, v)
+				return nil
+			})))
+		ctx := context.Background()
+		want := ResponseScore{IsSpam: true, Score: 10, BaseScore: 5}
+
+		check, err := c.Check(ctx, strings.NewReader("A message"), Header{}.Set("User", "a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if check.ResponseScore != want {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", check.ResponseScore, want)
+		}
+
+		sym, err := c.Symbols(ctx, strings.NewReader("A message"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sym.ResponseScore != want || !reflect.DeepEqual(sym.Symbols, SymbolSet{"A"}) {
+			t.Errorf("wrong response: %#v", sym)
+		}
+
+		rep, err := c.Report(ctx, strings.NewReader("A message"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rep.ResponseScore != want {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", rep.ResponseScore, want)
+		}
+
+		if len(sunk) != 3 {
+			t.Fatalf("wrong verdicts in sink: %#v", sunk)
+		}
+		for i, v := range sunk {
+			wantCmd := []string{"CHECK", "SYMBOLS", "REPORT"}[i]
+			wantUser := []string{"a", "default", "default"}[i]
+			if !v.Degraded || v.Command != wantCmd || v.User != wantUser {
+				t.Errorf("wrong verdict %d: %#v", i, v)
+			}
+		}
+
+		_, err = c.Process(ctx, strings.NewReader("A message"), nil)
+		if !IsUnavailable(err) {
+			t.Errorf("wrong error for PROCESS: %v", err)
+		}
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		c := New("", replyDialer{func(string) string { return "SPAMD/1.1 76 EX_PROTOCOL\r\n\r\n" }},
+			WithOnUnavailable(FailOpen))
+		_, err := c.Scan(context.Background(), []byte("A message"), nil)
+		if ExitCode(err, false) != ExProtocol {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// CheckFile is like Check(), but reads the message from the file at path. The
+// file is opened, sized, and closed by this method, so the Content-length is
+// always correct.
+func (c *Client) CheckFile(ctx context.Context, path string, hdr Header) (*ResponseCheck, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open message")
+	}
+	defer fp.Close() // nolint: errcheck
+	return c.Check(ctx, fp, hdr)
+}
+
+// CheckBytes is like Check(), but reads the message from msg.
+func (c *Client) CheckBytes(ctx context.Context, msg []byte, hdr Header) (*ResponseCheck, error) {
+	return c.Check(ctx, bytes.NewReader(msg), hdr)
+}
+
+// SymbolsFile is like Symbols(), but reads the message from the file at path.
+func (c *Client) SymbolsFile(ctx context.Context, path string, hdr Header) (*ResponseSymbols, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open message")
+	}
+	defer fp.Close() // nolint: errcheck
+	return c.Symbols(ctx, fp, hdr)
+}
+
+// SymbolsBytes is like Symbols(), but reads the message from msg.
+func (c *Client) SymbolsBytes(ctx context.Context, msg []byte, hdr Header) (*ResponseSymbols, error) {
+	return c.Symbols(ctx, bytes.NewReader(msg), hdr)
+}
+
+// ReportFile is like Report(), but reads the message from the file at path.
+func (c *Client) ReportFile(ctx context.Context, path string, hdr Header) (*ResponseReport, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open message")
+	}
+	defer fp.Close() // nolint: errcheck
+	return c.Report(ctx, fp, hdr)
+}
+
+// ReportBytes is like Report(), but reads the message from msg.
+func (c *Client) ReportBytes(ctx context.Context, msg []byte, hdr Header) (*ResponseReport, error) {
+	return c.Report(ctx, bytes.NewReader(msg), hdr)
+}
+
+// ProcessFile is like Process(), but reads the message from the file at path.
+//
+// Do not forget to close the Message reader!
+func (c *Client) ProcessFile(ctx context.Context, path string, hdr Header) (*ResponseProcess, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open message")
+	}
+	defer fp.Close() // nolint: errcheck
+	return c.Process(ctx, fp, hdr)
+}
+
+// ProcessBytes is like Process(), but reads the message from msg.
+//
+// Do not forget to close the Message reader!
+func (c *Client) ProcessBytes(ctx context.Context, msg []byte, hdr Header) (*ResponseProcess, error) {
+	return c.Process(ctx, bytes.NewReader(msg), hdr)
+}
@@ -0,0 +1,54 @@
+package spamc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spamc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "msg.eml")
+	if err := ioutil.WriteFile(path, []byte("Subject: x\r\n\r\nA message"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	const resp = "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	want := "Content-length: 23\r\n\r\nSubject: x\r\n\r\nA message"
+
+	t.Run("file", func(t *testing.T) {
+		c := newClient(resp)
+		if _, err := c.CheckFile(context.Background(), path, nil); err != nil {
+			t.Fatal(err)
+		}
+		if out := c.dialer.(*testDialer).conn.Written.String(); !strings.HasSuffix(out, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		c := newClient(resp)
+		if _, err := c.CheckBytes(context.Background(), []byte("Subject: x\r\n\r\nA message"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if out := c.dialer.(*testDialer).conn.Written.String(); !strings.HasSuffix(out, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := newClient(resp).ProcessFile(context.Background(), filepath.Join(dir, "nope"), nil)
+		if !test.ErrorContains(err, "could not open message") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
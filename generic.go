@@ -0,0 +1,82 @@
+//go:build go1.18
+// +build go1.18
+
+package spamc
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ResponseParser is implemented by response types for Do().
+//
+// It's implemented by ResponseCheck, ResponseSymbols, ResponseReport,
+// ResponseFull, and ResponseTell, so those can be used with Do() as well.
+// ResponseProcess isn't, as its Message is read after the command returns.
+type ResponseParser interface {
+	// ParseResponse parses the response; the connection is closed once this
+	// returns, so the body must be read before returning.
+	ParseResponse(r RawResponse) error
+}
+
+var (
+	_ ResponseParser = &ResponseCheck{}
+	_ ResponseParser = &ResponseSymbols{}
+	_ ResponseParser = &ResponseReport{}
+	_ ResponseParser = &ResponseFull{}
+	_ ResponseParser = &ResponseTell{}
+)
+
+// Do sends cmd to spamd and parses the response as a T. This allows using
+// commands that aren't supported by this package, for example extension
+// commands of spamd-compatible servers:
+//
+//   type ResponseScan struct{ Verdict string }
+//
+//   func (r *ResponseScan) ParseResponse(raw spamc.RawResponse) error {
+//       r.Verdict, _ = raw.Header.Get("Verdict")
+//       return nil
+//   }
+//
+//   r, err := spamc.Do[ResponseScan](ctx, c, "SCAN", msg, nil)
+//
+// The built-in response types can be used as well, for example
+// Do[spamc.ResponseSymbols](ctx, c, "SYMBOLS", msg, nil).
+//
+// The request is sent the same as for the built-in commands: the
+// Content-length, User, and default headers are added. Parse warnings and the
+// verdict hooks are handled as they are for Exec().
+func Do[T any, PT interface {
+	*T
+	ResponseParser
+}](
+	ctx context.Context,
+	c *Client,
+	cmd string,
+	msg io.Reader,
+	hdr Header,
+) (*T, error) {
+
+	read, respHeaders, tp, err := c.do(ctx, &Request{Command: cmd, Message: msg, Headers: hdr})
+	if err != nil {
+		return nil, err
+	}
+	defer read.Close() // nolint: errcheck
+
+	r := PT(new(T))
+	err = r.ParseResponse(RawResponse{
+		Header: respHeaders,
+		Body:   tp.R,
+		Wire:   read.wire,
+		client: c,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse %v response", cmd)
+	}
+	if err := c.parsed(ctx, cmd, read.user, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
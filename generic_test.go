@@ -0,0 +1,100 @@
+//go:build go1.18
+// +build go1.18
+
+package spamc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+type responseScan struct {
+	Verdict string
+	Body    string
+}
+
+func (r *responseScan) ParseResponse(raw RawResponse) error {
+	var ok bool
+	r.Verdict, ok = raw.Header.Get("Verdict")
+	if !ok {
+		return errors.New("no Verdict header")
+	}
+	b, err := ioutil.ReadAll(raw.Body)
+	r.Body = string(b)
+	return err
+}
+
+func TestDo(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    *responseScan
+		wantErr string
+	}{
+		{
+			"SPAMD/1.1 0 EX_OK\r\nVerdict: reject\r\nContent-length: 4\r\n\r\nBody",
+			&responseScan{Verdict: "reject", Body: "Body"},
+			"",
+		},
+		{
+			"SPAMD/1.1 0 EX_OK\r\n\r\n",
+			nil,
+			"could not parse SCAN response: no Verdict header",
+		},
+		{
+			"SPAMD/1.1 76 EX_PROTOCOL\r\n\r\n",
+			nil,
+			"EX_PROTOCOL",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out, err := Do[responseScan](context.Background(), newClient(tc.in),
+				"SCAN", strings.NewReader("A message"), nil)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestDoBuiltin(t *testing.T) {
+	var verdicts []Verdict
+	c := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.5 / 5.0\r\nContent-length: 14\r\n\r\nBAYES_99,GTUBE")
+	WithOnVerdict(func(ctx context.Context, v Verdict) { verdicts = append(verdicts, v) })(c)
+
+	out, err := Do[ResponseSymbols](context.Background(), c, "SYMBOLS", strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ResponseSymbols{
+		ResponseScore:  ResponseScore{IsSpam: true, Score: 6.5, BaseScore: 5},
+		Symbols:        SymbolSet{"BAYES_99", "GTUBE"},
+		ResponseHeader: Header{"Spam": "True ; 6.5 / 5.0", "Content-length": "14"},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+	if len(verdicts) != 1 || verdicts[0].Command != "SYMBOLS" || !reflect.DeepEqual(verdicts[0].Symbols, want.Symbols) {
+		t.Errorf("wrong verdicts: %#v", verdicts)
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		c := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.5\r\n\r\n")
+		WithParseMode(ParseStrict)(c)
+		_, err := Do[ResponseCheck](context.Background(), c, "CHECK", strings.NewReader("A message"), nil)
+		if !test.ErrorContains(err, "could not parse response to CHECK") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
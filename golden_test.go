@@ -0,0 +1,56 @@
+package spamc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/spamc/spamdtest"
+)
+
+func TestGoldenResponses(t *testing.T) {
+	for _, g := range spamdtest.Corpus() {
+		t.Run(g.Name, func(t *testing.T) {
+			c := New("", replyDialer{func(req string) string { return g.Response }},
+				WithParseMode(ParseStrict))
+			ctx := context.Background()
+
+			if g.Command == cmdPing {
+				if err := c.Ping(ctx); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			hdr := Header{}
+			if g.Command == cmdTell {
+				hdr.Set(HeaderMessageClass, MessageClassSpam).Set(HeaderSet, TellLocal)
+			}
+			r, err := c.Exec(ctx, g.Command, strings.NewReader("Subject: test\r\n\r\nbody\r\n"), hdr)
+			if g.Err {
+				if err == nil {
+					t.Fatalf("no error; response: %#v", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var symbols SymbolSet
+			switch r := r.(type) {
+			case *ResponseSymbols:
+				symbols = r.Symbols
+			case *ResponseReport:
+				symbols = r.Report.Symbols()
+				if s := r.Report.String(); len(r.Report.Table) > 0 && !strings.Contains(
+					strings.Replace(g.Response, "\r\n", "\n", -1), s[strings.Index(s, " pts rule name"):]) {
+					t.Errorf("String() doesn't reproduce the table:\n%v", s)
+				}
+			}
+			if len(symbols) != len(g.Symbols) || (len(g.Symbols) > 0 && !symbols.All(g.Symbols...)) {
+				t.Errorf("wrong symbols\nout:  %#v\nwant: %#v\n", symbols, g.Symbols)
+			}
+		})
+	}
+}
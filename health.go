@@ -0,0 +1,184 @@
+package spamc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BackendStatus is the health status of a spamd backend.
+//
+// The Client doesn't have a circuit breaker: backends are never taken out of
+// rotation because they fail, and there is no cool-down state. The only
+// backends that are skipped are those that are Drained or Saturated. A
+// Balancer can avoid failing backends with Backend.Failing.
+type BackendStatus struct {
+	Addr string
+
+	// Reachable reports if the last connection to the backend succeeded.
+	Reachable bool
+
+	// LastError is the error of the last failed connection; this is not
+	// cleared on success.
+	LastError error
+
+	// LastLatency is the time it took to connect or ping the backend for the
+	// last successful connection.
+	LastLatency time.Duration
+
+	// ConsecutiveFailures is the number of connections that failed since the
+	// last successful one.
+	ConsecutiveFailures int
+
+	// LastCheck is the time of the last connection attempt.
+	LastCheck time.Time
+
+	// Drained reports if the backend was taken out of rotation with Drain();
+	// no new commands are sent to it.
+	Drained bool
+
+	// Active is the number of commands in progress on the backend.
+	Active int
+
+	// Saturated reports if the backend is at its connection limit (see
+	// WithBackendLimits()); it's only picked if all backends are saturated.
+	Saturated bool
+}
+
+// health tracks the status of all backends a Client has used.
+type health struct {
+	mu       sync.Mutex
+	backends map[string]*BackendStatus
+}
+
+func newHealth() *health {
+	return &health{backends: make(map[string]*BackendStatus)}
+}
+
+// record the result of connecting to addr, returning true if the backend was
+// unreachable before and is reachable now.
+func (h *health) record(addr string, latency time.Duration, err error) bool {
+	if h == nil {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, ok := h.backends[addr]
+	if !ok {
+		b = &BackendStatus{Addr: addr}
+		h.backends[addr] = b
+	}
+
+	recovered := ok && !b.Reachable && err == nil
+	b.LastCheck = time.Now()
+	b.Reachable = err == nil
+	if err != nil {
+		b.LastError = err
+		b.ConsecutiveFailures++
+		return false
+	}
+	b.LastLatency = latency
+	b.ConsecutiveFailures = 0
+	return recovered
+}
+
+// addrs returns the addresses of all backends that are being tracked.
+func (h *health) addrs() []string {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	addrs := make([]string, 0, len(h.backends))
+	for a := range h.backends {
+		addrs = append(addrs, a)
+	}
+	return addrs
+}
+
+// forget the status of addr.
+func (h *health) forget(addr string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.backends, addr)
+}
+
+// status returns a copy of the status for addr.
+func (h *health) status(addr string) BackendStatus {
+	if h == nil {
+		return BackendStatus{Addr: addr}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if b, ok := h.backends[addr]; ok {
+		return *b
+	}
+	return BackendStatus{Addr: addr}
+}
+
+// HealthCheck pings all spamd backends and returns their status, sorted by
+// address. This includes the backends set with SetBackends() or the default
+// address, and all addresses that commands have been sent to (e.g. through
+// the Router).
+//
+// The error from a ping is recorded in the BackendStatus rather than returned;
+// use BackendStatus.Reachable to see if a backend is up. Drained backends are
+// still pinged, so they can be checked before they're undrained.
+func (c *Client) HealthCheck(ctx context.Context) []BackendStatus {
+	known := c.backends.list()
+	if len(known) == 0 {
+		known = []string{c.addr}
+	}
+
+	addrs := c.health.addrs()
+	for _, k := range known {
+		seen := false
+		for _, a := range addrs {
+			seen = seen || a == k
+		}
+		if !seen {
+			addrs = append(addrs, k)
+		}
+	}
+	sort.Strings(addrs)
+
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			r, err := c.ping(ctx, addr)
+			if err == nil {
+				// Use the full round-trip time rather than just the time
+				// to connect.
+				c.health.record(addr, r.Latency, nil)
+			} else if c.health.status(addr).Reachable {
+				// Connected, but the command failed.
+				c.health.record(addr, 0, err)
+				c.log().Warn("spamd health check failed", "addr", addr, "error", err)
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	active := c.conns.activeByAddr()
+	status := make([]BackendStatus, len(addrs))
+	for i, addr := range addrs {
+		status[i] = c.health.status(addr)
+		status[i].Drained = c.backends.isDrained(addr)
+		status[i].Active = active[addr]
+		if l := c.backendLimit(addr); c.hasBackendLimits() && l > 0 {
+			status[i].Saturated = active[addr] >= l
+		}
+	}
+	return status
+}
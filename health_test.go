@@ -0,0 +1,82 @@
+package spamc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test/fakeconn"
+)
+
+func TestHealthCheck(t *testing.T) {
+	reply := replyDialer{func(string) string { return "SPAMD/1.5 0 PONG\r\n" }}
+	d := dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		switch addr {
+		case "down:783":
+			return nil, errors.New("connection refused")
+		case "broken:783":
+			return &replyConn{Conn: fakeconn.New(), reply: func(string) string {
+				return "SPAMD/1.5 76 Bad header line\r\n"
+			}}, nil
+		}
+		return reply.DialContext(ctx, network, addr)
+	})
+
+	c := New("default:783", d, WithRouter(RouteMap{"a": "down:783", "b": "broken:783"}))
+	for _, u := range []string{"a", "b"} {
+		c.Ping(context.Background())                           // nolint: errcheck
+		c.Clone(WithDefaultUser(u)).Ping(context.Background()) // nolint: errcheck
+	}
+
+	status := c.HealthCheck(context.Background())
+	if len(status) != 3 {
+		t.Fatalf("wrong length: %#v", status)
+	}
+
+	broken, def, down := status[0], status[1], status[2]
+	if broken.Addr != "broken:783" || broken.Reachable || broken.LastError == nil ||
+		broken.ConsecutiveFailures != 1 {
+		t.Errorf("broken wrong: %#v", broken)
+	}
+	if def.Addr != "default:783" || !def.Reachable || def.LastError != nil ||
+		def.ConsecutiveFailures != 0 || def.LastLatency <= 0 || def.LastCheck.IsZero() {
+		t.Errorf("default wrong: %#v", def)
+	}
+	if down.Addr != "down:783" || down.Reachable || down.LastError == nil ||
+		down.ConsecutiveFailures != 2 {
+		t.Errorf("down wrong: %#v", down)
+	}
+}
+
+func TestHealthCheckBackendState(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		if strings.HasPrefix(req, "PING") {
+			return "SPAMD/1.5 0 PONG\r\n"
+		}
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}}, WithBackendLimits(1, nil))
+	c.SetBackends("a:783", "b:783")
+	if err := c.Drain(context.Background(), "b:783"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Send(context.Background(), &Request{Command: cmdCheck})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	status := c.HealthCheck(context.Background())
+	if len(status) != 2 {
+		t.Fatalf("wrong length: %#v", status)
+	}
+	a, b := status[0], status[1]
+	if a.Addr != "a:783" || a.Drained || a.Active != 1 || !a.Saturated || !a.Reachable {
+		t.Errorf("a wrong: %#v", a)
+	}
+	if b.Addr != "b:783" || !b.Drained || b.Active != 0 || b.Saturated || !b.Reachable {
+		t.Errorf("b wrong: %#v", b)
+	}
+}
@@ -0,0 +1,104 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithHedging sets the HedgeDelay.
+func WithHedging(delay time.Duration) Option {
+	return func(c *Client) { c.HedgeDelay = delay }
+}
+
+// hedgeable reports if cmd can be sent twice.
+func hedgeable(cmd string) bool {
+	switch cmd {
+	case cmdCheck, cmdSymbols, cmdReport, cmdReportIfspam:
+		return true
+	}
+	return false
+}
+
+// hedgedCommand is command(), but sends the command a second time if there's
+// no response after HedgeDelay; the first response is used.
+func (c *Client) hedgedCommand(
+	ctx context.Context,
+	cmd string,
+	message io.Reader,
+	headers Header,
+	compress bool,
+) (respConn, Header, *textproto.Reader, error) {
+
+	// The message is written to the tee while it's sent, so it would be
+	// written twice.
+	if c.HedgeDelay <= 0 || !hedgeable(cmd) || teeFromContext(ctx) != nil {
+		return c.command(ctx, cmd, message, headers, compress)
+	}
+
+	// Both commands need their own copy of the message.
+	data, err := ioutil.ReadAll(message)
+	if err != nil {
+		return respConn{}, nil, nil, errors.Wrap(err, "could not read message")
+	}
+
+	type result struct {
+		read respConn
+		hdr  Header
+		tp   *textproto.Reader
+		err  error
+	}
+	results := make(chan result, 2)
+	run := func(addr string) {
+		read, respHeaders, tp, err := c.commandTo(ctx, addr, cmd, bytes.NewReader(data), headers, compress)
+		results <- result{read, respHeaders, tp, err}
+	}
+
+	first, second := c.hedgeAddrs()
+	go run(first)
+
+	t := time.NewTimer(c.HedgeDelay)
+	defer t.Stop()
+	select {
+	case r := <-results:
+		return r.read, r.hdr, r.tp, r.err
+	case <-t.C:
+	}
+
+	c.log().Debug("hedging slow command", "cmd", cmd, "delay", c.HedgeDelay, "addr", second)
+	go run(second)
+
+	r := <-results
+	if r.err != nil {
+		if r2 := <-results; r2.err == nil {
+			return r2.read, r2.hdr, r2.tp, nil
+		}
+		return r.read, r.hdr, r.tp, r.err
+	}
+
+	// Discard the slower response once it's read; it can't be aborted as
+	// spamd is already processing it.
+	go func() {
+		if r := <-results; r.err == nil {
+			r.read.Close() // nolint: errcheck
+		}
+	}()
+	return r.read, r.hdr, r.tp, nil
+}
+
+// hedgeAddrs returns the addresses to send a hedged command to. Commands that
+// are routed by the Router are always sent to the same backend, as are
+// commands for clients without backends; the second command still uses a
+// new connection, so it's handled by a different spamd child process.
+func (c *Client) hedgeAddrs() (first, second string) {
+	if c.Router != nil || len(c.backends.list()) < 2 {
+		return "", ""
+	}
+	first = c.pickBackend("")
+	return first, c.pickBackend(first)
+}
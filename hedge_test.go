@@ -0,0 +1,106 @@
+package spamc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHedging(t *testing.T) {
+	release := make(chan struct{})
+	var (
+		mu    sync.Mutex
+		addrs []string
+	)
+	slow := replyDialer{func(req string) string {
+		<-release
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}}
+	fast := replyDialer{func(req string) string {
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 2.0 / 5.0\r\n\r\n"
+	}}
+	c := New("", dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		addrs = append(addrs, addr)
+		mu.Unlock()
+		if addr == "slow:783" {
+			return slow.DialContext(ctx, network, addr)
+		}
+		return fast.DialContext(ctx, network, addr)
+	}), WithHedging(10*time.Millisecond))
+	c.SetBackends("slow:783", "fast:783")
+
+	check := func(wantScore float64, wantAddrs ...string) {
+		t.Helper()
+		mu.Lock()
+		addrs = nil
+		mu.Unlock()
+
+		r, err := c.Check(context.Background(), strings.NewReader("A message"), Header{}.Set("User", "a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Score != wantScore {
+			t.Errorf("wrong score: %v", r.Score)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !reflect.DeepEqual(addrs, wantAddrs) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", addrs, wantAddrs)
+		}
+	}
+
+	check(2, "slow:783", "fast:783") // Hedged.
+	check(2, "fast:783")             // Fast enough.
+	close(release)
+	check(1, "slow:783") // Not slow anymore.
+
+	t.Run("tell", func(t *testing.T) {
+		if hedgeable(cmdTell) || hedgeable(cmdProcess) {
+			t.Error("command is hedged")
+		}
+	})
+}
+
+func TestHedgingCheckAsync(t *testing.T) {
+	release := make(chan struct{})
+	slow := replyDialer{func(req string) string {
+		<-release
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}}
+	fast := replyDialer{func(req string) string {
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 2.0 / 5.0\r\n\r\n"
+	}}
+	c := New("", dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == "slow:783" {
+			return slow.DialContext(ctx, network, addr)
+		}
+		return fast.DialContext(ctx, network, addr)
+	}), WithHedging(10*time.Millisecond), WithConcurrencyLimit(2, 0))
+	c.SetBackends("slow:783", "fast:783")
+
+	// Both commands are started with the slot reserved by CheckAsync(), but
+	// only one of them may use it.
+	f, err := c.CheckAsync(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Score != 2 {
+		t.Errorf("wrong score: %v", r.Score)
+	}
+	if s := c.QueueStats(); s.Active != 1 {
+		t.Errorf("wrong number of active commands: %v", s.Active)
+	}
+
+	close(release)
+	waitStats(t, c, QueueStats{Max: 2})
+}
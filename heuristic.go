@@ -0,0 +1,86 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// heuristicMaxSize is the number of bytes that HeuristicScore reads, which is
+// the same as spamd's default --max-size.
+const heuristicMaxSize = 500 * 1024
+
+// heuristicRules are the rules that HeuristicScore uses. The names are the
+// same as the SpamAssassin rules that check the same thing, so that policies
+// work the same with degraded verdicts.
+var heuristicRules = []struct {
+	symbol string
+	score  float64
+	match  func(h mail.Header, body []byte) bool
+}{
+	{SymbolGTUBE, 1000, func(h mail.Header, body []byte) bool {
+		return bytes.Contains(body, []byte(gtube))
+	}},
+	{"MISSING_FROM", 1.0, func(h mail.Header, body []byte) bool {
+		return strings.TrimSpace(h.Get("From")) == ""
+	}},
+	{SymbolMissingHeaders, 1.0, func(h mail.Header, body []byte) bool {
+		return strings.TrimSpace(h.Get("To")) == ""
+	}},
+	{"MISSING_DATE", 1.4, func(h mail.Header, body []byte) bool {
+		return strings.TrimSpace(h.Get("Date")) == ""
+	}},
+	{SymbolInvalidDate, 1.1, func(h mail.Header, body []byte) bool {
+		if strings.TrimSpace(h.Get("Date")) == "" {
+			return false
+		}
+		_, err := h.Date()
+		return err != nil
+	}},
+	{"MISSING_SUBJECT", 1.8, func(h mail.Header, body []byte) bool {
+		_, ok := h["Subject"]
+		return !ok
+	}},
+	{"MISSING_MID", 0.5, func(h mail.Header, body []byte) bool {
+		return strings.TrimSpace(h.Get("Message-Id")) == ""
+	}},
+}
+
+// HeuristicScore is a FallbackFunc which scores a message with a few simple
+// local rules: the GTUBE string, and missing or invalid From, To, Date,
+// Subject, and Message-ID headers. It's much less accurate than spamd, and is
+// only intended for use as a fallback with WithOnUnavailable():
+//
+//   c := New(addr, nil, WithOnUnavailable(HeuristicScore))
+//
+// The threshold is 5, as with spamd's default configuration. The verdict is
+// always marked as Degraded, so policies can treat it differently; for
+// example, by quarantining instead of rejecting.
+func HeuristicScore(ctx context.Context, msg io.Reader) (Verdict, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(msg, heuristicMaxSize))
+	if err != nil {
+		return Verdict{}, errors.Wrap(err, "could not read message")
+	}
+
+	h := mail.Header{}
+	body := data
+	if m, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		h = m.Header
+		body, _ = ioutil.ReadAll(m.Body) // Can't fail, as it's a bytes.Reader.
+	}
+
+	v := Verdict{BaseScore: 5, Degraded: true}
+	for _, r := range heuristicRules {
+		if r.match(h, body) {
+			v.Score += r.score
+			v.Symbols = append(v.Symbols, r.symbol)
+		}
+	}
+	v.IsSpam = v.Score >= v.BaseScore
+	return v, nil
+}
@@ -0,0 +1,50 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeuristicScore(t *testing.T) {
+	const headers = "From: a@example.com\r\n" +
+		"To: b@example.com\r\n" +
+		"Subject: Hello\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+		"Message-Id: <1@example.com>\r\n"
+
+	cases := []struct {
+		in          string
+		wantScore   float64
+		wantSymbols SymbolSet
+	}{
+		{headers + "\r\nHello", 0, nil},
+		{headers + "\r\n" + gtube, 1000, SymbolSet{SymbolGTUBE}},
+		{"Subject: \r\nDate: yesterday\r\n\r\nHello", 3.6,
+			SymbolSet{"MISSING_FROM", SymbolMissingHeaders, SymbolInvalidDate, "MISSING_MID"}},
+		{"Not a message", 5.7,
+			SymbolSet{"MISSING_FROM", SymbolMissingHeaders, "MISSING_DATE", "MISSING_SUBJECT", "MISSING_MID"}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out, err := HeuristicScore(context.Background(), strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Verdict{
+				IsSpam:    tc.wantScore >= 5,
+				Score:     tc.wantScore,
+				BaseScore: 5,
+				Symbols:   tc.wantSymbols,
+				Degraded:  true,
+			}
+			out.Score = float64(int(out.Score*10+0.5)) / 10
+			if !reflect.DeepEqual(out, want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+			}
+		})
+	}
+}
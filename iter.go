@@ -0,0 +1,87 @@
+//go:build go1.23
+// +build go1.23
+
+package spamc
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// CheckAllResponse is a response from CheckAll().
+type CheckAllResponse struct {
+	// Index of the message in the input sequence.
+	Index int
+
+	// Response is nil if the check failed.
+	Response *ResponseCheck
+}
+
+// CheckAll checks all messages in msgs, with at most concurrency commands in
+// progress at the same time. The responses are returned in the same order as
+// the messages:
+//
+//   for r, err := range c.CheckAll(ctx, msgs, 4) {
+//       if err != nil {
+//           log.Printf("message %d: %v", r.Index, err)
+//           continue
+//       }
+//       fmt.Println(r.Index, r.Response.Score)
+//   }
+//
+// Breaking out of the loop cancels the commands that are still in progress. No
+// new messages are read from msgs once ctx is done.
+func (c *Client) CheckAll(
+	ctx context.Context,
+	msgs iter.Seq[io.Reader],
+	concurrency int,
+) iter.Seq2[CheckAllResponse, error] {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type result struct {
+		resp CheckAllResponse
+		err  error
+	}
+
+	return func(yield func(CheckAllResponse, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Results are queued in the order the messages were read; waiting
+		// for the oldest one once the queue is full limits the concurrency.
+		queue := make([]chan result, 0, concurrency)
+		next := func() bool {
+			r := <-queue[0]
+			queue = queue[1:]
+			return yield(r.resp, r.err)
+		}
+
+		i := 0
+		for msg := range msgs {
+			if ctx.Err() != nil {
+				break
+			}
+			if len(queue) == concurrency && !next() {
+				return
+			}
+
+			ch := make(chan result, 1)
+			queue = append(queue, ch)
+			go func(i int, msg io.Reader) {
+				r, err := c.Check(ctx, msg, nil)
+				ch <- result{CheckAllResponse{Index: i, Response: r}, err}
+			}(i, msg)
+			i++
+		}
+
+		for len(queue) > 0 {
+			if !next() {
+				return
+			}
+		}
+	}
+}
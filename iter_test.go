@@ -0,0 +1,82 @@
+//go:build go1.23
+// +build go1.23
+
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckAll(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		// Later messages finish first, to check the order is kept.
+		n, _ := strconv.Atoi(req[strings.LastIndex(req, "\n")+1:])
+		time.Sleep(time.Duration(5-n) * time.Millisecond)
+		if n == 2 {
+			return "SPAMD/1.1 76 EX_PROTOCOL\r\n"
+		}
+		return fmt.Sprintf("SPAMD/1.1 0 EX_OK\r\nSpam: False ; %d.0 / 5.0\r\n\r\n", n)
+	}})
+
+	msgs := func(yield func(io.Reader) bool) {
+		for i := 0; i < 5; i++ {
+			if !yield(strings.NewReader(strconv.Itoa(i))) {
+				return
+			}
+		}
+	}
+
+	t.Run("all", func(t *testing.T) {
+		var out []string
+		for r, err := range c.CheckAll(context.Background(), msgs, 3) {
+			if err != nil {
+				out = append(out, fmt.Sprintf("%d: %v", r.Index, ExitCode(err, false)))
+				continue
+			}
+			out = append(out, fmt.Sprintf("%d: %v", r.Index, r.Response.Score))
+		}
+
+		want := []string{"0: 0", "1: 1", "2: 76", "3: 3", "4: 4"}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+		}
+	})
+
+	t.Run("break", func(t *testing.T) {
+		n := 0
+		for range c.CheckAll(context.Background(), msgs, 0) {
+			n++
+			if n == 2 {
+				break
+			}
+		}
+		if n != 2 {
+			t.Errorf("n is %d", n)
+		}
+	})
+}
+
+func TestCheckAllMbox(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}})
+	m := NewMbox(strings.NewReader("From a\nSubject: 1\n\nFrom b\nSubject: 2\n"))
+
+	n := 0
+	for _, err := range c.CheckAll(context.Background(), m.Messages(), 2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 || m.Err() != nil {
+		t.Errorf("n: %v; err: %v", n, m.Err())
+	}
+}
@@ -0,0 +1,120 @@
+// Package legacy provides the old Vars-map API on top of the context-based
+// spamc Client, for callers who haven't migrated yet.
+//
+// New code should use the spamc package directly; this package will be removed
+// in a future version.
+package legacy // import "github.com/teamwork/spamc/legacy"
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/teamwork/spamc"
+)
+
+// SpamDOut is the output of a command.
+type SpamDOut struct {
+	Code    int
+	Message string
+	Vars    map[string]interface{}
+}
+
+// Client is a client for spamd with the old API.
+type Client struct {
+	c *spamc.Client
+}
+
+// New creates a new client; timeout is in seconds.
+func New(addr string, timeout int) *Client {
+	return Wrap(spamc.New(addr, &net.Dialer{
+		Timeout: time.Duration(timeout) * time.Second,
+	}))
+}
+
+// Wrap an existing spamc Client.
+func Wrap(c *spamc.Client) *Client {
+	return &Client{c: c}
+}
+
+// args gets the message and headers from the old variadic arguments; the first
+// argument is the message and the optional second argument the user.
+func args(msgpars []string) (*strings.Reader, spamc.Header) {
+	var msg string
+	hdr := spamc.Header{}
+	if len(msgpars) > 0 {
+		msg = msgpars[0]
+	}
+	if len(msgpars) > 1 && msgpars[1] != "" {
+		hdr.Set("User", msgpars[1])
+	}
+	return strings.NewReader(msg), hdr
+}
+
+func ok(vars map[string]interface{}) *SpamDOut {
+	return &SpamDOut{Code: spamc.ExOK, Message: "EX_OK", Vars: vars}
+}
+
+// Ping spamd.
+func (c *Client) Ping() (*SpamDOut, error) {
+	if err := c.c.Ping(context.Background()); err != nil {
+		return nil, err
+	}
+	return &SpamDOut{Code: spamc.ExOK, Message: "PONG"}, nil
+}
+
+// Check if the message is spam.
+func (c *Client) Check(msgpars ...string) (*SpamDOut, error) {
+	msg, hdr := args(msgpars)
+	r, err := c.c.Check(context.Background(), msg, hdr)
+	if err != nil {
+		return nil, err
+	}
+	return ok(r.AsVars()), nil
+}
+
+// Symbols checks if the message is spam and lists the symbols that matched.
+func (c *Client) Symbols(msgpars ...string) (*SpamDOut, error) {
+	msg, hdr := args(msgpars)
+	r, err := c.c.Symbols(context.Background(), msg, hdr)
+	if err != nil {
+		return nil, err
+	}
+	return ok(r.AsVars()), nil
+}
+
+// Report checks if the message is spam and returns the report.
+func (c *Client) Report(msgpars ...string) (*SpamDOut, error) {
+	msg, hdr := args(msgpars)
+	r, err := c.c.Report(context.Background(), msg, hdr)
+	if err != nil {
+		return nil, err
+	}
+	return ok(r.AsVars()), nil
+}
+
+// ReportIfSpam is like Report, but only returns the report if the message is
+// spam.
+func (c *Client) ReportIfSpam(msgpars ...string) (*SpamDOut, error) {
+	msg, hdr := args(msgpars)
+	r, err := c.c.ReportIfSpam(context.Background(), msg, hdr)
+	if err != nil {
+		return nil, err
+	}
+	return ok(r.AsVars()), nil
+}
+
+// Process the message and return the modified message in the body var.
+func (c *Client) Process(msgpars ...string) (*SpamDOut, error) {
+	msg, hdr := args(msgpars)
+	r, err := c.c.Process(context.Background(), msg, hdr)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := r.AsVars()
+	if err != nil {
+		return nil, err
+	}
+	return ok(vars), nil
+}
@@ -0,0 +1,70 @@
+package legacy
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/teamwork/spamc"
+	"github.com/teamwork/test/fakeconn"
+)
+
+type dialer struct {
+	conn fakeconn.Conn
+}
+
+func (d dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.conn, nil
+}
+
+func newClient(resp string) (*Client, fakeconn.Conn) {
+	conn := fakeconn.New()
+	conn.ReadFrom.WriteString(resp)
+	return Wrap(spamc.New("", dialer{conn})), conn
+}
+
+func TestCheck(t *testing.T) {
+	c, conn := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: yes; 6.5 / 5.0\r\n\r\n")
+	out, err := c.Check("A message", "acct42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &SpamDOut{Code: 0, Message: "EX_OK", Vars: map[string]interface{}{
+		"isSpam": true, "spamScore": 6.5, "baseSpamScore": 5.0,
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	wantReq := "CHECK SPAMC/1.5\r\nContent-length: 9\r\nUser: acct42\r\n\r\nA message"
+	if req := conn.Written.String(); req != wantReq {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", req, wantReq)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	c, _ := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\nBAYES_00,RDNS_NONE")
+	out, err := c.Symbols("A message")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"BAYES_00", "RDNS_NONE"}
+	if !reflect.DeepEqual(out.Vars["symbolList"], want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out.Vars["symbolList"], want)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	c, _ := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\nSubject: x\r\n\r\nbody")
+	out, err := c.Process("Subject: x\r\n\r\nbody")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Vars["body"] != "Subject: x\r\n\r\nbody" {
+		t.Errorf("wrong body: %#v", out.Vars["body"])
+	}
+}
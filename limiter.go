@@ -0,0 +1,300 @@
+package spamc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ErrQueueFull is returned if the concurrency limit is reached and the queue
+// of waiting commands is full.
+var ErrQueueFull = errors.New("spamc: queue is full")
+
+// ErrQueueTimeout is returned if the context deadline was exceeded while the
+// command was waiting in the queue; the command wasn't sent.
+var ErrQueueTimeout = errors.New("spamc: deadline exceeded while waiting in queue")
+
+// WithConcurrencyLimit limits the number of commands that are in progress at
+// the same time to max; other commands wait in a queue of at most queue
+// commands, and fail with ErrQueueFull if the queue is full. The queue is
+// unbounded if queue is negative, and a max of 0 or lower removes the limit.
+//
+// Commands wait until their context is done, and fail with ErrQueueTimeout if
+// the deadline is exceeded. PING commands aren't limited, so that health
+// checks keep working while spamd is busy.
+//
+// The limit is shared with clones, unless this option is passed to Clone().
+func WithConcurrencyLimit(max, queue int) Option {
+	return func(c *Client) {
+		c.limiter = nil
+		if max > 0 {
+			c.limiter = &limiter{max: max, maxQueue: queue}
+		}
+	}
+}
+
+// WithInteractiveReserve reserves n slots of the concurrency limit for
+// interactive commands: commands with PriorityBatch can use at most max-n
+// slots, and queued interactive commands are always started before queued
+// batch commands.
+//
+// This replaces the limit with a new one, so it should be passed after
+// WithConcurrencyLimit():
+//
+//   c := New(addr, nil, WithConcurrencyLimit(16, 100), WithInteractiveReserve(4))
+func WithInteractiveReserve(n int) Option {
+	return func(c *Client) {
+		if c.limiter == nil {
+			return
+		}
+		c.limiter = &limiter{max: c.limiter.max, maxQueue: c.limiter.maxQueue, reserve: n}
+	}
+}
+
+// Priority of a command for the concurrency limit.
+type Priority int
+
+// Priorities.
+const (
+	PriorityInteractive Priority = iota // Live mail flow; the default.
+	PriorityBatch                       // Bulk jobs such as re-training.
+)
+
+type priorityKey struct{}
+
+// ContextWithPriority returns a copy of ctx with the priority for commands sent
+// with it; see WithInteractiveReserve().
+func ContextWithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority attached to ctx, or
+// PriorityInteractive if there is none.
+func PriorityFromContext(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// QueueStats is a snapshot of the concurrency limiter.
+type QueueStats struct {
+	Max         int    // Maximum number of active commands.
+	Active      int    // Number of commands in progress.
+	ActiveBatch int    // Number of batch commands in progress.
+	Queued      int    // Number of commands waiting for a slot.
+	QueuedBatch int    // Number of batch commands waiting for a slot.
+	Rejected    uint64 // Number of commands rejected with ErrQueueFull.
+}
+
+// QueueStats returns the current state of the limit set with
+// WithConcurrencyLimit(); all fields are 0 if there is no limit.
+func (c *Client) QueueStats() QueueStats {
+	if c.limiter == nil {
+		return QueueStats{}
+	}
+
+	l := c.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return QueueStats{
+		Max:         l.max,
+		Active:      l.active,
+		ActiveBatch: l.activeBatch,
+		Queued:      len(l.queue) + len(l.batchQueue),
+		QueuedBatch: len(l.batchQueue),
+		Rejected:    l.rejected,
+	}
+}
+
+// limiter limits the number of concurrent commands; waiting commands are
+// granted a slot in the order they were queued, with interactive commands
+// before batch commands.
+type limiter struct {
+	max      int
+	maxQueue int
+	reserve  int // Slots that batch commands can't use.
+
+	mu          sync.Mutex
+	active      int
+	activeBatch int
+	queue       []*waiter
+	batchQueue  []*waiter
+	rejected    uint64
+}
+
+// waiter is a position in the queue; ready is closed once it's granted a slot.
+type waiter struct {
+	ready chan struct{}
+	batch bool
+
+	// used is set to 1 once a reserved position is used or given up; it's
+	// set atomically as hedged commands share the context it's reserved in.
+	used int32
+}
+
+// enqueue gets a slot, or a position in the queue if there are no free slots.
+func (l *limiter) enqueue(p Priority) (*waiter, error) {
+	w := &waiter{ready: make(chan struct{}), batch: p == PriorityBatch}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxQueue >= 0 && len(l.queue)+len(l.batchQueue) >= l.maxQueue && !l.canStart(w) {
+		l.rejected++
+		return nil, ErrQueueFull
+	}
+	if w.batch {
+		l.batchQueue = append(l.batchQueue, w)
+	} else {
+		l.queue = append(l.queue, w)
+	}
+	l.dispatch()
+	return w, nil
+}
+
+// canStart reports if w can be granted a slot right away.
+func (l *limiter) canStart(w *waiter) bool {
+	if w.batch {
+		return len(l.queue) == 0 && len(l.batchQueue) == 0 && l.canStartBatch()
+	}
+	return len(l.queue) == 0 && l.active < l.max
+}
+
+func (l *limiter) canStartBatch() bool {
+	return l.active < l.max && l.activeBatch < l.max-l.reserve
+}
+
+// dispatch grants free slots to queued commands.
+func (l *limiter) dispatch() {
+	for l.active < l.max {
+		var w *waiter
+		switch {
+		case len(l.queue) > 0:
+			w, l.queue = l.queue[0], l.queue[1:]
+		case len(l.batchQueue) > 0 && l.canStartBatch():
+			w, l.batchQueue = l.batchQueue[0], l.batchQueue[1:]
+			l.activeBatch++
+		default:
+			return
+		}
+		l.active++
+		close(w.ready)
+	}
+}
+
+// wait until w is granted a slot, or until ctx is done. The slot is given up
+// if ctx is done by the time it's granted, as the caller has given up.
+func (l *limiter) wait(ctx context.Context, w *waiter) error {
+	select {
+	case <-w.ready:
+		if ctx.Err() == nil {
+			return nil
+		}
+	case <-ctx.Done():
+	}
+
+	l.abandon(w)
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrQueueTimeout
+	}
+	return ctx.Err()
+}
+
+// abandon removes w from the queue, or releases its slot if it was already
+// granted one.
+func (l *limiter) abandon(w *waiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if removeWaiter(&l.queue, w) || removeWaiter(&l.batchQueue, w) {
+		return
+	}
+	l.releaseLocked(w)
+}
+
+func removeWaiter(queue *[]*waiter, w *waiter) bool {
+	for i := range *queue {
+		if (*queue)[i] == w {
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// acquire a slot for a command, waiting in the queue if needed. A position
+// that was reserved in ctx with reserveSlot() is used if there is one.
+func (l *limiter) acquire(ctx context.Context) (*waiter, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	w, ok := ctx.Value(waiterKey{}).(*waiter)
+	if !ok || !atomic.CompareAndSwapInt32(&w.used, 0, 1) {
+		var err error
+		w, err = l.enqueue(PriorityFromContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w, l.wait(ctx, w)
+}
+
+// release the slot granted to w, handing it to the first waiting command.
+func (l *limiter) release(w *waiter) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked(w)
+}
+
+func (l *limiter) releaseLocked(w *waiter) {
+	l.active--
+	if w.batch {
+		l.activeBatch--
+	}
+	l.dispatch()
+}
+
+type waiterKey struct{}
+
+// reserveSlot reserves a position in the queue, which is used by the first
+// command sent with the returned context. The returned function must be called
+// once the command is done, to give up the position if it wasn't used.
+func (c *Client) reserveSlot(ctx context.Context) (context.Context, func(), error) {
+	if c.limiter == nil {
+		return ctx, func() {}, nil
+	}
+	w, err := c.limiter.enqueue(PriorityFromContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	return context.WithValue(ctx, waiterKey{}, w), func() {
+		if atomic.CompareAndSwapInt32(&w.used, 0, 1) {
+			c.limiter.abandon(w)
+		}
+	}, nil
+}
+
+// limitedConn releases the limiter slot once it's closed.
+type limitedConn struct {
+	net.Conn
+	limiter *limiter
+	waiter  *waiter
+	once    sync.Once
+}
+
+func (lc *limitedConn) Close() error {
+	err := lc.Conn.Close()
+	lc.once.Do(func() { lc.limiter.release(lc.waiter) })
+	return err
+}
+
+func (lc *limitedConn) CloseWrite() error {
+	if cc, ok := lc.Conn.(closeWriter); ok {
+		return cc.CloseWrite()
+	}
+	return nil
+}
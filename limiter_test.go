@@ -0,0 +1,230 @@
+package spamc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// blockingClient returns a client for which commands block until release is
+// closed.
+func blockingClient(release chan struct{}, opts ...Option) *Client {
+	return New("", replyDialer{func(req string) string {
+		if strings.HasPrefix(req, cmdPing) {
+			return "SPAMD/1.5 0 PONG\r\n"
+		}
+		<-release
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}}, opts...)
+}
+
+// waitStats waits until the QueueStats match want.
+func waitStats(t *testing.T, c *Client, want QueueStats) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if c.QueueStats() == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("\nout:  %#v\nwant: %#v\n", c.QueueStats(), want)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	c := blockingClient(release, WithConcurrencyLimit(2, 1))
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+			errs <- err
+		}()
+	}
+	waitStats(t, c, QueueStats{Max: 2, Active: 2, Queued: 1})
+
+	t.Run("queue full", func(t *testing.T) {
+		_, err := c.Check(context.Background(), strings.NewReader("A message"), nil)
+		if errors.Cause(err) != ErrQueueFull {
+			t.Errorf("wrong error: %v", err)
+		}
+		_, err = c.CheckAsync(context.Background(), strings.NewReader("A message"), nil)
+		if err != ErrQueueFull {
+			t.Errorf("wrong error: %v", err)
+		}
+		waitStats(t, c, QueueStats{Max: 2, Active: 2, Queued: 1, Rejected: 2})
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		if err := c.Ping(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	waitStats(t, c, QueueStats{Max: 2, Rejected: 2})
+}
+
+func TestConcurrencyLimitCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c := blockingClient(release, WithConcurrencyLimit(1, -1))
+
+	go c.Check(context.Background(), strings.NewReader("A message"), nil) // nolint: errcheck
+	waitStats(t, c, QueueStats{Max: 1, Active: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := c.CheckAsync(ctx, strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, c, QueueStats{Max: 1, Active: 1, Queued: 1})
+
+	cancel()
+	<-f.Done()
+	if _, err := f.Wait(); errors.Cause(err) != context.Canceled {
+		t.Errorf("wrong error: %v", err)
+	}
+	waitStats(t, c, QueueStats{Max: 1, Active: 1})
+}
+
+func TestCheckAsync(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	c := blockingClient(release)
+
+	f, err := c.CheckAsync(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Score != 1.0 {
+		t.Errorf("wrong score: %v", r.Score)
+	}
+}
+
+func TestReserveSlotShared(t *testing.T) {
+	c := New("", nil, WithConcurrencyLimit(2, -1))
+	ctx, unreserve, err := c.reserveSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commands sent with the same context at the same time, as hedged
+	// commands are, must each get their own slot.
+	start := make(chan struct{})
+	waiters := make(chan *waiter, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			<-start
+			w, err := c.limiter.acquire(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+			waiters <- w
+		}()
+	}
+	close(start)
+	w1, w2 := <-waiters, <-waiters
+	if w1 == w2 {
+		t.Fatal("both commands got the same slot")
+	}
+	unreserve()
+	waitStats(t, c, QueueStats{Max: 2, Active: 2})
+
+	c.limiter.release(w1)
+	c.limiter.release(w2)
+	waitStats(t, c, QueueStats{Max: 2})
+}
+
+func TestInteractiveReserve(t *testing.T) {
+	release := make(chan struct{})
+	c := blockingClient(release, WithConcurrencyLimit(2, -1), WithInteractiveReserve(1))
+
+	errs := make(chan error, 4)
+	check := func(ctx context.Context, want QueueStats) {
+		go func() {
+			_, err := c.Check(ctx, strings.NewReader("A message"), nil)
+			errs <- err
+		}()
+		waitStats(t, c, want)
+	}
+	batch := ContextWithPriority(context.Background(), PriorityBatch)
+
+	check(batch, QueueStats{Max: 2, Active: 1, ActiveBatch: 1})
+	check(batch, QueueStats{Max: 2, Active: 1, ActiveBatch: 1, Queued: 1, QueuedBatch: 1})
+	check(context.Background(), QueueStats{Max: 2, Active: 2, ActiveBatch: 1, Queued: 1, QueuedBatch: 1})
+	check(context.Background(), QueueStats{Max: 2, Active: 2, ActiveBatch: 1, Queued: 2, QueuedBatch: 1})
+
+	// The interactive command is started first, regardless of which command
+	// finished.
+	release <- struct{}{}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	for i := 0; ; i++ {
+		s := c.QueueStats()
+		if s.Active == 2 && s.Queued == 1 && s.QueuedBatch == 1 {
+			break
+		}
+		if i == 200 {
+			t.Fatalf("interactive command not started: %#v", s)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	waitStats(t, c, QueueStats{Max: 2})
+}
+
+func TestQueueTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c := blockingClient(release, WithConcurrencyLimit(1, -1))
+
+	go c.Check(context.Background(), strings.NewReader("A message"), nil) // nolint: errcheck
+	waitStats(t, c, QueueStats{Max: 1, Active: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.Check(ctx, strings.NewReader("A message"), nil)
+	if errors.Cause(err) != ErrQueueTimeout || ExitCode(err, false) != ExTimeout {
+		t.Errorf("wrong error: %v", err)
+	}
+	waitStats(t, c, QueueStats{Max: 1, Active: 1})
+}
+
+func TestQueueShed(t *testing.T) {
+	// A slot granted after the deadline is given up.
+	l := &limiter{max: 1, maxQueue: -1}
+	w, err := l.enqueue(PriorityInteractive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	if err := l.wait(ctx, w); err != ErrQueueTimeout {
+		t.Errorf("wrong error: %v", err)
+	}
+	if l.active != 0 {
+		t.Errorf("slot not released: %v", l.active)
+	}
+}
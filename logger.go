@@ -0,0 +1,34 @@
+package spamc
+
+// Logger logs internal events, such as failed connections. The keyvals are
+// alternating keys and values:
+//
+//   l.Warn("could not connect to spamd", "addr", addr, "error", err)
+//
+// A *slog.Logger implements this interface.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// WithLogger sets the Logger.
+func WithLogger(l Logger) Option {
+	return func(c *Client) { c.Logger = l }
+}
+
+// log returns the Logger, or a no-op Logger if it's not set.
+func (c *Client) log() Logger {
+	if c.Logger == nil {
+		return nopLogger{}
+	}
+	return c.Logger
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
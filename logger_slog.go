@@ -0,0 +1,16 @@
+//go:build go1.21
+// +build go1.21
+
+package spamc
+
+import "log/slog"
+
+var _ Logger = (*slog.Logger)(nil)
+
+// SlogLogger returns a Logger which logs to l, or slog.Default() if l is nil.
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
@@ -0,0 +1,24 @@
+//go:build go1.21
+// +build go1.21
+
+package spamc
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := SlogLogger(slog.New(slog.NewTextHandler(buf, nil)))
+	l.Warn("could not connect to spamd", "addr", "spamd:783")
+
+	if out := buf.String(); !strings.Contains(out, `level=WARN msg="could not connect to spamd" addr=spamd:783`) {
+		t.Errorf("wrong output: %v", out)
+	}
+	if SlogLogger(nil) == nil {
+		t.Error("nil logger")
+	}
+}
@@ -0,0 +1,58 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) log(level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf("%v: %v %v", level, msg, keyvals))
+}
+
+func (l *testLogger) Debug(msg string, kv ...interface{}) { l.log("debug", msg, kv...) }
+func (l *testLogger) Info(msg string, kv ...interface{})  { l.log("info", msg, kv...) }
+func (l *testLogger) Warn(msg string, kv ...interface{})  { l.log("warn", msg, kv...) }
+func (l *testLogger) Error(msg string, kv ...interface{}) { l.log("error", msg, kv...) }
+
+func TestLogger(t *testing.T) {
+	down := true
+	l := &testLogger{}
+	c := New("spamd:783", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		return (replyDialer{func(string) string { return "SPAMD/1.5 0 PONG\r\n" }}).
+			DialContext(context.Background(), "", "")
+	}), WithLogger(l))
+
+	c.Ping(context.Background()) // nolint: errcheck
+	down = false
+	c.Ping(context.Background()) // nolint: errcheck
+	c.Ping(context.Background()) // nolint: errcheck
+
+	want := []string{
+		"warn: could not connect to spamd [addr spamd:783 error could not connect to spamd: dial spamd:783: connection refused]",
+		"info: spamd backend recovered [addr spamd:783]",
+	}
+	if !reflect.DeepEqual(l.msgs, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", l.msgs, want)
+	}
+}
+
+func TestNopLogger(t *testing.T) {
+	// Shouldn't panic.
+	(&Client{}).log().Error("oh noes")
+}
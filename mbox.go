@@ -0,0 +1,113 @@
+package spamc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Mbox reads messages from an mbox file one at a time, so that large archives
+// can be processed without loading them in memory:
+//
+//   m := NewMbox(fp)
+//   for m.Scan() {
+//       r, err := c.CheckBytes(ctx, m.Message(), nil)
+//       ...
+//   }
+//   if err := m.Err(); err != nil {
+//       ...
+//   }
+//
+// Messages are split on "From " lines at the start of the file or after a
+// blank line, and ">From " escaping is removed as in the mboxrd format.
+type Mbox struct {
+	r     *bufio.Reader
+	msg   []byte
+	err   error
+	inMsg bool // The From_ line of the next message has been read.
+	eof   bool
+}
+
+// NewMbox creates a new Mbox reading from r.
+func NewMbox(r io.Reader) *Mbox {
+	return &Mbox{r: bufio.NewReader(r)}
+}
+
+// Message returns the message read by the last call to Scan(), without the
+// From_ line. The returned slice isn't modified by later calls to Scan().
+func (m *Mbox) Message() []byte { return m.msg }
+
+// Err returns the first error that was encountered, if any.
+func (m *Mbox) Err() error { return m.err }
+
+// Scan reads the next message, which is available through Message(). It
+// returns false if there are no more messages or if there was an error.
+func (m *Mbox) Scan() bool {
+	if m.eof || m.err != nil {
+		return false
+	}
+
+	var (
+		msg       []byte
+		prevBlank = !m.inMsg
+	)
+	for {
+		line, err := m.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			m.err = errors.Wrap(err, "could not read mbox")
+			return false
+		}
+
+		if len(line) > 0 {
+			if prevBlank && bytes.HasPrefix(line, []byte("From ")) {
+				if m.inMsg {
+					m.msg = trimSeparator(msg)
+					return true
+				}
+				m.inMsg = true
+				prevBlank = false
+				continue
+			}
+			if !m.inMsg {
+				m.err = errors.New("not an mbox: the first line isn't a From line")
+				return false
+			}
+
+			msg = append(msg, unescapeFrom(line)...)
+			prevBlank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+
+		if err == io.EOF {
+			m.eof = true
+			if !m.inMsg {
+				return false
+			}
+			m.msg = trimSeparator(msg)
+			return true
+		}
+	}
+}
+
+// trimSeparator removes the blank line that separates a message from the next
+// From_ line.
+func trimSeparator(msg []byte) []byte {
+	switch {
+	case bytes.HasSuffix(msg, []byte("\r\n\r\n")):
+		return msg[:len(msg)-2]
+	case bytes.HasSuffix(msg, []byte("\n\n")):
+		return msg[:len(msg)-1]
+	}
+	return msg
+}
+
+// unescapeFrom removes one ">" from lines starting with ">From ", ">>From ",
+// etc.
+func unescapeFrom(line []byte) []byte {
+	l := bytes.TrimLeft(line, ">")
+	if len(l) < len(line) && bytes.HasPrefix(l, []byte("From ")) {
+		return line[1:]
+	}
+	return line
+}
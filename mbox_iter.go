@@ -0,0 +1,29 @@
+//go:build go1.23
+// +build go1.23
+
+package spamc
+
+import (
+	"bytes"
+	"io"
+	"iter"
+)
+
+// Messages returns the messages as a sequence, for use with CheckAll():
+//
+//   m := NewMbox(fp)
+//   for r, err := range c.CheckAll(ctx, m.Messages(), 4) {
+//       ...
+//   }
+//   if err := m.Err(); err != nil {
+//       ...
+//   }
+func (m *Mbox) Messages() iter.Seq[io.Reader] {
+	return func(yield func(io.Reader) bool) {
+		for m.Scan() {
+			if !yield(bytes.NewReader(m.Message())) {
+				return
+			}
+		}
+	}
+}
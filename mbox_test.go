@@ -0,0 +1,57 @@
+package spamc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestMbox(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    []string
+		wantErr string
+	}{
+		{"", nil, ""},
+		{"From a@example.com Thu Jan  1 00:00:00 1970\n", []string{""}, ""},
+		{
+			"From a@example.com Thu Jan  1 00:00:00 1970\n" +
+				"Subject: one\n\nBody\nFrom here\n>From there\n>>From everywhere\n\n" +
+				"From b@example.com Thu Jan  1 00:00:00 1970\n" +
+				"Subject: two\n\n>From\nBody\n",
+			[]string{
+				"Subject: one\n\nBody\nFrom here\nFrom there\n>From everywhere\n",
+				"Subject: two\n\n>From\nBody\n",
+			},
+			"",
+		},
+		{
+			"From a@example.com\r\nSubject: one\r\n\r\nBody\r\n\r\nFrom b@example.com\r\nSubject: two\r\n\r\nBody",
+			[]string{"Subject: one\r\n\r\nBody\r\n", "Subject: two\r\n\r\nBody"},
+			"",
+		},
+		{"Subject: one\n\nBody\n", nil, "not an mbox"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			m := NewMbox(strings.NewReader(tc.in))
+			var out []string
+			for m.Scan() {
+				out = append(out, string(m.Message()))
+			}
+			if !test.ErrorContains(m.Err(), tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", m.Err(), tc.wantErr)
+			}
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+			if m.Scan() {
+				t.Error("Scan() returned true after the end")
+			}
+		})
+	}
+}
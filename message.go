@@ -0,0 +1,166 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Encoder is a message which can write itself in RFC 5322 format; for example
+// enmime's *Part. Use MailMessage() for a *mail.Message.
+//
+// Line endings don't need to be CRLF; they're converted before sending.
+type Encoder interface {
+	Encode(w io.Writer) error
+}
+
+type mailMessage struct{ m *mail.Message }
+
+// MailMessage returns an Encoder for a *mail.Message.
+//
+// Headers are written sorted by name, as the original order is not preserved
+// by net/mail. Long header lines are folded. The message body is read when
+// it's encoded.
+func MailMessage(m *mail.Message) Encoder {
+	return mailMessage{m}
+}
+
+func (m mailMessage) Encode(w io.Writer) error {
+	keys := make([]string, 0, len(m.m.Header))
+	for k := range m.m.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBufferString("")
+	for _, k := range keys {
+		for _, v := range m.m.Header[k] {
+			buf.WriteString(foldHeader(k, v))
+		}
+	}
+	buf.WriteString("\r\n")
+	if _, err := buf.WriteTo(w); err != nil {
+		return err
+	}
+
+	if m.m.Body == nil {
+		return nil
+	}
+	_, err := io.Copy(w, m.m.Body)
+	return err
+}
+
+// maxLineLength is the recommended maximum length of a header line, from RFC
+// 5322 section 2.1.1.
+const maxLineLength = 78
+
+// foldHeader formats the header as "Key: value\r\n", folding it on whitespace
+// if it's longer than maxLineLength.
+func foldHeader(k, v string) string {
+	line := k + ": " + strings.TrimSpace(v)
+	if len(line) <= maxLineLength {
+		return line + "\r\n"
+	}
+
+	var b strings.Builder
+	for len(line) > maxLineLength {
+		// Fold at the last whitespace before the limit; if there is none,
+		// fold at the first whitespace after it.
+		i := strings.LastIndexAny(line[:maxLineLength+1], " \t")
+		if i <= len(k)+1 {
+			i = strings.IndexAny(line[maxLineLength:], " \t")
+			if i == -1 {
+				break
+			}
+			i += maxLineLength
+		}
+		b.WriteString(line[:i])
+		b.WriteString("\r\n")
+		line = line[i:]
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// toCRLF converts all line endings to CRLF.
+func toCRLF(b []byte) []byte {
+	out := make([]byte, 0, len(b)+bytes.Count(b, []byte("\n")))
+	for i, c := range b {
+		if c == '\n' && (i == 0 || b[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// BuildMessage builds a message from the headers and body, for example to
+// send a probe message or in tests:
+//
+//   msg := spamc.BuildMessage(map[string][]string{
+//       "From":    {"probe@example.com"},
+//       "To":      {"postmaster@example.com"},
+//       "Subject": {"Probe"},
+//   }, "Hello\n")
+//
+// The headers are written sorted by name and long headers are folded, as with
+// MailMessage(). All line endings are converted to CRLF. The returned reader
+// has a Size(), so the Content-length is sent without reading the message
+// twice.
+func BuildMessage(h map[string][]string, body string) *bytes.Reader {
+	// Can't fail, as neither the header nor body return errors.
+	r, _ := encodeMessage(MailMessage(&mail.Message{
+		Header: h,
+		Body:   strings.NewReader(body),
+	}))
+	return r
+}
+
+// encodeMessage encodes the message, converting line endings to CRLF.
+func encodeMessage(m Encoder) (*bytes.Reader, error) {
+	buf := bytes.NewBufferString("")
+	if err := m.Encode(buf); err != nil {
+		return nil, errors.Wrap(err, "could not encode message")
+	}
+	return bytes.NewReader(toCRLF(buf.Bytes())), nil
+}
+
+// CheckMessage is like Check(), but encodes the message with correct line
+// endings; for example:
+//
+//   c.CheckMessage(ctx, MailMessage(msg), nil)
+func (c *Client) CheckMessage(
+	ctx context.Context,
+	msg Encoder,
+	hdr Header,
+) (*ResponseCheck, error) {
+
+	r, err := encodeMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return c.Check(ctx, r, hdr)
+}
+
+// ProcessMessage is like Process(), but encodes the message with correct line
+// endings.
+//
+// Do not forget to close the Message reader!
+func (c *Client) ProcessMessage(
+	ctx context.Context,
+	msg Encoder,
+	hdr Header,
+) (*ResponseProcess, error) {
+
+	r, err := encodeMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return c.Process(ctx, r, hdr)
+}
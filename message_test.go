@@ -0,0 +1,90 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test/diff"
+)
+
+func TestFoldHeader(t *testing.T) {
+	cases := []struct {
+		k, v, want string
+	}{
+		{"Subject", "Hello", "Subject: Hello\r\n"},
+		{"Subject", " Hello ", "Subject: Hello\r\n"},
+		{
+			"To",
+			"aaaaaaaaaaaa@example.com, bbbbbbbbbbbbb@example.com, cccccccccccc@example.com, dddd@example.com",
+			"To: aaaaaaaaaaaa@example.com, bbbbbbbbbbbbb@example.com,\r\n" +
+				" cccccccccccc@example.com, dddd@example.com\r\n",
+		},
+		{
+			"X-Long",
+			strings.Repeat("x", 100) + " y",
+			"X-Long: " + strings.Repeat("x", 100) + "\r\n y\r\n",
+		},
+		{
+			"X-Long",
+			strings.Repeat("x", 100),
+			"X-Long: " + strings.Repeat("x", 100) + "\r\n",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := foldHeader(tc.k, tc.v)
+			if d := diff.TextDiff(out, tc.want); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestCheckMessage(t *testing.T) {
+	m, err := mail.ReadMessage(strings.NewReader(
+		"To: a@example.com\nSubject: Hello\n\nLine 1\nLine 2\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: no; 1.0 / 5.0\r\n\r\n")
+	_, err = c.CheckMessage(context.Background(), MailMessage(m), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "CHECK SPAMC/1.5\r\nContent-length: 53\r\n\r\n" +
+		"Subject: Hello\r\nTo: a@example.com\r\n\r\nLine 1\r\nLine 2\r\n"
+	out := c.dialer.(*testDialer).conn.Written.String()
+	if d := diff.TextDiff(out, want); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	out := BuildMessage(map[string][]string{
+		"To":       {"a@example.com"},
+		"Received": {"from a", "from b"},
+		"Subject": {"A long subject which is longer than the maximum recommended " +
+			"length of a header line"},
+	}, "Line 1\nLine 2\r\n")
+
+	want := "Received: from a\r\nReceived: from b\r\n" +
+		"Subject: A long subject which is longer than the maximum recommended length of\r\n" +
+		" a header line\r\n" +
+		"To: a@example.com\r\n" +
+		"\r\n" +
+		"Line 1\r\nLine 2\r\n"
+	if out.Size() != int64(len(want)) {
+		t.Errorf("wrong size\nout:  %v\nwant: %v\n", out.Size(), len(want))
+	}
+	b := new(strings.Builder)
+	_, _ = out.WriteTo(b)
+	if d := diff.TextDiff(b.String(), want); d != "" {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,33 @@
+package spamc
+
+import "context"
+
+// Metadata is a set of identifiers for a request, such as a tenant or queue
+// ID. It's attached to the context passed to the Client's commands, and can be
+// read by hooks with MetadataFromContext() without having to change any method
+// signatures.
+type Metadata map[string]string
+
+type metadataKey struct{}
+
+// ContextWithMetadata returns a copy of ctx with md attached. It's merged with
+// any Metadata that's already in ctx; keys in md take precedence.
+func ContextWithMetadata(ctx context.Context, md Metadata) context.Context {
+	merged := make(Metadata, len(md))
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns the Metadata attached to ctx, or nil if there is
+// none.
+//
+// The returned map should not be modified; use ContextWithMetadata() instead.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
@@ -0,0 +1,26 @@
+package spamc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	ctx := context.Background()
+	if md := MetadataFromContext(ctx); md != nil {
+		t.Errorf("not nil: %#v", md)
+	}
+
+	ctx1 := ContextWithMetadata(ctx, Metadata{"tenant": "a", "queue": "1"})
+	ctx2 := ContextWithMetadata(ctx1, Metadata{"queue": "2"})
+
+	want1 := Metadata{"tenant": "a", "queue": "1"}
+	if md := MetadataFromContext(ctx1); !reflect.DeepEqual(md, want1) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", md, want1)
+	}
+	want2 := Metadata{"tenant": "a", "queue": "2"}
+	if md := MetadataFromContext(ctx2); !reflect.DeepEqual(md, want2) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", md, want2)
+	}
+}
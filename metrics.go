@@ -0,0 +1,90 @@
+package spamc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CommandInfo describes a command that was sent to spamd; it's passed to the
+// OnCommand hook.
+type CommandInfo struct {
+	Command string // Command name, such as "CHECK".
+	Addr    string // Address of the spamd backend.
+	User    string // User the command was sent for; may be empty.
+
+	// Duration from connecting until the response was closed.
+	Duration time.Duration
+
+	// Err is the connection or protocol error, if any. Errors from spamd
+	// (such as EX_NOUSER) are an Error.
+	Err error
+}
+
+// WithOnCommand sets the OnCommand hook.
+func WithOnCommand(f func(context.Context, CommandInfo)) Option {
+	return func(c *Client) { c.OnCommand = f }
+}
+
+// cmdDone calls the OnCommand hook once a command is finished. It's safe for
+// concurrent use, as the response may be closed while it's being read.
+type cmdDone struct {
+	ctx   context.Context
+	hook  func(context.Context, CommandInfo)
+	start time.Time
+
+	mu       sync.Mutex
+	info     CommandInfo
+	finished bool
+}
+
+// newCmdDone returns nil if there is no OnCommand hook.
+func (c *Client) newCmdDone(
+	ctx context.Context,
+	cmd, addr string,
+	headers Header,
+	start time.Time,
+) *cmdDone {
+
+	if c.OnCommand == nil {
+		return nil
+	}
+	user, _ := headers.Get("User")
+	return &cmdDone{
+		ctx:   ctx,
+		hook:  c.OnCommand,
+		info:  CommandInfo{Command: cmd, Addr: addr, User: user},
+		start: start,
+	}
+}
+
+// fail records the error, if no error was recorded yet and the command isn't
+// finished.
+func (d *cmdDone) fail(err error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.finished && d.info.Err == nil {
+		d.info.Err = err
+	}
+}
+
+// finish calls the hook; only the first call has any effect.
+func (d *cmdDone) finish() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.finished {
+		d.mu.Unlock()
+		return
+	}
+	d.finished = true
+	d.info.Duration = time.Since(d.start)
+	info := d.info
+	d.mu.Unlock()
+
+	d.hook(d.ctx, info)
+}
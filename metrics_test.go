@@ -0,0 +1,67 @@
+package spamc
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOnCommand(t *testing.T) {
+	type rec struct {
+		CommandInfo
+		tenant string
+	}
+	var (
+		mu   sync.Mutex
+		recs []rec
+	)
+
+	c := New("default:783", replyDialer{func(req string) string {
+		if strings.Contains(req, "User: unknown\r\n") {
+			return "SPAMD/1.1 67 EX_NOUSER\r\n\r\n"
+		}
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\nbody"
+	}}, WithRouter(RouteMap{"a": "shard1:783"}),
+		WithOnCommand(func(ctx context.Context, info CommandInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if info.Duration <= 0 {
+				t.Errorf("no duration: %#v", info)
+			}
+			info.Duration = 0
+			recs = append(recs, rec{info, MetadataFromContext(ctx)["tenant"]})
+		}))
+
+	ctx := ContextWithMetadata(context.Background(), Metadata{"tenant": "42"})
+	c.Check(ctx, strings.NewReader("A message"), Header{}.Set("User", "a"))       // nolint: errcheck
+	c.Check(ctx, strings.NewReader("A message"), Header{}.Set("User", "unknown")) // nolint: errcheck
+	r, err := c.Process(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Errorf("hook called before Message was closed: %v", len(recs))
+	}
+	ioutil.ReadAll(r.Message) // nolint: errcheck
+	r.Message.Close()         // nolint: errcheck
+
+	if len(recs) != 3 {
+		t.Fatalf("wrong number of calls: %#v", recs)
+	}
+	if _, ok := recs[1].Err.(Error); !ok {
+		t.Errorf("wrong error: %#v", recs[1].Err)
+	}
+	recs[1].Err = nil
+
+	want := []rec{
+		{CommandInfo{Command: "CHECK", Addr: "shard1:783", User: "a"}, "42"},
+		{CommandInfo{Command: "CHECK", Addr: "default:783", User: "unknown"}, "42"},
+		{CommandInfo{Command: "PROCESS", Addr: "default:783"}, ""},
+	}
+	if !reflect.DeepEqual(recs, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", recs, want)
+	}
+}
@@ -0,0 +1,293 @@
+package spamc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RawResponse is a response from spamd, as passed to a ParseFunc.
+type RawResponse struct {
+	// Header contains the response headers.
+	Header Header
+
+	// Body of the response; the connection is closed once the ParseFunc
+	// returns, so it must be read before returning.
+	Body *bufio.Reader
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	client *Client
+}
+
+// Score parses the Spam header, taking the Client's Threshold in to account.
+//
+// Parse warnings, such as a missing base score, are an error with ParseStrict
+// and are ignored otherwise.
+func (r RawResponse) Score() (ResponseScore, error) {
+	return r.client.strictScore(r.Header)
+}
+
+// ParseFunc parses the response to a command.
+type ParseFunc func(r RawResponse) (interface{}, error)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]ParseFunc{
+		cmdCheck:        parseCheck,
+		cmdSymbols:      parseSymbols,
+		cmdReport:       parseReportResponse,
+		cmdReportIfspam: parseReportResponse,
+		cmdTell:         parseTell,
+	}
+)
+
+// RegisterParser registers the parser for a command, so that it can be used
+// with Exec(). This can be used for commands added by forks of spamd.
+//
+// The parsers for the built-in CHECK, SYMBOLS, REPORT, REPORT_IFSPAM, and TELL
+// commands can be replaced, for example to parse extended output, but the
+// replacement must return the same type as the built-in parser (e.g.
+// *ResponseSymbols for SYMBOLS), as that's what the Client methods return.
+func RegisterParser(cmd string, p ParseFunc) {
+	if p == nil {
+		panic("spamc: RegisterParser parser is nil")
+	}
+
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[strings.ToUpper(cmd)] = p
+}
+
+func parser(cmd string) ParseFunc {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	return parsers[strings.ToUpper(cmd)]
+}
+
+// Exec sends cmd to spamd and parses the response with the parser registered
+// for the command with RegisterParser().
+func (c *Client) Exec(
+	ctx context.Context,
+	cmd string,
+	msg io.Reader,
+	hdr Header,
+) (interface{}, error) {
+
+	r, _, _, err := c.exec(ctx, cmd, msg, hdr)
+	return r, err
+}
+
+// exec is Exec(), but also returns the user the command was sent for, and
+// the verdict from the OnUnavailable fallback if it was used.
+func (c *Client) exec(
+	ctx context.Context,
+	cmd string,
+	msg io.Reader,
+	hdr Header,
+) (interface{}, string, *Verdict, error) {
+
+	p := parser(cmd)
+	if p == nil {
+		return nil, "", nil, errors.Errorf("no parser registered for %v", cmd)
+	}
+
+	// The fallback needs the message after it was (partly) sent.
+	fallback := c.hasFallback(cmd)
+	var body []byte
+	if fallback && msg != nil {
+		var err error
+		body, err = ioutil.ReadAll(msg)
+		if err != nil {
+			return nil, "", nil, errors.Wrap(err, "could not read message")
+		}
+		msg = bytes.NewReader(body)
+	}
+
+	read, respHeaders, tp, err := c.do(ctx, &Request{Command: cmd, Message: msg, Headers: hdr})
+	if err != nil {
+		if fallback && IsUnavailable(err) {
+			user := c.DefaultUser
+			if u, _ := hdr.Get("User"); u != "" {
+				user = u
+			}
+			v, err := c.fallback(ctx, strings.ToUpper(cmd), user, body, err)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			return fallbackResponse(cmd, v), v.User, &v, nil
+		}
+		return nil, "", nil, err
+	}
+	defer read.Close() // nolint: errcheck
+
+	r, err := p(RawResponse{
+		Header: respHeaders,
+		Body:   tp.R,
+		Wire:   read.wire,
+		client: c,
+	})
+	if err != nil {
+		return r, read.user, nil, err
+	}
+	if err := c.parsed(ctx, cmd, read.user, r); err != nil {
+		return nil, read.user, nil, err
+	}
+	return r, read.user, nil, nil
+}
+
+// parsed handles the parse warnings of the response r, and calls the verdict
+// hooks; it's called for every parsed response.
+func (c *Client) parsed(ctx context.Context, cmd, user string, r interface{}) error {
+	cmd = strings.ToUpper(cmd)
+	if err := c.parseWarnings(ctx, cmd, warningsOf(r)); err != nil {
+		return err
+	}
+	if c.hasVerdictHooks() {
+		if v, ok := verdictFor(ctx, cmd, user, r); ok {
+			c.emitVerdict(ctx, v)
+		}
+	}
+	return nil
+}
+
+// parserTypeError is returned if a parser registered for a built-in command
+// returned the wrong type.
+func parserTypeError(cmd string, r interface{}) error {
+	return errors.Errorf("parser for %v returned %T", cmd, r)
+}
+
+func parseCheck(r RawResponse) (interface{}, error) {
+	score, warnings, err := r.client.parseScore(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResponseCheck{
+		ResponseScore:  score,
+		Warnings:       warnings,
+		Wire:           r.Wire,
+		ResponseHeader: r.Header,
+	}, nil
+}
+
+func parseSymbols(r RawResponse) (interface{}, error) {
+	// SPAMD/1.1 0 EX_OK
+	// Content-length: 50
+	// Spam: False ; 1.6 / 5.0
+	//
+	// INVALID_DATE,MISSING_HEADERS,NO_RECEIVED,NO_RELAYS
+	score, warnings, err := r.client.parseScore(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	s, symWarnings, err := readSymbols(textproto.NewReader(r.Body))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read body")
+	}
+	warnings = append(warnings, symWarnings...)
+
+	return &ResponseSymbols{
+		ResponseScore:  score,
+		Symbols:        s,
+		Warnings:       warnings,
+		Wire:           r.Wire,
+		ResponseHeader: r.Header,
+	}, nil
+}
+
+func parseReportResponse(r RawResponse) (interface{}, error) {
+	score, warnings, err := r.client.parseScore(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	report, reportWarnings, err := parseReport(textproto.NewReader(r.Body))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse report")
+	}
+	warnings = append(warnings, reportWarnings...)
+
+	return &ResponseReport{
+		ResponseScore:  score,
+		Report:         report,
+		Warnings:       warnings,
+		Wire:           r.Wire,
+		ResponseHeader: r.Header,
+	}, nil
+}
+
+// ParseResponse implements ResponseParser, so that ResponseCheck can be used
+// with Do().
+func (r *ResponseCheck) ParseResponse(raw RawResponse) error {
+	v, err := parseCheck(raw)
+	if err != nil {
+		return err
+	}
+	*r = *v.(*ResponseCheck)
+	return nil
+}
+
+// ParseResponse implements ResponseParser, so that ResponseSymbols can be used
+// with Do().
+func (r *ResponseSymbols) ParseResponse(raw RawResponse) error {
+	v, err := parseSymbols(raw)
+	if err != nil {
+		return err
+	}
+	*r = *v.(*ResponseSymbols)
+	return nil
+}
+
+// ParseResponse implements ResponseParser, so that ResponseReport can be used
+// with Do().
+func (r *ResponseReport) ParseResponse(raw RawResponse) error {
+	v, err := parseReportResponse(raw)
+	if err != nil {
+		return err
+	}
+	*r = *v.(*ResponseReport)
+	return nil
+}
+
+// ParseResponse implements ResponseParser, so that ResponseFull can be used
+// with Do() for REPORT commands.
+func (r *ResponseFull) ParseResponse(raw RawResponse) error {
+	v, err := parseReportResponse(raw)
+	if err != nil {
+		return err
+	}
+	*r = *fullFromReport(v.(*ResponseReport))
+	return nil
+}
+
+// ParseResponse implements ResponseParser, so that ResponseTell can be used
+// with Do().
+func (r *ResponseTell) ParseResponse(raw RawResponse) error {
+	v, err := parseTell(raw)
+	if err != nil {
+		return err
+	}
+	*r = *v.(*ResponseTell)
+	return nil
+}
+
+func parseTell(r RawResponse) (interface{}, error) {
+	t := &ResponseTell{Wire: r.Wire}
+	if h, ok := r.Header.Get("DidSet"); ok {
+		t.DidSet = strings.Split(h, ",")
+	}
+	if h, ok := r.Header.Get("DidRemove"); ok {
+		t.DidRemove = strings.Split(h, ",")
+	}
+	return t, nil
+}
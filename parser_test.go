@@ -0,0 +1,72 @@
+package spamc
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestRegisterParser(t *testing.T) {
+	defer func(sym ParseFunc) {
+		parsers[cmdSymbols] = sym
+		delete(parsers, "SCAN")
+	}(parsers[cmdSymbols])
+
+	RegisterParser("scan", func(r RawResponse) (interface{}, error) {
+		score, err := r.Score()
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		return []interface{}{score.Score, string(b)}, err
+	})
+
+	t.Run("exec", func(t *testing.T) {
+		out, err := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.0 / 5.0\r\n\r\nBody").
+			Exec(context.Background(), "SCAN", strings.NewReader("A message"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []interface{}{6.0, "Body"}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := newClient("").
+			Exec(context.Background(), "NOPE", strings.NewReader("A message"), nil)
+		if !test.ErrorContains(err, "no parser registered for NOPE") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("replace builtin", func(t *testing.T) {
+		RegisterParser(cmdSymbols, func(r RawResponse) (interface{}, error) {
+			score, err := r.Score()
+			return &ResponseSymbols{ResponseScore: score, Symbols: SymbolSet{"EXTENDED"}}, err
+		})
+		out, err := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.0 / 5.0\r\n\r\nA,B").
+			Symbols(context.Background(), strings.NewReader("A message"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := SymbolSet{"EXTENDED"}
+		if !reflect.DeepEqual(out.Symbols, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out.Symbols, want)
+		}
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		RegisterParser(cmdSymbols, func(r RawResponse) (interface{}, error) { return "x", nil })
+		_, err := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.0 / 5.0\r\n\r\n").
+			Symbols(context.Background(), strings.NewReader("A message"), nil)
+		if !test.ErrorContains(err, "parser for SYMBOLS returned string") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Action is what to do with a message; see Policy.
+type Action int
+
+// Actions, from least to most severe.
+const (
+	ActionAccept     Action = iota // Deliver the message.
+	ActionTag                      // Deliver the message, marked as spam.
+	ActionQuarantine               // Hold the message for review.
+	ActionReject                   // Refuse the message.
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAccept:
+		return "accept"
+	case ActionTag:
+		return "tag"
+	case ActionQuarantine:
+		return "quarantine"
+	case ActionReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// Policy decides what to do with a message based on its score and symbols.
+//
+//   p := Policy{
+//       Quarantine:    8,
+//       Reject:        15,
+//       RejectSymbols: []string{SymbolGTUBE},
+//       Users: map[string]Policy{
+//           "abuse@example.com": {AcceptSymbols: []string{SymbolGTUBE}},
+//       },
+//   }
+//   d := p.Decide(user, r.ResponseScore, r.Symbols)
+//
+// The rules are evaluated in this order, and the first one that matches
+// decides the action:
+//
+//   AcceptSymbols, RejectSymbols, QuarantineSymbols, Reject, Quarantine, Tag
+type Policy struct {
+	// Score cut-offs; a message gets the action if its score is equal to or
+	// higher than the cut-off. Reject and Quarantine are disabled if they're
+	// 0; spamd's verdict (IsSpam) is used for tagging if Tag is 0.
+	Tag        float64
+	Quarantine float64
+	Reject     float64
+
+	// AcceptSymbols are accepted if any of the symbols matched, regardless of
+	// the score; for example a rule for an allow list.
+	AcceptSymbols []string
+
+	// RejectSymbols and QuarantineSymbols are rejected or quarantined if any
+	// of the symbols matched, regardless of the score.
+	RejectSymbols     []string
+	QuarantineSymbols []string
+
+	// Users overrides the policy for specific users; the user's policy
+	// replaces this policy entirely.
+	Users map[string]Policy
+}
+
+// Decision is the result of a Policy.
+type Decision struct {
+	Action Action
+
+	// Reason is a description of the rule that decided the action, for
+	// logging.
+	Reason string
+}
+
+// Decide the action for a message sent to user.
+func (p Policy) Decide(user string, score ResponseScore, symbols SymbolSet) Decision {
+	if up, ok := p.Users[user]; ok {
+		p = up
+	}
+
+	for _, r := range []struct {
+		action  Action
+		symbols []string
+	}{
+		{ActionAccept, p.AcceptSymbols},
+		{ActionReject, p.RejectSymbols},
+		{ActionQuarantine, p.QuarantineSymbols},
+	} {
+		for _, s := range r.symbols {
+			if symbols.Contains(s) {
+				return Decision{r.action, "matched " + s}
+			}
+		}
+	}
+
+	switch {
+	case p.Reject != 0 && score.Score >= p.Reject:
+		return Decision{ActionReject, fmt.Sprintf("score %v >= %v", score.Score, p.Reject)}
+	case p.Quarantine != 0 && score.Score >= p.Quarantine:
+		return Decision{ActionQuarantine, fmt.Sprintf("score %v >= %v", score.Score, p.Quarantine)}
+	case p.Tag != 0 && score.Score >= p.Tag:
+		return Decision{ActionTag, fmt.Sprintf("score %v >= %v", score.Score, p.Tag)}
+	case p.Tag == 0 && score.IsSpam:
+		return Decision{ActionTag, "spamd verdict is spam"}
+	}
+	return Decision{ActionAccept, "no rule matched"}
+}
+
+// PolicyStore loads per-user policies, for example from a database.
+type PolicyStore interface {
+	// Policy returns the policy for user; ok is false if there is none.
+	Policy(ctx context.Context, user string) (p Policy, ok bool, err error)
+}
+
+// PolicyMap is a PolicyStore with a fixed set of policies by user.
+type PolicyMap map[string]Policy
+
+// Policy returns the policy for user.
+func (m PolicyMap) Policy(ctx context.Context, user string) (Policy, bool, error) {
+	p, ok := m[user]
+	return p, ok, nil
+}
+
+// PolicyRegistry decides actions with per-user policies from a store, for
+// multi-tenant setups where every customer has their own thresholds and
+// blocked symbols.
+type PolicyRegistry struct {
+	// Default is used for users that don't have a policy in the Store.
+	Default Policy
+
+	// Store to load per-user policies from; only Default is used if this is
+	// nil.
+	Store PolicyStore
+}
+
+// Decide the action for a message sent to user with the user's policy, or the
+// Default policy if the user doesn't have one.
+func (r PolicyRegistry) Decide(
+	ctx context.Context,
+	user string,
+	score ResponseScore,
+	symbols SymbolSet,
+) (Decision, error) {
+
+	p := r.Default
+	if r.Store != nil {
+		up, ok, err := r.Store.Policy(ctx, user)
+		if err != nil {
+			return Decision{}, errors.Wrapf(err, "could not load policy for %v", user)
+		}
+		if ok {
+			p = up
+		}
+	}
+	return p.Decide(user, score, symbols), nil
+}
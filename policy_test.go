@@ -0,0 +1,99 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/test"
+)
+
+func TestPolicyDecide(t *testing.T) {
+	p := Policy{
+		Quarantine:        8,
+		Reject:            15,
+		RejectSymbols:     []string{SymbolGTUBE},
+		QuarantineSymbols: []string{SymbolSPFFail},
+		AcceptSymbols:     []string{"ALLOWLIST"},
+		Users: map[string]Policy{
+			"abuse": {Tag: 100, AcceptSymbols: []string{SymbolGTUBE}},
+		},
+	}
+
+	cases := []struct {
+		user    string
+		score   ResponseScore
+		symbols SymbolSet
+		want    Decision
+	}{
+		{"", ResponseScore{Score: 1}, nil, Decision{ActionAccept, "no rule matched"}},
+		{"", ResponseScore{Score: 5, IsSpam: true}, nil, Decision{ActionTag, "spamd verdict is spam"}},
+		{"", ResponseScore{Score: 8}, nil, Decision{ActionQuarantine, "score 8 >= 8"}},
+		{"", ResponseScore{Score: 20}, nil, Decision{ActionReject, "score 20 >= 15"}},
+		{"", ResponseScore{Score: 1}, SymbolSet{"A", SymbolGTUBE}, Decision{ActionReject, "matched GTUBE"}},
+		{"", ResponseScore{Score: 1}, SymbolSet{SymbolSPFFail}, Decision{ActionQuarantine, "matched SPF_FAIL"}},
+		{"", ResponseScore{Score: 20}, SymbolSet{"ALLOWLIST", SymbolGTUBE}, Decision{ActionAccept, "matched ALLOWLIST"}},
+		{"abuse", ResponseScore{Score: 1000, IsSpam: true}, SymbolSet{SymbolGTUBE}, Decision{ActionAccept, "matched GTUBE"}},
+		{"abuse", ResponseScore{Score: 1000, IsSpam: true}, nil, Decision{ActionTag, "score 1000 >= 100"}},
+		{"abuse", ResponseScore{Score: 50, IsSpam: true}, nil, Decision{ActionAccept, "no rule matched"}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := p.Decide(tc.user, tc.score, tc.symbols)
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestActionString(t *testing.T) {
+	for a, want := range map[Action]string{
+		ActionAccept: "accept", ActionTag: "tag", ActionQuarantine: "quarantine",
+		ActionReject: "reject", Action(42): "unknown",
+	} {
+		if a.String() != want {
+			t.Errorf("\nout:  %v\nwant: %v\n", a.String(), want)
+		}
+	}
+}
+
+type errStore struct{}
+
+func (errStore) Policy(context.Context, string) (Policy, bool, error) {
+	return Policy{}, false, errors.New("connection refused")
+}
+
+func TestPolicyRegistry(t *testing.T) {
+	r := PolicyRegistry{
+		Default: Policy{Reject: 10},
+		Store:   PolicyMap{"strict": {Reject: 5}},
+	}
+	score := ResponseScore{Score: 7}
+
+	cases := []struct {
+		reg     PolicyRegistry
+		user    string
+		want    Action
+		wantErr string
+	}{
+		{r, "strict", ActionReject, ""},
+		{r, "other", ActionAccept, ""},
+		{PolicyRegistry{Default: Policy{Reject: 5}}, "strict", ActionReject, ""},
+		{PolicyRegistry{Store: errStore{}}, "strict", ActionAccept, "could not load policy for strict: connection refused"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out, err := tc.reg.Decide(context.Background(), tc.user, score, nil)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if out.Action != tc.want {
+				t.Errorf("\nout:  %v\nwant: %v\n", out.Action, tc.want)
+			}
+		})
+	}
+}
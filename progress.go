@@ -0,0 +1,41 @@
+package spamc
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type progressKey struct{}
+
+// ProgressFunc is called while the Message of a Process() or Headers()
+// response is read, with the number of bytes read so far and the size from
+// the Content-length header; total is -1 if spamd didn't send the size.
+type ProgressFunc func(read, total int64)
+
+// ContextWithProgress returns a copy of ctx which calls f while the Message of
+// a Process() or Headers() response is read, so that a slow but progressing
+// transfer can be told apart from a stalled one:
+//
+//   r, err := c.Process(spamc.ContextWithProgress(ctx, func(read, total int64) {
+//       bar.Set(read, total)
+//   }), msg, nil)
+//
+// f is called from the goroutine that reads the Message.
+func ContextWithProgress(ctx context.Context, f ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, f)
+}
+
+func progressFromContext(ctx context.Context) ProgressFunc {
+	f, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return f
+}
+
+// BytesRead returns the number of bytes of the Message that were read so far.
+// It's safe to call this concurrently with reading the Message; for example to
+// detect a stalled transfer from a timer.
+func (r *ResponseProcess) BytesRead() int64 {
+	if m, ok := r.Message.(*messageReader); ok {
+		return atomic.LoadInt64(&m.n)
+	}
+	return 0
+}
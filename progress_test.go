@@ -0,0 +1,40 @@
+package spamc
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	c := newClient("SPAMD/1.1 0 EX_OK\r\n" +
+		"Content-length: 19\r\n" +
+		"Spam: False ; 1.6 / 5.0\r\n" +
+		"\r\n" +
+		"Subject: foo\r\n\r\nasd")
+
+	var calls [][]int64
+	ctx := ContextWithProgress(context.Background(), func(read, total int64) {
+		calls = append(calls, []int64{read, total})
+	})
+	r, err := c.Process(ctx, strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Message.Close() // nolint: errcheck
+
+	if r.BytesRead() != 0 {
+		t.Errorf("BytesRead before reading: %v", r.BytesRead())
+	}
+	if _, err := ioutil.ReadAll(r.Message); err != nil {
+		t.Fatal(err)
+	}
+	if r.BytesRead() != 19 {
+		t.Errorf("BytesRead after reading: %v", r.BytesRead())
+	}
+	if len(calls) == 0 || !reflect.DeepEqual(calls[len(calls)-1], []int64{19, 19}) {
+		t.Errorf("wrong progress calls: %#v", calls)
+	}
+}
@@ -0,0 +1,245 @@
+// Package promexport exposes spamc metrics in the Prometheus text format,
+// without depending on the Prometheus client library.
+//
+// Connect it to a Client with the OnCommand hook, and as a VerdictSink to
+// record verdicts:
+//
+//   exp := promexport.New()
+//   client := spamc.New(addr, nil,
+//       spamc.WithOnCommand(exp.OnCommand),
+//       spamc.WithVerdictSink(exp))
+//   http.Handle("/metrics", exp)
+//
+// Verdicts can also be recorded manually with ObserveScore().
+package promexport // import "github.com/teamwork/spamc/promexport"
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/teamwork/spamc"
+)
+
+// DefaultLatencyBounds are the upper bounds of the latency histogram buckets,
+// in seconds.
+var DefaultLatencyBounds = []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Exporter collects metrics; it's safe for concurrent use.
+type Exporter struct {
+	latencyBounds []float64
+	scoreBounds   []float64
+
+	mu       sync.Mutex
+	commands map[commandKey]*histogram
+	results  map[resultKey]int
+	verdicts map[bool]int
+	scores   *histogram
+	up       map[string]float64
+	latency  map[string]float64
+}
+
+type commandKey struct{ command, addr string }
+
+type resultKey struct{ command, addr, result string }
+
+type histogram struct {
+	buckets []int
+	sum     float64
+	count   int
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{buckets: make([]int, len(bounds))}
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	for i, b := range bounds {
+		if v <= b {
+			h.buckets[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// New creates a new Exporter with DefaultLatencyBounds and
+// spamc.DefaultHistogramBounds for the score histogram.
+func New() *Exporter {
+	return &Exporter{
+		latencyBounds: DefaultLatencyBounds,
+		scoreBounds:   spamc.DefaultHistogramBounds,
+		commands:      make(map[commandKey]*histogram),
+		results:       make(map[resultKey]int),
+		verdicts:      make(map[bool]int),
+		scores:        newHistogram(spamc.DefaultHistogramBounds),
+		up:            make(map[string]float64),
+		latency:       make(map[string]float64),
+	}
+}
+
+// OnCommand records a command; use it as the Client's OnCommand hook.
+func (e *Exporter) OnCommand(ctx context.Context, info spamc.CommandInfo) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := commandKey{info.Command, info.Addr}
+	h, ok := e.commands[k]
+	if !ok {
+		h = newHistogram(e.latencyBounds)
+		e.commands[k] = h
+	}
+	h.observe(e.latencyBounds, info.Duration.Seconds())
+	e.results[resultKey{info.Command, info.Addr, result(info.Err)}]++
+}
+
+// result gets the result label for an error.
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case spamc.IsProtocolError(err):
+		return "protocol_error"
+	case spamc.IsConnectionError(err):
+		return "connection_error"
+	default:
+		return "error"
+	}
+}
+
+// ObserveScore records a verdict.
+func (e *Exporter) ObserveScore(s spamc.ResponseScore) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.verdicts[s.IsSpam]++
+	e.scores.observe(e.scoreBounds, s.Score)
+}
+
+// Accept records the verdict with ObserveScore(), to implement
+// spamc.VerdictSink.
+func (e *Exporter) Accept(ctx context.Context, v spamc.Verdict) error {
+	e.ObserveScore(spamc.ResponseScore{IsSpam: v.IsSpam, Score: v.Score, BaseScore: v.BaseScore})
+	return nil
+}
+
+// ObserveBackend records the status of a backend, for example from
+// Client.HealthCheck().
+func (e *Exporter) ObserveBackend(s spamc.BackendStatus) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.up[s.Addr] = 0
+	if s.Reachable {
+		e.up[s.Addr] = 1
+	}
+	e.latency[s.Addr] = s.LastLatency.Seconds()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	e.WriteTo(w) // nolint: errcheck
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w.
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b := new(strings.Builder)
+
+	header(b, "spamc_commands_total", "counter", "Commands sent to spamd.")
+	rkeys := make([]resultKey, 0, len(e.results))
+	for k := range e.results {
+		rkeys = append(rkeys, k)
+	}
+	sort.Slice(rkeys, func(i, j int) bool {
+		a, b := rkeys[i], rkeys[j]
+		if a.command != b.command {
+			return a.command < b.command
+		}
+		if a.addr != b.addr {
+			return a.addr < b.addr
+		}
+		return a.result < b.result
+	})
+	for _, k := range rkeys {
+		fmt.Fprintf(b, "spamc_commands_total{command=%q,addr=%q,result=%q} %d\n",
+			k.command, k.addr, k.result, e.results[k])
+	}
+
+	header(b, "spamc_command_duration_seconds", "histogram",
+		"Time from connecting to spamd until the response was read.")
+	ckeys := make([]commandKey, 0, len(e.commands))
+	for k := range e.commands {
+		ckeys = append(ckeys, k)
+	}
+	sort.Slice(ckeys, func(i, j int) bool {
+		a, b := ckeys[i], ckeys[j]
+		if a.command != b.command {
+			return a.command < b.command
+		}
+		return a.addr < b.addr
+	})
+	for _, k := range ckeys {
+		writeHistogram(b, "spamc_command_duration_seconds",
+			fmt.Sprintf("command=%q,addr=%q,", k.command, k.addr),
+			e.latencyBounds, e.commands[k])
+	}
+
+	header(b, "spamc_verdicts_total", "counter", "Verdicts by spam status.")
+	fmt.Fprintf(b, "spamc_verdicts_total{spam=\"false\"} %d\n", e.verdicts[false])
+	fmt.Fprintf(b, "spamc_verdicts_total{spam=\"true\"} %d\n", e.verdicts[true])
+
+	header(b, "spamc_score", "histogram", "Spam scores.")
+	writeHistogram(b, "spamc_score", "", e.scoreBounds, e.scores)
+
+	addrs := make([]string, 0, len(e.up))
+	for a := range e.up {
+		addrs = append(addrs, a)
+	}
+	sort.Strings(addrs)
+	if len(addrs) > 0 {
+		header(b, "spamc_backend_up", "gauge", "Whether the spamd backend is reachable.")
+		for _, a := range addrs {
+			fmt.Fprintf(b, "spamc_backend_up{addr=%q} %v\n", a, e.up[a])
+		}
+		header(b, "spamc_backend_latency_seconds", "gauge",
+			"Latency of the last successful connection to the spamd backend.")
+		for _, a := range addrs {
+			fmt.Fprintf(b, "spamc_backend_latency_seconds{addr=%q} %v\n", a, e.latency[a])
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func header(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(b *strings.Builder, name, labels string, bounds []float64, h *histogram) {
+	for i, bound := range bounds {
+		fmt.Fprintf(b, "%s_bucket{%sle=%q} %d\n", name, labels, formatFloat(bound), h.buckets[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(b, "%s_sum%s %v\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,52 @@
+package promexport
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teamwork/spamc"
+)
+
+func TestExporter(t *testing.T) {
+	e := New()
+	e.OnCommand(context.Background(), spamc.CommandInfo{
+		Command: "CHECK", Addr: "spamd:783", Duration: 30 * time.Millisecond,
+	})
+	e.OnCommand(context.Background(), spamc.CommandInfo{
+		Command: "CHECK", Addr: "spamd:783", Duration: 2 * time.Second, Err: spamc.Error{Code: 67},
+	})
+	e.ObserveScore(spamc.ResponseScore{IsSpam: true, Score: 6.5})
+	e.ObserveScore(spamc.ResponseScore{Score: 0.5})
+	e.ObserveBackend(spamc.BackendStatus{Addr: "spamd:783", Reachable: true, LastLatency: time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	for _, want := range []string{
+		`spamc_commands_total{command="CHECK",addr="spamd:783",result="ok"} 1`,
+		`spamc_commands_total{command="CHECK",addr="spamd:783",result="protocol_error"} 1`,
+		`spamc_command_duration_seconds_bucket{command="CHECK",addr="spamd:783",le="0.05"} 1`,
+		`spamc_command_duration_seconds_bucket{command="CHECK",addr="spamd:783",le="+Inf"} 2`,
+		`spamc_command_duration_seconds_sum{command="CHECK",addr="spamd:783"} 2.03`,
+		`spamc_command_duration_seconds_count{command="CHECK",addr="spamd:783"} 2`,
+		`spamc_verdicts_total{spam="true"} 1`,
+		`spamc_verdicts_total{spam="false"} 1`,
+		`spamc_score_bucket{le="1"} 1`,
+		`spamc_score_bucket{le="7.5"} 2`,
+		`spamc_score_count 2`,
+		`spamc_backend_up{addr="spamd:783"} 1`,
+		`spamc_backend_latency_seconds{addr="spamd:783"} 0.001`,
+		"# TYPE spamc_score histogram",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in:\n%v", want, out)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("wrong Content-Type: %v", ct)
+	}
+}
@@ -0,0 +1,163 @@
+package spamc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/textproto"
+	"strings"
+)
+
+// Preprocessor modifies a message before it's sent to spamd.
+type Preprocessor interface {
+	// Preprocess returns the modified message. The returned reader must be
+	// a *strings.Reader, *bytes.Reader, or *os.File so the Content-length
+	// can be determined.
+	Preprocess(msg io.Reader) (io.Reader, error)
+}
+
+// PreprocessorFunc is an adapter to allow the use of ordinary functions as a
+// Preprocessor.
+type PreprocessorFunc func(msg io.Reader) (io.Reader, error)
+
+// Preprocess calls f(msg).
+func (f PreprocessorFunc) Preprocess(msg io.Reader) (io.Reader, error) { return f(msg) }
+
+// MIMEReducer is a Preprocessor which reduces the size of messages by
+// truncating or dropping large non-text MIME parts, such as attachments. These
+// usually contribute little to the score but can take up most of the
+// bandwidth.
+//
+// Headers and text parts are always sent as-is.
+type MIMEReducer struct {
+	// MaxPartSize is the maximum size in bytes of the body of a non-text
+	// part; DefaultMaxPartSize is used if this is 0.
+	MaxPartSize int
+
+	// Drop parts which are larger than MaxPartSize, rather than truncating
+	// them.
+	Drop bool
+}
+
+// DefaultMaxPartSize is the MaxPartSize of a MIMEReducer without one.
+const DefaultMaxPartSize = 64 * 1024
+
+// Preprocess the message.
+func (m MIMEReducer) Preprocess(msg io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(msg)
+	if err != nil {
+		return nil, err
+	}
+	if m.MaxPartSize == 0 {
+		m.MaxPartSize = DefaultMaxPartSize
+	}
+	r, _ := m.reduce(b)
+	return bytes.NewReader(r), nil
+}
+
+// reduce a message or MIME part. The returned bool is false if the part's body
+// was dropped.
+func (m MIMEReducer) reduce(part []byte) ([]byte, bool) {
+	header, body := splitMessage(part)
+	h, _ := textproto.NewReader(bufio.NewReader(bytes.NewReader(header))).ReadMIMEHeader()
+
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		// Default for messages without (valid) Content-Type.
+		mediaType = "text/plain"
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		return append(header, m.reduceMultipart(body, params["boundary"])...), true
+	case strings.HasPrefix(mediaType, "text/"), strings.HasPrefix(mediaType, "message/"):
+		return part, true
+	case len(body) <= m.MaxPartSize:
+		return part, true
+	case m.Drop:
+		return header, false
+	default:
+		return append(header, truncateLines(body, m.MaxPartSize)...), true
+	}
+}
+
+// reduceMultipart reduces all the parts in a multipart body. Dropped parts
+// are removed along with their delimiter.
+func (m MIMEReducer) reduceMultipart(body []byte, boundary string) []byte {
+	var (
+		delim      = []byte("--" + boundary)
+		closeDelim = []byte("--" + boundary + "--")
+		out        = make([]byte, 0, len(body))
+		partDelim  []byte // Delimiter line of the current part; nil if not in a part.
+		part       []byte
+		done       bool
+	)
+
+	flush := func() {
+		if partDelim == nil {
+			return
+		}
+		if r, keep := m.reduce(part); keep {
+			out = append(out, partDelim...)
+			out = append(out, r...)
+		}
+		partDelim, part = nil, nil
+	}
+
+	for _, line := range bytes.SplitAfter(body, []byte("\n")) {
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+		switch {
+		case done:
+			out = append(out, line...)
+		case bytes.Equal(trimmed, delim):
+			flush()
+			partDelim = line
+		case bytes.Equal(trimmed, closeDelim):
+			flush()
+			done = true
+			out = append(out, line...)
+		case partDelim != nil:
+			part = append(part, line...)
+		default: // Preamble.
+			out = append(out, line...)
+		}
+	}
+	flush()
+
+	return out
+}
+
+// splitMessage splits the message in the header (including the blank line)
+// and body.
+func splitMessage(msg []byte) ([]byte, []byte) {
+	if bytes.HasPrefix(msg, []byte("\r\n")) {
+		return msg[:2], msg[2:]
+	}
+	if bytes.HasPrefix(msg, []byte("\n")) {
+		return msg[:1], msg[1:]
+	}
+
+	i := bytes.Index(msg, []byte("\r\n\r\n"))
+	n := 4
+	if j := bytes.Index(msg, []byte("\n\n")); j > -1 && (i == -1 || j < i) {
+		i, n = j, 2
+	}
+	if i == -1 {
+		return msg, nil
+	}
+	return msg[:i+n], msg[i+n:]
+}
+
+// truncateLines truncates b to at most n bytes, on a line boundary.
+func truncateLines(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+	b = b[:n]
+	if i := bytes.LastIndexByte(b, '\n'); i > -1 {
+		return b[:i+1]
+	}
+	return b[:0]
+}
@@ -0,0 +1,125 @@
+package spamc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test/diff"
+	"github.com/teamwork/test/fakeconn"
+)
+
+const testMultipart = "Subject: Hello\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"XX\"\r\n" +
+	"\r\n" +
+	"Preamble\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hello there, this is some text.\r\n" +
+	"--XX\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"AAAAAAAA\r\n" +
+	"BBBBBBBB\r\n" +
+	"CCCCCCCC\r\n" +
+	"--XX\r\n" +
+	"Content-Type: image/png\r\n" +
+	"\r\n" +
+	"small\r\n" +
+	"--XX--\r\n" +
+	"Epilogue\r\n"
+
+func TestMIMEReducer(t *testing.T) {
+	cases := []struct {
+		reducer MIMEReducer
+		in      string
+		want    string
+	}{
+		{
+			MIMEReducer{MaxPartSize: 1000},
+			testMultipart,
+			testMultipart,
+		},
+		{
+			MIMEReducer{MaxPartSize: 20},
+			testMultipart,
+			strings.Replace(testMultipart, "CCCCCCCC\r\n", "", 1),
+		},
+		{
+			MIMEReducer{MaxPartSize: 20, Drop: true},
+			testMultipart,
+			strings.Replace(testMultipart, "--XX\r\n"+
+				"Content-Type: application/pdf\r\n"+
+				"Content-Transfer-Encoding: base64\r\n"+
+				"\r\n"+
+				"AAAAAAAA\r\n"+
+				"BBBBBBBB\r\n"+
+				"CCCCCCCC\r\n", "", 1),
+		},
+		{
+			// Text is never reduced.
+			MIMEReducer{MaxPartSize: 1},
+			"Subject: Hello\r\n\r\nA long text message\r\n",
+			"Subject: Hello\r\n\r\nA long text message\r\n",
+		},
+		{
+			MIMEReducer{MaxPartSize: 7},
+			"Content-Type: application/zip\r\n\r\nAAAA\r\nBBBB\r\n",
+			"Content-Type: application/zip\r\n\r\nAAAA\r\n",
+		},
+		{
+			MIMEReducer{MaxPartSize: 5, Drop: true},
+			"Content-Type: application/zip\n\nAAAA\nBBBB\n",
+			"Content-Type: application/zip\n\n",
+		},
+		{
+			// The zero value uses DefaultMaxPartSize.
+			MIMEReducer{},
+			testMultipart,
+			testMultipart,
+		},
+		{
+			MIMEReducer{Drop: true},
+			"Content-Type: application/zip\n\n" + strings.Repeat("AAAAAAA\n", DefaultMaxPartSize/8+1),
+			"Content-Type: application/zip\n\n",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			r, err := tc.reducer.Preprocess(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.TextDiff(string(out), tc.want); d != "" {
+				t.Errorf("wrong output\n%v", d)
+			}
+		})
+	}
+}
+
+func TestWritePreprocessor(t *testing.T) {
+	conn := fakeconn.New()
+	c := Client{Preprocessor: PreprocessorFunc(func(msg io.Reader) (io.Reader, error) {
+		return strings.NewReader("Short"), nil
+	})}
+
+	err := c.write(conn, "CMD", strings.NewReader("A long message"),
+		Header{}.Set("Content-length", "14"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "CMD SPAMC/1.5\r\nContent-length: 5\r\n\r\nShort"
+	if out := conn.Written.String(); out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
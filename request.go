@@ -0,0 +1,166 @@
+package spamc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Request is a command to send to spamd with Send().
+type Request struct {
+	// Command to send, such as "CHECK".
+	Command string
+
+	// Message to send; an empty message is sent if this is nil.
+	Message io.Reader
+
+	// Size of the Message; it's determined from the Message if this is 0,
+	// which only works for some types (such as *bytes.Reader).
+	Size int64
+
+	// User to send the command for; DefaultUser is used if this is empty.
+	User string
+
+	// Headers to send; the above fields take precedence over the
+	// Content-length and User headers.
+	Headers Header
+
+	// Compress the message with zlib, to reduce the amount of data sent to
+	// spamd. The message is compressed after the Preprocessor was run. It's
+	// always compressed if the Client's Compress is set.
+	//
+	// A Compress header in Headers or the Client's DefaultHeaders is
+	// ignored, as it would be sent with an uncompressed message.
+	Compress bool
+
+	// Timeout for the command, instead of the Client's Timeout.
+	Timeout time.Duration
+}
+
+// header returns the headers for the request.
+func (r *Request) header() Header {
+	if r.Size <= 0 && r.User == "" {
+		return r.Headers
+	}
+
+	h := make(Header, len(r.Headers)+2)
+	for k, v := range r.Headers {
+		h[k] = v
+	}
+	if r.Size > 0 {
+		h.Set("Content-length", strconv.FormatInt(r.Size, 10))
+	}
+	if r.User != "" {
+		h.Set("User", r.User)
+	}
+	return h
+}
+
+// Response is the unparsed response to a Request. The Body must be closed.
+type Response struct {
+	// Header contains the response headers.
+	Header Header
+
+	// Body of the response.
+	Body io.ReadCloser
+
+	// Wire is the raw request and response if Client.Debug is set.
+	Wire *Wire
+
+	client *Client
+}
+
+// Score parses the Spam header, taking the Client's Threshold in to account.
+//
+// Parse warnings, such as a missing base score, are an error with ParseStrict
+// and are ignored otherwise.
+func (r *Response) Score() (ResponseScore, error) {
+	return r.client.strictScore(r.Header)
+}
+
+// Send a command to spamd and return the unparsed response. This is the
+// low-level primitive that the other methods are built on; it can be used for
+// commands or combinations of options which don't have their own method:
+//
+//   resp, err := c.Send(ctx, &spamc.Request{
+//       Command:  "SYMBOLS",
+//       Message:  msg,
+//       User:     "bob",
+//       Compress: true,
+//       Timeout:  5 * time.Second,
+//   })
+//   if err != nil {
+//       return err
+//   }
+//   defer resp.Body.Close()
+//
+// Errors from spamd are returned as an Error, as with the other methods.
+func (c *Client) Send(ctx context.Context, req *Request) (*Response, error) {
+	read, respHeaders, tp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Header: respHeaders,
+		Body:   rc{read: read, buff: tp.R},
+		Wire:   read.wire,
+		client: c,
+	}, nil
+}
+
+// do sends the request and reads the response headers; see command().
+func (c *Client) do(ctx context.Context, req *Request) (respConn, Header, *textproto.Reader, error) {
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+		c = c.Clone(WithTimeout(req.Timeout))
+	}
+
+	msg := req.Message
+	if msg == nil {
+		msg = strings.NewReader("")
+	}
+	return c.hedgedCommand(ctx, req.Command, msg, req.header(), req.Compress)
+}
+
+// compressMessage compresses a message which was prepared with prepare(), and
+// sets the Compress and Content-length headers.
+func compressMessage(message io.Reader, headers Header) (io.Reader, error) {
+	l, _ := headers.Get("Content-length")
+	size, err := strconv.ParseInt(l, 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid Content-length: %q", l)
+	}
+	cm, err := compress(message, size)
+	if err != nil {
+		return nil, err
+	}
+	headers.Set("Compress", "zlib")
+	headers.Set("Content-length", strconv.FormatInt(cm.Size(), 10))
+	return cm, nil
+}
+
+// compress the first size bytes of message with zlib.
+func compress(message io.Reader, size int64) (*bytes.Reader, error) {
+	buf := new(bytes.Buffer)
+	w := zlib.NewWriter(buf)
+	n, err := io.Copy(w, io.LimitReader(message, size))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compress message")
+	}
+	if n != size {
+		return nil, &ContentLengthError{Header: size, Actual: n}
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "could not compress message")
+	}
+	return bytes.NewReader(buf.Bytes()), nil
+}
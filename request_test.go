@@ -0,0 +1,151 @@
+package spamc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/test/fakeconn"
+)
+
+func TestSend(t *testing.T) {
+	var req string
+	c := New("", replyDialer{func(r string) string {
+		req = r
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.0 / 5.0\r\n\r\nGTUBE"
+	}}, WithDefaultUser("default"))
+
+	t.Run("compress", func(t *testing.T) {
+		resp, err := c.Send(context.Background(), &Request{
+			Command:  cmdSymbols,
+			Message:  strings.NewReader("Subject: hello\r\n\r\nA message"),
+			User:     "bob",
+			Headers:  Header{}.Set("User", "alice"),
+			Compress: true,
+			Timeout:  time.Second,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close() // nolint: errcheck
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		score, err := resp.Score()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "GTUBE" || !score.IsSpam || score.Score != 6 {
+			t.Errorf("wrong response: %q %#v", body, score)
+		}
+
+		i := strings.Index(req, "\r\n\r\n")
+		hdr, compressed := req[:i+2], req[i+4:]
+		for _, h := range []string{"SYMBOLS SPAMC/1.5\r\n", "User: bob\r\n", "Compress: zlib\r\n"} {
+			if !strings.Contains(hdr, h) {
+				t.Errorf("%q not in request: %q", h, hdr)
+			}
+		}
+		zr, err := zlib.NewReader(bytes.NewReader([]byte(compressed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != "Subject: hello\r\n\r\nA message" {
+			t.Errorf("wrong message: %q", msg)
+		}
+		if c.Timeout != 0 {
+			t.Errorf("client timeout changed: %v", c.Timeout)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		resp, err := c.Send(context.Background(), &Request{Command: cmdCheck})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close() // nolint: errcheck
+
+		want := "CHECK SPAMC/1.5\r\nContent-length: 0\r\nUser: default\r\n\r\n"
+		if req != want {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", req, want)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		resp, err := c.Send(context.Background(), &Request{
+			Command: cmdCheck,
+			Message: ioutil.NopCloser(strings.NewReader("A message")),
+			Size:    9,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close() // nolint: errcheck
+		if !strings.Contains(req, "Content-length: 9\r\n") {
+			t.Errorf("wrong request: %q", req)
+		}
+	})
+}
+
+func TestSendCompressRetry(t *testing.T) {
+	attempts := 0
+	c := New("", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+		}
+		return &replyConn{Conn: fakeconn.New(), reply: func(req string) string {
+			if !strings.Contains(req, "Compress: zlib\r\n") {
+				t.Errorf("not compressed: %q", req)
+			}
+			return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+		}}, nil
+	}), WithRetry(RetryPolicy{Attempts: 2}))
+
+	hdr := Header{}.Set(HeaderMessageClass, MessageClassHam)
+	resp, err := c.Send(context.Background(), &Request{
+		Command:  cmdCheck,
+		Message:  strings.NewReader("A message"),
+		Headers:  hdr,
+		Compress: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if attempts != 2 {
+		t.Errorf("wrong number of attempts: %d", attempts)
+	}
+	want := Header{HeaderMessageClass: MessageClassHam}
+	if !reflect.DeepEqual(hdr, want) {
+		t.Errorf("headers modified\nout:  %#v\nwant: %#v\n", hdr, want)
+	}
+}
+
+func TestClientCompress(t *testing.T) {
+	msg := strings.Repeat("A message\r\n", 100)
+	c := New("", replyDialer{func(req string) string {
+		if !strings.Contains(req, "Compress: zlib\r\n") || strings.Contains(req, msg) {
+			t.Errorf("not compressed: %q", req)
+		}
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+	}}, WithCompression(true))
+
+	if _, err := c.Check(context.Background(), strings.NewReader(msg), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Symbols(context.Background(), strings.NewReader(msg), nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package spamc
+
+// Result is implemented by all responses with a score, so that code which
+// handles the results of several commands doesn't need a type switch:
+//
+//   func record(r spamc.Result) {
+//       log.Printf("spam=%v score=%v/%v", r.Spam(), r.SpamScore(), r.RequiredScore())
+//   }
+//
+// It's implemented by ResponseCheck, ResponseSymbols, ResponseReport,
+// ResponseFull, ResponseProcess, and ResponseHeaders. The methods can't be
+// called Score() and IsSpam(), as those are the names of the ResponseScore
+// fields.
+type Result interface {
+	// Spam reports if the message is considered spam.
+	Spam() bool
+
+	// SpamScore is the spam score of the message.
+	SpamScore() float64
+
+	// RequiredScore is the score from which a message is considered spam.
+	RequiredScore() float64
+
+	// Raw is the header of spamd's response.
+	Raw() Header
+}
+
+var (
+	_ Result = &ResponseCheck{}
+	_ Result = &ResponseSymbols{}
+	_ Result = &ResponseReport{}
+	_ Result = &ResponseFull{}
+	_ Result = &ResponseProcess{}
+	_ Result = &ResponseHeaders{}
+)
+
+// Spam returns IsSpam.
+func (s ResponseScore) Spam() bool { return s.IsSpam }
+
+// SpamScore returns Score.
+func (s ResponseScore) SpamScore() float64 { return s.Score }
+
+// RequiredScore returns BaseScore.
+func (s ResponseScore) RequiredScore() float64 { return s.BaseScore }
+
+// Raw returns the ResponseHeader.
+func (r *ResponseCheck) Raw() Header { return r.ResponseHeader }
+
+// Raw returns the ResponseHeader.
+func (r *ResponseSymbols) Raw() Header { return r.ResponseHeader }
+
+// Raw returns the ResponseHeader.
+func (r *ResponseReport) Raw() Header { return r.ResponseHeader }
+
+// Raw returns the ResponseHeader.
+func (r *ResponseFull) Raw() Header { return r.ResponseHeader }
+
+// Raw returns the ResponseHeader.
+func (r *ResponseProcess) Raw() Header { return r.ResponseHeader }
+
+// Raw returns the ResponseHeader.
+func (r *ResponseHeaders) Raw() Header { return r.ResponseHeader }
@@ -0,0 +1,37 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResult(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.5 / 5.0\r\n\r\n"
+	}})
+	ctx := context.Background()
+
+	var results []Result
+	r1, err := c.Check(ctx, strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := c.Symbols(ctx, strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = append(results, r1, r2)
+
+	var out []string
+	for _, r := range results {
+		spam, _ := r.Raw().Get("Spam")
+		out = append(out, fmt.Sprintf("%v %v/%v %q", r.Spam(), r.SpamScore(), r.RequiredScore(), spam))
+	}
+	want := []string{`true 6.5/5 "True ; 6.5 / 5.0"`, `true 6.5/5 "True ; 6.5 / 5.0"`}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
@@ -0,0 +1,126 @@
+package spamc
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how commands that failed with a temporary error are
+// retried; see IsTemporary().
+//
+// Commands are only retried if the message implements io.Seeker (such as
+// *bytes.Reader, *strings.Reader, and *os.File), as it has to be sent again.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times a command is sent, including
+	// the first attempt. Commands aren't retried if this is 0 or 1.
+	Attempts int
+
+	// Backoff is the time to wait before the first retry; it's doubled on
+	// every retry after that.
+	Backoff time.Duration
+
+	// RetryTell allows retrying TELL commands after an ambiguous failure,
+	// where the command was sent but no response was read. This is disabled
+	// by default as spamd may have already learned the message, and learning
+	// it twice skews the Bayes database.
+	//
+	// TELL commands are always retried if the failure happened before the
+	// command was sent, such as a failure to connect.
+	RetryTell bool
+}
+
+// WithRetry sets the Retry policy.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Client) { c.Retry = p }
+}
+
+// AmbiguousError is returned if a TELL command was sent to spamd but the
+// response couldn't be read, so it's unknown if spamd processed it.
+type AmbiguousError struct {
+	Err error
+}
+
+func (e *AmbiguousError) Error() string {
+	return "outcome of TELL is unknown: " + e.Err.Error()
+}
+
+// Cause returns the underlying error, so that errors.Cause(), ExitCode(), and
+// the Is* functions keep working.
+func (e *AmbiguousError) Cause() error { return e.Err }
+
+// Unwrap returns the underlying error.
+func (e *AmbiguousError) Unwrap() error { return e.Err }
+
+// IsAmbiguous reports if err is an AmbiguousError.
+func IsAmbiguous(err error) bool {
+	for err != nil {
+		if _, ok := err.(*AmbiguousError); ok {
+			return true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
+	}
+	return false
+}
+
+// retry reports if the command should be sent again after it failed with err,
+// and prepares the message for it. The sent parameter indicates if the command
+// was sent to spamd before it failed; the outcome is ambiguous if it was and
+// spamd didn't reply with an error code.
+func (c *Client) retry(
+	ctx context.Context,
+	attempt int,
+	cmd string,
+	message io.Reader,
+	offset int64,
+	sent bool,
+	err error,
+) bool {
+
+	if attempt >= c.Retry.Attempts || !IsTemporary(err) || ctx.Err() != nil {
+		return false
+	}
+	if teeFromContext(ctx) != nil {
+		return false
+	}
+	if sent && cmd == cmdTell && !c.Retry.RetryTell {
+		if _, ok := errors.Cause(err).(Error); !ok {
+			return false
+		}
+	}
+	s, ok := message.(io.Seeker)
+	if !ok {
+		return false
+	}
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+
+	wait := c.Retry.Backoff << uint(attempt-1)
+	c.log().Info("retrying command", "cmd", cmd, "attempt", attempt+1, "wait", wait, "error", err)
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ambiguous wraps err in an AmbiguousError for TELL commands.
+func ambiguous(cmd string, err error) error {
+	if cmd != cmdTell {
+		return err
+	}
+	if _, ok := errors.Cause(err).(Error); ok {
+		return err
+	}
+	return &AmbiguousError{Err: err}
+}
@@ -0,0 +1,121 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/test"
+	"github.com/teamwork/test/fakeconn"
+)
+
+type failReadConn struct{ fakeconn.Conn }
+
+func (c *failReadConn) Read(b []byte) (int, error) { return 0, timeoutErr{} }
+
+// failCloseWriteConn fails after the full request was written.
+type failCloseWriteConn struct{ fakeconn.Conn }
+
+func (c *failCloseWriteConn) CloseWrite() error { return timeoutErr{} }
+
+func TestRetry(t *testing.T) {
+	spam := Header{}.Set(HeaderMessageClass, MessageClassSpam).Set(HeaderSet, TellLocal)
+	cases := []struct {
+		cmd           string
+		msg           func() io.Reader
+		policy        RetryPolicy
+		script        []string
+		wantAttempts  int
+		wantErr       string
+		wantAmbiguous bool
+	}{
+		// Disabled by default.
+		{cmdCheck, nil, RetryPolicy{}, []string{"dial", "ok"}, 1, "connection refused", false},
+		{cmdCheck, nil, RetryPolicy{Attempts: 3}, []string{"dial", "read", "ok"}, 3, "", false},
+		{cmdCheck, nil, RetryPolicy{Attempts: 2}, []string{"dial", "read", "ok"}, 2, "timeout", false},
+		{cmdCheck, nil, RetryPolicy{Attempts: 3}, []string{"tempfail", "ok"}, 2, "", false},
+		{cmdCheck, nil, RetryPolicy{Attempts: 3}, []string{"protocol", "ok"}, 1, "EX_PROTOCOL", false},
+		{cmdCheck, func() io.Reader { return ioutil.NopCloser(strings.NewReader("A message")) },
+			RetryPolicy{Attempts: 3}, []string{"dial", "ok"}, 1, "connection refused", false},
+
+		// TELL
+		{cmdTell, nil, RetryPolicy{Attempts: 3}, []string{"dial", "ok"}, 2, "", false},
+		{cmdTell, nil, RetryPolicy{Attempts: 3}, []string{"tempfail", "ok"}, 2, "", false},
+		{cmdTell, nil, RetryPolicy{Attempts: 3}, []string{"read", "ok"}, 1, "outcome of TELL is unknown", true},
+		{cmdTell, nil, RetryPolicy{}, []string{"read", "ok"}, 1, "outcome of TELL is unknown", true},
+		{cmdTell, nil, RetryPolicy{Attempts: 3, RetryTell: true}, []string{"read", "ok"}, 2, "", false},
+		{cmdTell, nil, RetryPolicy{Attempts: 3}, []string{"closewrite", "ok"}, 1, "outcome of TELL is unknown", true},
+		{cmdTell, nil, RetryPolicy{Attempts: 3, RetryTell: true}, []string{"closewrite", "ok"}, 2, "", false},
+		{cmdCheck, nil, RetryPolicy{Attempts: 3}, []string{"closewrite", "ok"}, 2, "", false},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			attempts := 0
+			c := New("", dialerFunc(func(context.Context, string, string) (net.Conn, error) {
+				step := tc.script[attempts]
+				attempts++
+				switch step {
+				case "dial":
+					return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+				case "read":
+					return &failReadConn{fakeconn.New()}, nil
+				case "closewrite":
+					return &failCloseWriteConn{fakeconn.New()}, nil
+				}
+				return &replyConn{Conn: fakeconn.New(), reply: func(req string) string {
+					if !strings.HasSuffix(req, "\r\n\r\nA message") {
+						t.Errorf("wrong request: %q", req)
+					}
+					switch step {
+					case "tempfail":
+						return "SPAMD/1.1 75 EX_TEMPFAIL\r\n\r\n"
+					case "protocol":
+						return "SPAMD/1.1 76 EX_PROTOCOL\r\n\r\n"
+					}
+					return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n"
+				}}, nil
+			}), WithRetry(tc.policy))
+
+			var (
+				msg io.Reader = strings.NewReader("A message")
+				hdr Header
+			)
+			if tc.msg != nil {
+				msg = tc.msg()
+				hdr = Header{}.Set("Content-length", "9")
+			}
+
+			var err error
+			if tc.cmd == cmdTell {
+				_, err = c.Tell(context.Background(), msg, spam)
+			} else {
+				_, err = c.Check(context.Background(), msg, hdr)
+			}
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Errorf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if IsAmbiguous(err) != tc.wantAmbiguous {
+				t.Errorf("IsAmbiguous is %v", IsAmbiguous(err))
+			}
+			if attempts != tc.wantAttempts {
+				t.Errorf("wrong number of attempts\nout:  %v\nwant: %v\n", attempts, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestAmbiguousError(t *testing.T) {
+	err := errors.Wrap(&AmbiguousError{Err: newOpError("read", "", timeoutErr{})}, "wrap")
+	if !IsAmbiguous(err) || !IsTemporary(err) || ExitCode(err, false) != ExTimeout {
+		t.Errorf("wrong: %v %v %v", IsAmbiguous(err), IsTemporary(err), ExitCode(err, false))
+	}
+	if IsAmbiguous(errors.New("x")) || IsAmbiguous(nil) {
+		t.Error("IsAmbiguous is true")
+	}
+}
@@ -0,0 +1,140 @@
+// Package rules parses the score and describe lines from SpamAssassin .cf
+// rule files.
+//
+// Only the information needed to interpret spamd's output is read; other
+// configuration lines (rule definitions, conditionals, etc.) are ignored.
+package rules // import "github.com/teamwork/spamc/rules"
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Rule is a single SpamAssassin rule.
+type Rule struct {
+	Name        string
+	Description string
+
+	// Scores for the rule. This contains either a single score, or four
+	// scores for the different score sets (Bayes and network tests
+	// disabled/enabled).
+	Scores []float64
+}
+
+// Score returns the score for the given score set (0-3). Rules with a single
+// score return it for every set, and rules without a score return 0.
+func (r Rule) Score(set int) float64 {
+	switch {
+	case len(r.Scores) == 0:
+		return 0
+	case len(r.Scores) == 1, set < 0, set >= len(r.Scores):
+		return r.Scores[0]
+	default:
+		return r.Scores[set]
+	}
+}
+
+// RuleSet is a set of rules, indexed by rule name.
+type RuleSet map[string]*Rule
+
+// Get a rule, creating it if it doesn't exist yet.
+func (rs RuleSet) get(name string) *Rule {
+	r, ok := rs[name]
+	if !ok {
+		r = &Rule{Name: name}
+		rs[name] = r
+	}
+	return r
+}
+
+// Merge the rules from other in to rs. Scores and descriptions in other
+// override the ones in rs, just like later .cf files override earlier ones in
+// SpamAssassin.
+func (rs RuleSet) Merge(other RuleSet) {
+	for name, o := range other {
+		r := rs.get(name)
+		if o.Description != "" {
+			r.Description = o.Description
+		}
+		if o.Scores != nil {
+			r.Scores = o.Scores
+		}
+	}
+}
+
+// Parse the score and describe lines from a .cf file:
+//
+//   describe BAYES_99  Bayes spam probability is 99 to 100%
+//   score    BAYES_99  0  0  3.5 3.5
+//
+// Localized descriptions ("lang de describe ...") are ignored.
+func Parse(r io.Reader) (RuleSet, error) {
+	rs := make(RuleSet)
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch strings.ToLower(fields[0]) {
+		case "score":
+			if len(fields) < 3 {
+				return nil, errors.Errorf("line %v: score without value: %v", n, line)
+			}
+			scores, err := parseScores(fields[2:])
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %v", n)
+			}
+			rs.get(fields[1]).Scores = scores
+
+		case "describe":
+			if len(fields) < 2 {
+				return nil, errors.Errorf("line %v: describe without rule name: %v", n, line)
+			}
+			desc := strings.TrimSpace(line[len(fields[0]):])
+			desc = strings.TrimSpace(desc[len(fields[1]):])
+			rs.get(fields[1]).Description = desc
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read rules")
+	}
+	return rs, nil
+}
+
+// parseScores parses the score values; SpamAssassin allows either one or four
+// values.
+func parseScores(fields []string) ([]float64, error) {
+	if len(fields) != 1 && len(fields) != 4 {
+		return nil, errors.Errorf("expected 1 or 4 scores, got %v", len(fields))
+	}
+
+	scores := make([]float64, len(fields))
+	for i, f := range fields {
+		s, err := strconv.ParseFloat(strings.Trim(f, "()"), 64)
+		if err != nil {
+			return nil, errors.Errorf("could not parse score %#v", f)
+		}
+		scores[i] = s
+	}
+	return scores, nil
+}
+
+// stripComment removes comments, taking care of escaped "\#".
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] != '\\') {
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    RuleSet
+		wantErr string
+	}{
+		{
+			"# A comment\n" +
+				"describe BAYES_99  Bayes spam probability is 99 to 100%\n" +
+				"score    BAYES_99  0  0  3.5 3.5 # n=0 n=1\n" +
+				"lang de describe BAYES_99 Spamwahrscheinlichkeit nach Bayes-Test: 99-100%\n" +
+				"header   MISSING_HEADERS  ALL !~ /^To:/m\n" +
+				"score MISSING_HEADERS 1.2\n" +
+				"  describe   NO_RELAYS\tInformational: message was not relayed via SMTP\n" +
+				"describe HASH Has a \\# in it\n",
+			RuleSet{
+				"BAYES_99": {
+					Name:        "BAYES_99",
+					Description: "Bayes spam probability is 99 to 100%",
+					Scores:      []float64{0, 0, 3.5, 3.5},
+				},
+				"MISSING_HEADERS": {Name: "MISSING_HEADERS", Scores: []float64{1.2}},
+				"NO_RELAYS": {
+					Name:        "NO_RELAYS",
+					Description: "Informational: message was not relayed via SMTP",
+				},
+				"HASH": {Name: "HASH", Description: "Has a \\# in it"},
+			},
+			"",
+		},
+		{"score X", nil, "line 1: score without value"},
+		{"\nscore X 1 2", nil, "line 2: expected 1 or 4 scores"},
+		{"score X a", nil, "could not parse score"},
+		{"describe", nil, "describe without rule name"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out, err := Parse(strings.NewReader(tc.in))
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	cases := []struct {
+		in   Rule
+		set  int
+		want float64
+	}{
+		{Rule{}, 0, 0},
+		{Rule{Scores: []float64{1.2}}, 3, 1.2},
+		{Rule{Scores: []float64{0, 1, 2, 3}}, 2, 2},
+		{Rule{Scores: []float64{0, 1, 2, 3}}, 5, 0},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			if out := tc.in.Score(tc.set); out != tc.want {
+				t.Errorf("\nout:  %v\nwant: %v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	rs := RuleSet{
+		"A": {Name: "A", Description: "a", Scores: []float64{1}},
+		"B": {Name: "B", Description: "b", Scores: []float64{2}},
+	}
+	rs.Merge(RuleSet{
+		"A": {Name: "A", Scores: []float64{3}},
+		"C": {Name: "C", Description: "c"},
+	})
+
+	want := RuleSet{
+		"A": {Name: "A", Description: "a", Scores: []float64{3}},
+		"B": {Name: "B", Description: "b", Scores: []float64{2}},
+		"C": {Name: "C", Description: "c"},
+	}
+	if !reflect.DeepEqual(rs, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", rs, want)
+	}
+}
@@ -147,8 +147,8 @@ func TestSATell(t *testing.T) {
 	client := New(addr, nil)
 	message := strings.NewReader("Subject: Hello, world!\r\n\r\nTest message.\r\n")
 	r, err := client.Tell(context.Background(), message, Header{}.
-		Set("Message-class", "spam").
-		Set("set", "remote"))
+		Set(HeaderMessageClass, MessageClassSpam).
+		Set(HeaderSet, TellRemote))
 	if err != nil {
 		t.Fatal(err)
 	}
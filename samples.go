@@ -0,0 +1,35 @@
+package spamc
+
+import "bytes"
+
+// GTUBEMessage returns a message with the GTUBE string, which every
+// SpamAssassin installation should flag as spam. Use this in integration tests
+// and self-tests, rather than building a message by hand.
+//
+// A new reader is returned on every call.
+func GTUBEMessage() *bytes.Reader {
+	return BuildMessage(map[string][]string{
+		"From":       {"sender@example.com"},
+		"To":         {"recipient@example.com"},
+		"Subject":    {"spamc GTUBE test"},
+		"Date":       {"Mon, 2 Jan 2006 15:04:05 +0000"},
+		"Message-Id": {"<gtube@spamc.example.com>"},
+	}, "This is the GTUBE, the Generic Test for Unsolicited Bulk Email.\n\n"+
+		gtube+"\n")
+}
+
+// HamMessage returns a minimal message with all the required headers, which a
+// SpamAssassin installation with the default rules shouldn't flag as spam.
+//
+// A new reader is returned on every call.
+func HamMessage() *bytes.Reader {
+	return BuildMessage(map[string][]string{
+		"From":       {"sender@example.com"},
+		"To":         {"recipient@example.com"},
+		"Subject":    {"Meeting notes"},
+		"Date":       {"Mon, 2 Jan 2006 15:04:05 +0000"},
+		"Message-Id": {"<ham@spamc.example.com>"},
+	}, "Hi,\n\nThe notes from today's meeting are below.\n\n"+
+		"- Review the open issues before Friday.\n"+
+		"- Next meeting is on Monday.\n\nRegards,\nSender\n")
+}
@@ -0,0 +1,36 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestSampleMessages(t *testing.T) {
+	cases := []struct {
+		in   func() *bytes.Reader
+		want bool
+	}{
+		{GTUBEMessage, true},
+		{HamMessage, false},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			v, err := HeuristicScore(context.Background(), tc.in())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.IsSpam != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", v.IsSpam, tc.want)
+			}
+			if !tc.want && len(v.Symbols) > 0 {
+				t.Errorf("ham matched symbols: %v", v.Symbols)
+			}
+			if tc.in().Size() == 0 {
+				t.Error("empty reader")
+			}
+		})
+	}
+}
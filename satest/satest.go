@@ -0,0 +1,199 @@
+// Package satest runs tests against a real SpamAssassin instance.
+//
+// Start() attaches to the spamd at SPAMC_SA_ADDRESS if it's set, or starts a
+// SpamAssassin Docker container and stops it again on Close():
+//
+//   func TestMain(m *testing.M) {
+//       srv, err := satest.Start(context.Background(), satest.DefaultImage)
+//       if err != nil {
+//           fmt.Fprintln(os.Stderr, err)
+//           os.Exit(1)
+//       }
+//       code := m.Run()
+//       srv.Close()
+//       os.Exit(code)
+//   }
+//
+//   func TestFilter(t *testing.T) {
+//       satest.AssertSpam(t, srv.Client(), spamc.GTUBEMessage())
+//   }
+//
+// The image is built from the Dockerfile in the root of this repository with:
+//
+//   docker build --tag teamwork/spamc:test .
+package satest // import "github.com/teamwork/spamc/satest"
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/spamc"
+)
+
+// EnvAddress is the environment variable with the address of an existing
+// spamd instance; no container is started if it's set.
+const EnvAddress = "SPAMC_SA_ADDRESS"
+
+// DefaultImage is the Docker image that's started by Start().
+const DefaultImage = "teamwork/spamc:test"
+
+// spamdPort is the port that spamd listens on in the container.
+const spamdPort = "783/tcp"
+
+// Server is a running SpamAssassin instance.
+type Server struct {
+	// Addr is the address of spamd.
+	Addr string
+
+	container string
+}
+
+// Start a SpamAssassin container from image and wait until it's ready, or
+// attach to the spamd at SPAMC_SA_ADDRESS if it's set. Starting SpamAssassin
+// can take a while; use a context with a deadline to limit the time spent
+// waiting.
+func Start(ctx context.Context, image string) (*Server, error) {
+	if addr := os.Getenv(EnvAddress); addr != "" {
+		s := &Server{Addr: addr}
+		return s, WaitReady(ctx, s.Client())
+	}
+
+	id, err := docker(ctx, "run", "--detach", "--publish-all", image)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not start container")
+	}
+	s := &Server{container: id}
+
+	port, err := docker(ctx, "port", id, spamdPort)
+	if err != nil {
+		s.Close() // nolint: errcheck
+		return nil, errors.Wrap(err, "could not get port")
+	}
+	s.Addr, err = hostAddr(port)
+	if err != nil {
+		s.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	if err := WaitReady(ctx, s.Client()); err != nil {
+		s.Close() // nolint: errcheck
+		return nil, err
+	}
+	return s, nil
+}
+
+// Client returns a new Client for the server.
+func (s *Server) Client(opts ...spamc.Option) *spamc.Client {
+	return spamc.New(s.Addr, &net.Dialer{Timeout: 5 * time.Second}, opts...)
+}
+
+// Close removes the container if it was started by Start(). The server
+// remains running if Start() attached to SPAMC_SA_ADDRESS.
+func (s *Server) Close() error {
+	if s.container == "" {
+		return nil
+	}
+	_, err := docker(context.Background(), "rm", "--force", s.container)
+	return errors.Wrap(err, "could not remove container")
+}
+
+// WaitReady waits until spamd responds to a PING, or until the context is
+// done.
+func WaitReady(ctx context.Context, c *spamc.Client) error {
+	for {
+		err := c.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, "spamd not ready")
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// docker runs the docker command and returns the trimmed output.
+func docker(ctx context.Context, args ...string) (string, error) {
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "docker %v: %v", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// hostAddr returns the address to connect to from the output of "docker port",
+// which lists one address per line, such as "0.0.0.0:32768" and
+// "[::]:32768".
+func hostAddr(port string) (string, error) {
+	for _, line := range strings.Split(port, "\n") {
+		host, p, err := net.SplitHostPort(strings.TrimSpace(line))
+		if err != nil {
+			continue
+		}
+		switch host {
+		case "0.0.0.0", "":
+			host = "127.0.0.1"
+		case "::":
+			host = "::1"
+		}
+		return net.JoinHostPort(host, p), nil
+	}
+	return "", errors.Errorf("unexpected output from docker port: %q", port)
+}
+
+// TB is the subset of testing.TB used by the assertions.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// AssertSpam checks msg and fails the test if it's not flagged as spam.
+func AssertSpam(t TB, c *spamc.Client, msg io.Reader) *spamc.ResponseSymbols {
+	t.Helper()
+	r := symbols(t, c, msg)
+	if r != nil && !r.IsSpam {
+		t.Errorf("not spam: score %v/%v, symbols %v", r.Score, r.BaseScore, r.Symbols)
+	}
+	return r
+}
+
+// AssertHam checks msg and fails the test if it's flagged as spam.
+func AssertHam(t TB, c *spamc.Client, msg io.Reader) *spamc.ResponseSymbols {
+	t.Helper()
+	r := symbols(t, c, msg)
+	if r != nil && r.IsSpam {
+		t.Errorf("spam: score %v/%v, symbols %v", r.Score, r.BaseScore, r.Symbols)
+	}
+	return r
+}
+
+// AssertScore fails the test if the score of r isn't between min and max.
+func AssertScore(t TB, r spamc.Result, min, max float64) {
+	t.Helper()
+	if s := r.SpamScore(); s < min || s > max {
+		t.Errorf("score %v not between %v and %v", s, min, max)
+	}
+}
+
+func symbols(t TB, c *spamc.Client, msg io.Reader) *spamc.ResponseSymbols {
+	t.Helper()
+	r, err := c.Symbols(context.Background(), msg, nil)
+	if err != nil {
+		t.Fatalf("could not check message: %v", err)
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,105 @@
+package satest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/teamwork/spamc"
+)
+
+func TestHostAddr(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"0.0.0.0:32768", "127.0.0.1:32768"},
+		{"0.0.0.0:32768\n[::]:32768", "127.0.0.1:32768"},
+		{"[::]:32768", "[::1]:32768"},
+		{"10.0.0.5:783", "10.0.0.5:783"},
+		{"", ""},
+		{"not an address", ""},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out, err := hostAddr(tc.in)
+			if tc.want == "" && err == nil {
+				t.Fatalf("no error for %q", tc.in)
+			}
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestStartAttach(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close() // nolint: errcheck
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Read(make([]byte, 512))
+			_, _ = conn.Write([]byte("SPAMD/1.5 0 PONG\r\n"))
+			_ = conn.Close()
+		}
+	}()
+
+	os.Setenv(EnvAddress, l.Addr().String()) // nolint: errcheck
+	defer os.Unsetenv(EnvAddress)            // nolint: errcheck
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, err := Start(ctx, DefaultImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Addr != l.Addr().String() {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", s.Addr, l.Addr().String())
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+type fakeTB struct{ errors []string }
+
+func (t *fakeTB) Helper() {}
+func (t *fakeTB) Fatalf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertScore(t *testing.T) {
+	cases := []struct {
+		score    float64
+		min, max float64
+		wantErr  bool
+	}{
+		{5, 1, 10, false},
+		{1, 1, 1, false},
+		{0.5, 1, 10, true},
+		{11, 1, 10, true},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			tb := &fakeTB{}
+			AssertScore(tb, &spamc.ResponseCheck{ResponseScore: spamc.ResponseScore{Score: tc.score}}, tc.min, tc.max)
+			if (len(tb.errors) > 0) != tc.wantErr {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", tb.errors, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package spamc
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SocketOptions are set on TCP connections to spamd after connecting; they're
+// ignored for other types of connections.
+//
+// Other options can be set with a custom Dialer, for example with the Control
+// function of a net.Dialer:
+//
+//   New(addr, &net.Dialer{
+//       Timeout: 20 * time.Second,
+//       Control: func(network, address string, c syscall.RawConn) error {
+//           // Set options with c.Control()
+//       },
+//   })
+type SocketOptions struct {
+	// KeepAlive is the period between TCP keep-alive probes. Keep-alives are
+	// disabled if this is negative, and the dialer's setting is used if it's
+	// 0.
+	KeepAlive time.Duration
+
+	// Delay disables TCP_NODELAY, so that small writes are coalesced.
+	// TCP_NODELAY is enabled by default.
+	Delay bool
+
+	// Linger sets SO_LINGER, the time Close() waits for unsent data to be
+	// sent; it's rounded up to whole seconds. The OS default is used if this
+	// is 0, and unsent data is discarded if this is negative.
+	Linger time.Duration
+}
+
+// apply the options to the connection.
+func (o SocketOptions) apply(conn net.Conn) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case o.KeepAlive < 0:
+		if err := tc.SetKeepAlive(false); err != nil {
+			return errors.Wrap(err, "could not disable keep-alive")
+		}
+	case o.KeepAlive > 0:
+		if err := tc.SetKeepAlive(true); err != nil {
+			return errors.Wrap(err, "could not enable keep-alive")
+		}
+		if err := tc.SetKeepAlivePeriod(o.KeepAlive); err != nil {
+			return errors.Wrap(err, "could not set keep-alive period")
+		}
+	}
+
+	if o.Delay {
+		if err := tc.SetNoDelay(false); err != nil {
+			return errors.Wrap(err, "could not disable TCP_NODELAY")
+		}
+	}
+
+	if o.Linger != 0 {
+		if err := tc.SetLinger(lingerSeconds(o.Linger)); err != nil {
+			return errors.Wrap(err, "could not set SO_LINGER")
+		}
+	}
+
+	return nil
+}
+
+// lingerSeconds converts d to the seconds for SetLinger(). Positive durations
+// are rounded up, as 0 would discard unsent data instead of waiting for it.
+func lingerSeconds(d time.Duration) int {
+	if d < 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
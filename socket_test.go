@@ -0,0 +1,66 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSocketOptions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer l.Close() // nolint: errcheck
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			io.Copy(ioutil.Discard, conn)              // nolint: errcheck
+			conn.Write([]byte("SPAMD/1.5 0 PONG\r\n")) // nolint: errcheck
+			conn.Close()                               // nolint: errcheck
+		}
+	}()
+
+	for _, o := range []SocketOptions{
+		{},
+		{KeepAlive: 30 * time.Second, Delay: true, Linger: 2 * time.Second},
+		{KeepAlive: -1, Linger: -1},
+		{Linger: 500 * time.Millisecond},
+	} {
+		c := New(l.Addr().String(), nil, WithSocketOptions(o))
+		if err := c.Ping(context.Background()); err != nil {
+			t.Errorf("%#v: %v", o, err)
+		}
+	}
+}
+
+func TestLingerSeconds(t *testing.T) {
+	cases := []struct {
+		in   time.Duration
+		want int
+	}{
+		{-1, 0},
+		{-5 * time.Second, 0},
+		{time.Nanosecond, 1},
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{2 * time.Second, 2},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := lingerSeconds(tc.in)
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
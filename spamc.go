@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"net"
 	"net/textproto"
 	"os"
@@ -36,44 +39,201 @@ const (
 // Server protocol version we understand.
 var serverProtocolVersions = []string{"1.0", "1.1"}
 
+// Exit codes used by spamd and spamc; see sysexits.h.
+const (
+	ExOK          = 0  // Successful termination; for spamc: message is ham.
+	ExIsSpam      = 1  // Message is spam; only used by spamc.
+	ExUsage       = 64 // Command line usage error.
+	ExDataErr     = 65 // Data format error.
+	ExNoInput     = 66 // Cannot open input.
+	ExNoUser      = 67 // Addressee unknown.
+	ExNoHost      = 68 // Host name unknown.
+	ExUnavailable = 69 // Service unavailable.
+	ExSoftware    = 70 // Internal software error.
+	ExOSErr       = 71 // System error.
+	ExOSFile      = 72 // Critical OS file missing.
+	ExCantCreat   = 73 // Can't create (user) output file.
+	ExIOErr       = 74 // Input/output error.
+	ExTempFail    = 75 // Temp failure; user is invited to retry.
+	ExProtocol    = 76 // Remote error in protocol.
+	ExNoPerm      = 77 // Permission denied.
+	ExConfig      = 78 // Configuration error.
+	ExTimeout     = 79 // Read timeout.
+)
+
 // mapping of the error codes to the error messages.
 var errorMessages = map[int]string{
-	64: "Command line usage error",               // EX_USAGE
-	65: "Data format error",                      // EX_DATA_ERR
-	66: "Cannot open input",                      // EX_NO_INPUT
-	67: "Addressee unknown",                      // EX_NO_USER
-	68: "Host name unknown",                      // EX_NO_HOST
-	69: "Service unavailable",                    // EX_UNAVAILABLE
-	70: "Internal software error",                // EX_SOFTWARE
-	71: "System error",                           // EX_OSERR
-	72: "Critical OS file missing",               // EX_OSFILE
-	73: "Can't create (user) output file",        // EX_CANTCREAT
-	74: "Input/output error",                     // EX_IOERR
-	75: "Temp failure; user is invited to retry", // EX_TEMPFAIL
-	76: "Remote error in protocol",               // EX_PROTOCOL
-	77: "Permission denied",                      // EX_NOPERM
-	78: "Configuration error",                    // EX_CONFIG
-	79: "Read timeout",                           // EX_TIMEOUT
-}
-
-// send a command to spamd.
-func (c *Client) send(
+	ExUsage:       "Command line usage error",
+	ExDataErr:     "Data format error",
+	ExNoInput:     "Cannot open input",
+	ExNoUser:      "Addressee unknown",
+	ExNoHost:      "Host name unknown",
+	ExUnavailable: "Service unavailable",
+	ExSoftware:    "Internal software error",
+	ExOSErr:       "System error",
+	ExOSFile:      "Critical OS file missing",
+	ExCantCreat:   "Can't create (user) output file",
+	ExIOErr:       "Input/output error",
+	ExTempFail:    "Temp failure; user is invited to retry",
+	ExProtocol:    "Remote error in protocol",
+	ExNoPerm:      "Permission denied",
+	ExConfig:      "Configuration error",
+	ExTimeout:     "Read timeout",
+}
+
+// command sends a command to spamd and reads the response headers. The
+// connection is closed if there was an error; otherwise the caller is
+// responsible for closing it.
+//
+// The message is compressed with zlib if compress is set.
+func (c *Client) command(
+	ctx context.Context,
+	cmd string,
+	message io.Reader,
+	headers Header,
+	compress bool,
+) (respConn, Header, *textproto.Reader, error) {
+	return c.commandTo(ctx, "", cmd, message, headers, compress)
+}
+
+// commandTo is command(), but sends the command to addr; the address is
+// selected with route() if it's empty.
+func (c *Client) commandTo(
 	ctx context.Context,
+	addr string,
 	cmd string,
 	message io.Reader,
 	headers Header,
-) (io.ReadCloser, error) {
+	compress bool,
+) (respConn, Header, *textproto.Reader, error) {
+
+	var offset int64
+	if s, ok := message.(io.Seeker); ok && c.Retry.Attempts > 1 {
+		offset, _ = s.Seek(0, io.SeekCurrent)
+	}
+
+	for attempt := 1; ; attempt++ {
+		read, sent, err := c.sendTo(ctx, addr, cmd, message, headers, compress)
+		if err != nil {
+			if c.retry(ctx, attempt, cmd, message, offset, sent, err) {
+				continue
+			}
+			err = errors.Wrap(err, "error sending command to spamd")
+			if sent {
+				err = ambiguous(cmd, err)
+			}
+			return respConn{}, nil, nil, err
+		}
+
+		respHeaders, tp, err := readResponse(read)
+		if err != nil {
+			read.done.fail(err)
+			read.Close() // nolint: errcheck
+			if c.retry(ctx, attempt, cmd, message, offset, true, err) {
+				continue
+			}
+			return respConn{}, nil, nil, ambiguous(cmd,
+				errors.Wrap(err, "could not parse spamd response"))
+		}
+
+		return read, respHeaders, tp, nil
+	}
+}
+
+// sendTo sends a command to the spamd at addr; the address is selected with
+// route() if it's empty. The message is compressed with zlib if compress or
+// the Client's Compress is set.
+//
+// The sent return value reports if writing the command to spamd was started;
+// spamd may have received the full command if there's an error after that,
+// for example if closing the connection for writing failed.
+func (c *Client) sendTo(
+	ctx context.Context,
+	addr string,
+	cmd string,
+	message io.Reader,
+	headers Header,
+	compress bool,
+) (respConn, bool, error) {
+
+	if strings.TrimSpace(cmd) == "" {
+		return respConn{}, false, errors.New("empty command")
+	}
+	if c.conns.isClosed() {
+		return respConn{}, false, ErrClientClosed
+	}
 
-	conn, err := c.dial(ctx)
+	message, headers, err := c.prepare(message, headers)
 	if err != nil {
-		return nil, errors.Wrapf(err, "could not dial to %v", c.addr)
+		return respConn{}, false, err
+	}
+	if w := teeFromContext(ctx); w != nil {
+		message = io.TeeReader(message, w)
+	}
+	if compress || c.Compress {
+		message, err = compressMessage(message, headers)
+		if err != nil {
+			return respConn{}, false, err
+		}
 	}
 
-	if err := c.write(conn, cmd, message, headers); err != nil {
-		return nil, err
+	var lim *limiter
+	if cmd != cmdPing {
+		lim = c.limiter
+	}
+	slot, err := lim.acquire(ctx)
+	if err != nil {
+		return respConn{}, false, err
 	}
 
-	return conn, nil
+	if addr == "" {
+		addr = c.route(headers)
+	}
+	var limit int
+	if cmd != cmdPing {
+		limit = c.backendLimit(addr)
+	}
+	if !c.conns.reserve(addr, limit) {
+		lim.release(slot)
+		return respConn{}, false, ErrBackendsFull
+	}
+
+	start := time.Now()
+	done := c.newCmdDone(ctx, cmd, addr, headers, start)
+	conn, err := c.dial(ctx, addr)
+	if c.health.record(addr, time.Since(start), err) {
+		c.log().Info("spamd backend recovered", "addr", addr)
+	}
+	if err != nil {
+		c.conns.unreserve(addr)
+		lim.release(slot)
+		c.log().Warn("could not connect to spamd", "addr", addr, "error", err)
+		done.fail(err)
+		done.finish()
+		return respConn{}, false, errors.Wrapf(err, "could not dial to %v", addr)
+	}
+	if lim != nil {
+		conn = &limitedConn{Conn: conn, limiter: lim, waiter: slot}
+	}
+	conn, err = c.conns.track(conn, addr)
+	if err != nil {
+		return respConn{}, false, err
+	}
+
+	var wire *Wire
+	if c.Debug {
+		wire = newWire(c.DebugBodyLimit)
+	}
+	if err := writeCommand(conn, cmd, message, headers, wire); err != nil {
+		conn.Close() // nolint: errcheck
+		c.log().Warn("could not send command to spamd", "addr", addr, "cmd", cmd, "error", err)
+		done.fail(err)
+		done.finish()
+		return respConn{}, true, err
+	}
+
+	user, _ := headers.Get("User")
+	return respConn{Conn: conn, addr: addr, user: user, wire: wire, done: done}, true, nil
 }
 
 // write the command to the connection.
@@ -88,66 +248,211 @@ func (c *Client) write(
 		return errors.New("empty command")
 	}
 
-	if headers == nil {
-		headers = make(Header)
-	}
-	if _, ok := headers.Get("User"); !ok && c.DefaultUser != "" {
-		headers.Set("User", c.DefaultUser)
+	message, headers, err := c.prepare(message, headers)
+	if err != nil {
+		return err
 	}
 
-	buf := bytes.NewBufferString("")
-	tp := textproto.NewWriter(bufio.NewWriter(buf))
+	return writeCommand(conn, cmd, message, headers, nil)
+}
 
-	// Attempt to get the size if it wasn't explicitly given.
-	if _, ok := headers.Get("Content-Length"); !ok {
-		size, err := sizeFromReader(message)
-		if err != nil {
-			return errors.Wrap(err, "could not determine size of message")
-		}
-		headers.Set("Content-length", fmt.Sprintf("%v", size))
-	}
+// writeCommand writes the command with a message and headers which have
+// already been prepared with Client.prepare() to the connection. The command
+// line and headers are recorded in wire if it's not nil.
+func writeCommand(
+	conn net.Conn,
+	cmd string,
+	message io.Reader,
+	headers Header,
+	wire *Wire,
+) error {
 
-	err := tp.PrintfLine("%v SPAMC/%v", cmd, clientProtocolVersion)
+	l, _ := headers.Get("Content-length")
+	size, err := strconv.ParseInt(l, 10, 64)
 	if err != nil {
-		return err
+		return errors.Errorf("invalid Content-length: %q", l)
 	}
 
-	for _, v := range headers.Iterate() {
-		if err := tp.PrintfLine("%v: %v", v[0], v[1]); err != nil {
-			return err
-		}
-	}
+	buf := getBuffer()
+	defer putBuffer(buf)
 
-	if err := tp.PrintfLine(""); err != nil {
-		return err
-	}
-	if err := tp.W.Flush(); err != nil {
-		return err
+	writeRequestHeader(buf, cmd, headers)
+	if wire != nil {
+		wire.Request = append([]byte(nil), buf.Bytes()...)
 	}
 
 	// Write to spamd.
-	if _, err := io.Copy(conn, io.MultiReader(buf, message)); err != nil {
+	cbuf := getCopyBuffer()
+	defer putCopyBuffer(cbuf)
+	cr := &countReader{r: io.LimitReader(message, size)}
+	if err := writeBuffered(conn, buf.Bytes(), cr, *cbuf); err != nil {
 		conn.Close() // nolint: errcheck
-		return errors.Wrap(err, "could not send to spamd")
+		return errors.Wrap(newOpError("write", remoteAddr(conn), err),
+			"could not send to spamd")
+	}
+
+	// Abort the command if the size doesn't match, as spamd would either
+	// wait for more data or silently truncate the message.
+	actual := cr.n
+	if actual == size {
+		if n, _ := message.Read((*cbuf)[:1]); n > 0 {
+			actual = -1
+		}
+	}
+	if actual != size {
+		conn.Close() // nolint: errcheck
+		return &ContentLengthError{Header: size, Actual: actual}
 	}
 
 	// Close connection for writing; this makes sure all buffered data is sent.
-	switch cc := conn.(type) {
-	case *net.TCPConn:
-		return cc.CloseWrite()
-	case *net.UnixConn:
+	if cc, ok := conn.(closeWriter); ok {
 		return cc.CloseWrite()
 	}
 
 	return nil
 }
 
+// writeRequestHeader writes the command line and headers to buf.
+func writeRequestHeader(buf *bytes.Buffer, cmd string, headers Header) {
+	buf.WriteString(cmd)
+	buf.WriteString(" SPAMC/")
+	buf.WriteString(clientProtocolVersion)
+	buf.WriteString("\r\n")
+
+	// Sort the keys in a fixed-size array; this avoids allocations for the
+	// usual number of headers.
+	var keysArr [8]string
+	keys := keysArr[:0]
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sortStrings(keys)
+	for _, k := range keys {
+		buf.WriteString(k)
+		buf.WriteString(": ")
+		buf.WriteString(headers[k])
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("\r\n")
+}
+
+// prepare the message and headers for sending by running the Preprocessor and
+// adding the Content-length, User, and default headers if they're not set yet.
+//
+// The returned message should be used instead of the passed one, as it may
+// have been read from. The returned headers are a copy; the passed headers are
+// never modified, as they may be sent again on retries.
+//
+// The Compress header is removed, as the message isn't compressed yet; it's
+// set by compressMessage().
+func (c *Client) prepare(message io.Reader, headers Header) (io.Reader, Header, error) {
+	orig := headers
+	headers = make(Header, len(orig)+len(c.DefaultHeaders)+2)
+	for k, v := range orig {
+		headers[k] = v
+	}
+
+	if c.Preprocessor != nil {
+		var err error
+		message, err = c.Preprocessor.Preprocess(message)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "could not preprocess message")
+		}
+		// The size has most likely changed.
+		delete(headers, headers.normalizeKey("Content-length"))
+	}
+
+	// Attempt to get the size if it wasn't explicitly given, and verify it if
+	// it was.
+	if l, ok := headers.Get("Content-Length"); !ok {
+		size, err := sizeFromReader(message)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "could not determine size of message")
+		}
+		headers.Set("Content-length", strconv.FormatInt(size, 10))
+	} else if size, err := sizeFromReader(message); err == nil && l != strconv.FormatInt(size, 10) {
+		if !c.FixContentLength {
+			hsize, _ := strconv.ParseInt(l, 10, 64)
+			return nil, nil, &ContentLengthError{Header: hsize, Actual: size}
+		}
+		headers.Set("Content-length", strconv.FormatInt(size, 10))
+	}
+
+	if _, ok := headers.Get("User"); !ok {
+		user := ""
+		if c.UserFromMessage != nil {
+			var h textproto.MIMEHeader
+			h, message = peekHeader(message)
+			user = c.UserFromMessage(h)
+		}
+		if user == "" {
+			user = c.DefaultUser
+		}
+		if user != "" {
+			headers.Set("User", user)
+		}
+	}
+
+	for k, v := range c.DefaultHeaders {
+		if _, ok := headers.Get(k); !ok {
+			headers[headers.normalizeKey(k)] = v
+		}
+	}
+
+	if _, ok := headers.Get("Compress"); ok {
+		c.log().Warn("ignoring Compress header; use WithCompression() to compress messages")
+		delete(headers, headers.normalizeKey("Compress"))
+	}
+
+	for k, v := range headers {
+		if err := checkHeader(k, v); err != nil {
+			return nil, nil, err
+		}
+		if knownHeaders[k] {
+			continue
+		}
+		if c.StrictHeaders {
+			return nil, nil, errors.Errorf("unknown header %q", k)
+		}
+		c.log().Warn("sending header that spamd will ignore", "header", k)
+	}
+
+	return message, headers, nil
+}
+
+// knownHeaders are the request headers that spamd uses, with normalized
+// casing.
+var knownHeaders = map[string]bool{
+	"Content-length":   true,
+	"User":             true,
+	"Compress":         true,
+	HeaderMessageClass: true,
+	HeaderSet:          true,
+	HeaderRemove:       true,
+}
+
+// peekHeader reads the header of the message in r. The returned reader will
+// return the full message, including the header.
+//
+// Errors are not reported, as not all messages will have a valid header; the
+// header is empty or incomplete in those cases.
+func peekHeader(r io.Reader) (textproto.MIMEHeader, io.Reader) {
+	buf := bytes.NewBufferString("")
+	h, _ := textproto.NewReader(bufio.NewReader(io.TeeReader(r, buf))).ReadMIMEHeader()
+	if h == nil {
+		h = make(textproto.MIMEHeader)
+	}
+	return h, io.MultiReader(buf, r)
+}
+
 func sizeFromReader(r io.Reader) (int64, error) {
 	switch v := r.(type) {
 	case *strings.Reader:
 		return v.Size(), nil
 	case *bytes.Reader:
 		return v.Size(), nil
+	case *io.SectionReader:
+		return v.Size(), nil
 	case *os.File:
 		stat, err := v.Stat()
 		if err != nil {
@@ -160,27 +465,141 @@ func sizeFromReader(r io.Reader) (int64, error) {
 
 }
 
-func (c *Client) dial(ctx context.Context) (net.Conn, error) {
-	conn, err := c.dialer.DialContext(ctx, "tcp", c.addr)
+// route returns the address to send a command with these headers to.
+func (c *Client) route(headers Header) string {
+	if c.Router != nil {
+		user, ok := headers.Get("User")
+		if !ok {
+			user = c.DefaultUser
+		}
+		if addr := c.Router.Route(user); addr != "" {
+			return addr
+		}
+	}
+
+	if addr := c.pickBackend(""); addr != "" {
+		return addr
+	}
+	return c.addr
+}
+
+func (c *Client) dial(ctx context.Context, addr string) (net.Conn, error) {
+	timeout := c.timeout()
+	dialCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	conn, err := c.dialer.DialContext(dialCtx, "tcp", addr)
 	if err != nil {
 		if conn != nil {
 			conn.Close() // nolint: errcheck
 		}
-		return nil, errors.Wrap(err, "could not connect to spamd")
+		return nil, errors.Wrap(newOpError("dial", addr, err),
+			"could not connect to spamd")
 	}
 
-	// Set connection timeout
-	if ndial, ok := c.dialer.(*net.Dialer); ok {
-		err = conn.SetDeadline(time.Now().Add(ndial.Timeout))
+	if err := c.Socket.apply(conn); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	// Refresh the deadline on every read and write, instead of using a single
+	// deadline for the entire command.
+	if c.IdleTimeout > 0 {
+		conn = &idleConn{Conn: conn, timeout: c.IdleTimeout}
+	} else if timeout > 0 {
+		err = conn.SetDeadline(time.Now().Add(timeout))
 		if err != nil {
 			conn.Close() // nolint: errcheck
 			return nil, errors.Wrap(err, "connection to spamd timed out")
 		}
 	}
 
+	if c.TLSConfig != nil {
+		tconn := tls.Client(conn, tlsConfig(c.TLSConfig, addr))
+		if err := tconn.Handshake(); err != nil {
+			conn.Close() // nolint: errcheck
+			return nil, errors.Wrap(newOpError("dial", addr, err),
+				"TLS handshake with spamd failed")
+		}
+		conn = tconn
+	}
+
 	return conn, nil
 }
 
+// remoteAddr gets the remote address of the connection as a string, or an
+// empty string if it's not known.
+func remoteAddr(conn net.Conn) string {
+	if a := conn.RemoteAddr(); a != nil {
+		return a.String()
+	}
+	return ""
+}
+
+// closeWriter is implemented by connections that can be closed for writing,
+// such as *net.TCPConn and *net.UnixConn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// idleConn extends the deadline of the connection before every read and
+// write.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *idleConn) CloseWrite() error {
+	if cc, ok := c.Conn.(closeWriter); ok {
+		return cc.CloseWrite()
+	}
+	return nil
+}
+
+// tlsConfig returns cfg with the ServerName set to the host in addr, if it's
+// not set yet.
+func tlsConfig(cfg *tls.Config, addr string) *tls.Config {
+	if cfg.ServerName != "" || cfg.InsecureSkipVerify {
+		return cfg
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	cfg = cfg.Clone()
+	cfg.ServerName = host
+	return cfg
+}
+
+// timeout gets the command timeout.
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	if ndial, ok := c.dialer.(*net.Dialer); ok {
+		return ndial.Timeout
+	}
+	return 0
+}
+
 // The spamd protocol is a HTTP-esque protocol; a response's first line is the
 // response code:
 //
@@ -205,6 +624,9 @@ func readResponse(read io.Reader) (Header, *textproto.Reader, error) {
 
 	tpHeader, err := tp.ReadMIMEHeader()
 	if err != nil {
+		if _, ok := err.(textproto.ProtocolError); ok {
+			err = &ProtocolError{msg: err.Error()}
+		}
 		return nil, tp, errors.Wrap(err, "could not read headers")
 	}
 
@@ -217,16 +639,31 @@ func readResponse(read io.Reader) (Header, *textproto.Reader, error) {
 }
 
 func parseCodeLine(tp *textproto.Reader, isPing bool) error {
+	_, _, err := readCodeLine(tp, isPing, nil)
+	return err
+}
+
+// readCodeLine parses the response code line, returning the protocol version
+// and the text after the code.
+//
+// For PING responses an unexpected version is an error, unless skew is set; in
+// which case skew is called with the version.
+func readCodeLine(
+	tp *textproto.Reader,
+	isPing bool,
+	skew func(version string),
+) (string, string, error) {
+
 	line, err := tp.ReadLine()
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	if len(line) < 11 {
-		return errors.Errorf("short response: %v", line)
+		return "", "", protocolErrorf("short response: %v", line)
 	}
 	if !strings.HasPrefix(line, "SPAMD/") {
-		return errors.Errorf("unrecognised response: %v", line)
+		return "", "", protocolErrorf("unrecognised response: %v", line)
 	}
 
 	version := line[6:9]
@@ -235,14 +672,17 @@ func parseCodeLine(tp *textproto.Reader, isPing bool) error {
 	// rather than the server version.
 	if isPing {
 		if version != clientProtocolVersion {
-			return errors.Errorf("unexpected version: %v; we expected %v",
-				version, clientProtocolVersion)
+			if skew == nil {
+				return "", "", protocolErrorf("unexpected version: %v; we expected %v",
+					version, clientProtocolVersion)
+			}
+			skew(version)
 		}
 	} else {
 		// in some errors it uses version 1.0, so accept both 1.0 and 1.1.
 		//     spamd/1.0 76 bad header line: asdasd
 		if !supportedVersion(version) {
-			return errors.Errorf(
+			return "", "", protocolErrorf(
 				"unknown server protocol version %v; we only understand versions %v",
 				version, serverProtocolVersions)
 		}
@@ -251,17 +691,18 @@ func parseCodeLine(tp *textproto.Reader, isPing bool) error {
 	s := strings.Split(line[10:], " ")
 	code, err := strconv.Atoi(s[0])
 	if err != nil {
-		return errors.Wrap(err, "could not parse return code")
+		return "", "", protocolErrorf("could not parse return code: %v", err)
 	}
+	text := strings.Join(s[1:], " ")
 	if code != 0 {
-		text := strings.Join(s[1:], " ")
-		if msg, ok := errorMessages[code]; ok {
-			return errors.Errorf("spamd returned code %v: %v: %v", code, msg, text)
+		msg := fmt.Sprintf("spamd returned code %v: %v", code, text)
+		if m, ok := errorMessages[code]; ok {
+			msg = fmt.Sprintf("spamd returned code %v: %v: %v", code, m, text)
 		}
-		return errors.Errorf("spamd returned code %v: %v", code, text)
+		return "", "", Error{msg: msg, Code: int64(code), Line: line}
 	}
 
-	return nil
+	return version, text, nil
 }
 
 func supportedVersion(v string) bool {
@@ -274,42 +715,64 @@ func supportedVersion(v string) bool {
 }
 
 func readBody(tp *textproto.Reader) (string, error) {
-	body := ""
-loop:
-	for {
-		line, err := tp.ReadLine()
-		switch err {
-		case nil:
-			// Do nothing
-		case io.EOF:
-			break loop
-		default:
-			return "", err
-		}
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := copyBody(buf, tp.R); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// readSymbols reads the comma-separated list of symbols from the body. Empty
+// symbols and symbols with spaces are returned as-is, with a warning.
+func readSymbols(tp *textproto.Reader) (SymbolSet, []string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
 
-		body += line + "\r\n"
+	if err := copyBody(buf, tp.R); err != nil {
+		return nil, nil, err
 	}
 
-	return body, nil
+	body := bytes.TrimSpace(buf.Bytes())
+	if len(body) == 0 {
+		return nil, nil, nil
+	}
+
+	var warnings []string
+	s := make(SymbolSet, 0, bytes.Count(body, []byte(","))+1)
+	for _, sym := range bytes.Split(body, []byte(",")) {
+		switch {
+		case len(sym) == 0:
+			warnings = append(warnings, "empty symbol")
+		case bytes.ContainsAny(sym, " \t\r\n"):
+			warnings = append(warnings, fmt.Sprintf("malformed symbol: %q", sym))
+		}
+		s = append(s, string(sym))
+	}
+	return s, warnings, nil
 }
 
 // Parse the Spam: response header:
 //    Spam <yes|no> ; <score> / <base-score>
 // example:
 //    Spam: yes ; 6.66 / 5.0
-func parseSpamHeader(respHeaders Header) (bool, float64, float64, error) {
+//
+// Some configurations omit the base score or send an invalid one; the base
+// score is 0 in that case, and a warning is returned.
+func parseSpamHeader(respHeaders Header) (bool, float64, float64, []string, error) {
 	spam, ok := respHeaders.Get("Spam")
 	if !ok || len(spam) == 0 {
-		return false, 0, 0, errors.New("header missing")
+		return false, 0, 0, nil, protocolErrorf("header missing")
 	}
 
 	if len(spam) == 0 {
-		return false, 0, 0, errors.New("header empty")
+		return false, 0, 0, nil, protocolErrorf("header empty")
 	}
 
 	s := strings.Split(spam, ";")
 	if len(s) != 2 {
-		return false, 0, 0, errors.Errorf("unexpected data: %v", spam[0])
+		return false, 0, 0, nil, protocolErrorf("unexpected data: %v", spam[0])
 	}
 
 	isSpam := false
@@ -319,40 +782,158 @@ func parseSpamHeader(respHeaders Header) (bool, float64, float64, error) {
 	case "false", "no":
 		isSpam = false
 	default:
-		return false, 0, 0, errors.Errorf("unknown spam status: %v", s[0])
+		return false, 0, 0, nil, protocolErrorf("unknown spam status: %v", s[0])
 	}
 
 	split := strings.Split(s[1], "/")
-	if len(split) != 2 {
-		return false, 0, 0, errors.Errorf("unexpected data: %v", s[1])
+	if len(split) > 2 {
+		return false, 0, 0, nil, protocolErrorf("unexpected data: %v", s[1])
 	}
-	score, err := strconv.ParseFloat(strings.TrimSpace(split[0]), 64)
+	score, err := parseFloat(strings.TrimSpace(split[0]))
 	if err != nil {
-		return false, 0, 0, errors.Errorf("could not parse spam score: %v", err)
+		return false, 0, 0, nil, protocolErrorf("could not parse spam score: %v", err)
 	}
-	baseScore, err := strconv.ParseFloat(strings.TrimSpace(split[1]), 64)
+
+	var (
+		baseScore float64
+		warnings  []string
+	)
+	switch {
+	case len(split) == 1 || strings.TrimSpace(split[1]) == "":
+		warnings = append(warnings, fmt.Sprintf("missing base score in Spam header: %q", spam))
+	default:
+		baseScore, err = parseFloat(strings.TrimSpace(split[1]))
+		switch {
+		case err != nil:
+			baseScore = 0
+			warnings = append(warnings, fmt.Sprintf("invalid base score in Spam header: %q", spam))
+		case baseScore < 0:
+			warnings = append(warnings, fmt.Sprintf("negative base score in Spam header: %q", spam))
+		}
+	}
+
+	return isSpam, score, baseScore, warnings, nil
+}
+
+// parseFloat parses a score. Besides the usual "1.6", this accepts exponents
+// ("1e+01"), which some plugins send, and a decimal comma ("1,6"), which is
+// used by some localized builds.
+func parseFloat(s string) (float64, error) {
+	if strings.Count(s, ",") == 1 && !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseScore reads the ResponseScore from the response headers, applying the
+// Client's Threshold.
+func (c *Client) parseScore(respHeaders Header) (ResponseScore, []string, error) {
+	isSpam, score, baseScore, warnings, err := parseSpamHeader(respHeaders)
 	if err != nil {
-		return false, 0, 0, errors.Errorf("could not parse base spam score: %v", err)
+		return ResponseScore{}, nil, errors.Wrap(err, "could not read Spam header")
 	}
 
-	return isSpam, score, baseScore, nil
+	if c.Threshold != 0 {
+		isSpam = score >= c.Threshold
+	}
+
+	return ResponseScore{
+		IsSpam:    isSpam,
+		Score:     score,
+		BaseScore: baseScore,
+		threshold: c.Threshold,
+	}, warnings, nil
+}
+
+// strictScore is parseScore() for RawResponse.Score() and Response.Score();
+// the warnings are an error with ParseStrict, and are ignored otherwise.
+func (c *Client) strictScore(respHeaders Header) (ResponseScore, error) {
+	score, warnings, err := c.parseScore(respHeaders)
+	if err != nil {
+		return score, err
+	}
+	if c.ParseMode == ParseStrict && len(warnings) > 0 {
+		return ResponseScore{}, protocolErrorf("could not parse Spam header: %v", warnings[0])
+	}
+	return score, nil
 }
 
 // Report contains the parsed results of the Report command.
 type Report struct {
+	// Intro is the text before the table, without the content preview.
 	Intro string
-	Table []struct {
-		Points      float64
-		Rule        string
-		Description string
-	}
+
+	// ContentPreview is the "Content preview:" paragraph, which contains the
+	// start of the message. It's unwrapped if it was spread over several
+	// lines.
+	ContentPreview string
+
+	Table []ReportRow
+
+	// Raw is the report exactly as it was sent by spamd, for applications
+	// that want to forward it verbatim. It's not modified by Filter().
+	Raw []byte
+}
+
+// ReportRow is a single rule in the report table. Fields may be added in the
+// future, so use keyed fields in composite literals.
+//
+// Long descriptions are wrapped by SpamAssassin; Description is the first
+// line, and Wrapped contains the indented lines after it as-is, so that
+// String() reproduces them exactly.
+type ReportRow struct {
+	Points      float64
+	Rule        string
+	Description string
+	Wrapped     []string
 }
 
-// String formats the reports like SpamAssassin.
+// String formats the reports like SpamAssassin. The ContentPreview is written
+// on a single line before the "Content analysis details:" paragraph.
 func (r Report) String() string {
-	table := " pts rule name              description\n"
-	table += "---- ---------------------- --------------------------------------------------\n"
+	return r.Format(ReportFormat{})
+}
+
+// ReportFormat are the options for Report.Format().
+type ReportFormat struct {
+	// RuleWidth is the width of the rule name column; this defaults to 22,
+	// as with SpamAssassin. Longer rule names push the description to the
+	// right.
+	RuleWidth int
 
+	// DescriptionWidth wraps descriptions to this width, with the wrapped
+	// lines indented to the description column. The descriptions are
+	// written as-is if this is 0, including the lines that SpamAssassin
+	// wrapped.
+	DescriptionWidth int
+
+	// OmitZero leaves out rules with a score of 0, which are usually
+	// informational; this is the same as SpamAssassin's old
+	// REPORT_IGNOREWARNING option, and as Filter(OmitZeroScore).
+	OmitZero bool
+}
+
+// Format the report with the given options, for example to render a compact
+// report:
+//
+//   r.Format(spamc.ReportFormat{RuleWidth: 16, DescriptionWidth: 40, OmitZero: true})
+func (r Report) Format(f ReportFormat) string {
+	ruleWidth := f.RuleWidth
+	if ruleWidth <= 0 {
+		ruleWidth = 22
+	}
+	sepWidth := f.DescriptionWidth
+	if sepWidth <= 0 {
+		sepWidth = 50
+	}
+	indent := strings.Repeat(" ", 4+1+ruleWidth+1)
+
+	table := fmt.Sprintf(" pts %-*s description\n", ruleWidth, "rule name")
+	table += "---- " + strings.Repeat("-", ruleWidth) + " " + strings.Repeat("-", sepWidth) + "\n"
+
+	if f.OmitZero {
+		r = r.Filter(OmitZeroScore)
+	}
 	for _, t := range r.Table {
 		leadingSpace := ""
 		if t.Points >= 0 && !mathutil.IsSignedZero(t.Points) {
@@ -360,19 +941,109 @@ func (r Report) String() string {
 		}
 
 		line := fmt.Sprintf("%v%.1f %v", leadingSpace, t.Points, t.Rule)
-		nspaces := 27 - len(line)
+		nspaces := 4 + 1 + ruleWidth - len(line)
 		spaces := " "
 		if nspaces > 0 {
 			spaces += strings.Repeat(" ", nspaces)
 		}
-		line += spaces + t.Description + "\n"
+
+		if f.DescriptionWidth <= 0 {
+			line += spaces + t.Description + "\n"
+			for _, w := range t.Wrapped {
+				line += w + "\n"
+			}
+			table += line
+			continue
+		}
+
+		desc := t.Description
+		for _, w := range t.Wrapped {
+			desc += " " + w
+		}
+		for i, l := range wrapText(desc, f.DescriptionWidth) {
+			if i == 0 {
+				line += spaces + l + "\n"
+			} else {
+				line += indent + l + "\n"
+			}
+		}
 		table += line
 	}
 
-	return r.Intro + "\n\n" + table
+	return r.intro() + "\n\n" + table
 }
 
-var reTableLine = regexp.MustCompile(`(-?[0-9.]+)\s+([A-Z0-9_]+)\s+(.+)`)
+// wrapText wraps the words in s to lines of at most width characters; words
+// longer than width are put on their own line.
+func wrapText(s string, width int) []string {
+	var (
+		lines []string
+		line  string
+	)
+	for _, w := range strings.Fields(s) {
+		switch {
+		case line == "":
+			line = w
+		case len(line)+1+len(w) <= width:
+			line += " " + w
+		default:
+			lines = append(lines, line)
+			line = w
+		}
+	}
+	return append(lines, line)
+}
+
+// intro returns the Intro with the ContentPreview.
+func (r Report) intro() string {
+	if r.ContentPreview == "" {
+		return r.Intro
+	}
+
+	preview := contentPreview + "  " + r.ContentPreview
+	switch i := strings.Index(r.Intro, contentDetails); {
+	case i >= 0:
+		return r.Intro[:i] + preview + "\n\n" + r.Intro[i:]
+	case r.Intro == "":
+		return preview
+	default:
+		return r.Intro + "\n\n" + preview
+	}
+}
+
+// Symbols returns the names of all rules in the report table.
+func (r Report) Symbols() SymbolSet {
+	s := make(SymbolSet, len(r.Table))
+	for i, t := range r.Table {
+		s[i] = t.Rule
+	}
+	return s
+}
+
+// OmitZeroScore is the minimum score for Filter() to remove only the rules with
+// a score of 0, as ReportFormat.OmitZero does.
+const OmitZeroScore = math.SmallestNonzeroFloat64
+
+// Filter returns a copy of the report with only the rules that have a score
+// of at least minAbsScore or at most -minAbsScore. Use OmitZeroScore to remove
+// the zero-score rules, as the legacy client's REPORT_IGNOREWARNING did.
+func (r Report) Filter(minAbsScore float64) Report {
+	table := make([]ReportRow, 0, len(r.Table))
+	for _, t := range r.Table {
+		if math.Abs(t.Points) >= minAbsScore {
+			table = append(table, t)
+		}
+	}
+	r.Table = table
+	return r
+}
+
+const (
+	contentPreview = "Content preview:"
+	contentDetails = "Content analysis details:"
+)
+
+var reTableLine = regexp.MustCompile(`(-?[0-9.,]+(?:[eE][-+]?[0-9]+)?)\s+([A-Z0-9_]+)\s+(.+)`)
 
 // parse report output; example report:
 //
@@ -392,54 +1063,98 @@ var reTableLine = regexp.MustCompile(`(-?[0-9.]+)\s+([A-Z0-9_]+)\s+(.+)`)
 // -0.0 NO_RELAYS              Informational: message was not relayed via SMTP
 //  1.2 MISSING_HEADERS        Missing To: header
 // -0.0 NO_RECEIVED            Informational: message has no Received headers
-func parseReport(tp *textproto.Reader) (Report, error) {
-	report := Report{}
+//
+// Table lines that can't be parsed are skipped, with a warning.
+func parseReport(tp *textproto.Reader) (Report, []string, error) {
+	raw, err := ioutil.ReadAll(tp.R)
+	if err != nil {
+		return Report{}, nil, err
+	}
+	r := bufio.NewReader(bytes.NewReader(raw))
+
+	report := Report{Raw: raw}
+	var warnings []string
 	table := false
+	preview := false
+
+	intro := getBuffer()
+	defer putBuffer(intro)
+	previewBuf := getBuffer()
+	defer putBuffer(previewBuf)
+	lineBuf := getBuffer()
+	defer putBuffer(lineBuf)
 
 	for {
-		line, err := tp.ReadLine()
+		line, err := readLine(r, lineBuf)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return report, err
+			return report, warnings, err
 		}
 
 		switch {
-		case !table && strings.HasPrefix(line, " pts rule name"):
+		case !table && bytes.HasPrefix(line, []byte(" pts rule name")):
 			table = true
+			preview = false
+
+		case !table && bytes.HasPrefix(line, []byte(contentPreview)):
+			preview = true
+			previewBuf.Write(bytes.TrimSpace(line[len(contentPreview):]))
+
+		// The preview paragraph ends at the first blank line, which is
+		// skipped as well.
+		case preview:
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				preview = false
+				continue
+			}
+			if previewBuf.Len() > 0 {
+				previewBuf.WriteByte(' ')
+			}
+			previewBuf.Write(line)
 
-		case table && strings.HasPrefix(line, "---- -"):
+		case table && bytes.HasPrefix(line, []byte("---- -")):
 			continue
 
 		case !table:
-			report.Intro += line + "\n"
+			intro.Write(line)
+			intro.WriteByte('\n')
 
-		case table:
-			s := reTableLine.FindAllStringSubmatch(line, -1)
-			if len(s) != 1 {
+		// Long descriptions are wrapped on indented lines.
+		case table && bytes.HasPrefix(line, []byte("     ")) && len(bytes.TrimSpace(line)) > 0:
+			if len(report.Table) == 0 {
+				warnings = append(warnings, fmt.Sprintf("malformed report line: %q", line))
 				continue
 			}
+			row := &report.Table[len(report.Table)-1]
+			row.Wrapped = append(row.Wrapped, string(line))
 
-			if len(s[0]) != 4 {
+		case table:
+			s := reTableLine.FindSubmatch(line)
+			if len(s) != 4 {
+				if len(bytes.TrimSpace(line)) > 0 {
+					warnings = append(warnings, fmt.Sprintf("malformed report line: %q", line))
+				}
 				continue
 			}
 
-			points, err := strconv.ParseFloat(s[0][1], 64)
+			points, err := parseFloat(string(s[1]))
 			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("invalid points in report line: %q", line))
 				continue
 			}
 
-			report.Table = append(report.Table, struct {
-				Points      float64
-				Rule        string
-				Description string
-			}{
-				points, s[0][2], s[0][3],
+			report.Table = append(report.Table, ReportRow{
+				Points:      points,
+				Rule:        string(s[2]),
+				Description: string(s[3]),
 			})
 		}
 	}
 
-	report.Intro = strings.TrimSpace(report.Intro)
-	return report, nil
+	report.Intro = string(bytes.TrimSpace(intro.Bytes()))
+	report.ContentPreview = previewBuf.String()
+	return report, warnings, nil
 }
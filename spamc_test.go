@@ -37,7 +37,7 @@ func TestWrite(t *testing.T) {
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
 			conn := fakeconn.New()
-			c := Client{conn: conn}
+			c := Client{}
 
 			err := c.write(conn, tc.inCmd, tc.inMsg, tc.inHeader)
 			out := conn.Written.String()
@@ -77,7 +77,7 @@ func TestWriteDefaultUser(t *testing.T) {
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
 			conn := fakeconn.New()
-			c := Client{conn: conn}
+			c := Client{}
 			c.DefaultUser = "default"
 
 			err := c.write(conn, tc.inCmd, strings.NewReader(tc.inMsg), tc.inHeader)
@@ -92,6 +92,55 @@ func TestWriteDefaultUser(t *testing.T) {
 	}
 }
 
+func TestWriteDefaultHeaders(t *testing.T) {
+	cases := []struct {
+		inHeader Header
+		want     string
+	}{
+		{
+			nil,
+			"CMD SPAMC/1.5\r\nContent-length: 7\r\nX-ext: a\r\n\r\nMessage",
+		},
+		{
+			Header{}.Set("X-Ext", "b"),
+			"CMD SPAMC/1.5\r\nContent-length: 7\r\nX-ext: b\r\n\r\nMessage",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			conn := fakeconn.New()
+			c := Client{}
+			// The Compress header is dropped, as the message isn't
+			// compressed; that's done with WithCompression().
+			WithDefaultHeaders(Header{"compress": "zlib", "x-ext": "a", "Content-length": "1"})(&c)
+
+			err := c.write(conn, "CMD", strings.NewReader("Message"), tc.inHeader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := conn.Written.String()
+			if out != tc.want {
+				t.Errorf("wrong data written\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteInvalidDefaultHeaders(t *testing.T) {
+	conn := fakeconn.New()
+	c := Client{}
+	WithDefaultHeaders(Header{"Message-class": "eggs"})(&c)
+
+	err := c.write(conn, "TELL", strings.NewReader("Message"), nil)
+	if !test.ErrorContains(err, "unknown value for Message-class header: eggs") {
+		t.Errorf("wrong error: %v", err)
+	}
+	if conn.Written.Len() != 0 {
+		t.Errorf("data written: %q", conn.Written.String())
+	}
+}
+
 func TestReadResponse(t *testing.T) {
 	cases := []struct {
 		in             string
@@ -172,61 +221,80 @@ func TestParseSpamHeader(t *testing.T) {
 		wantIsSpam               bool
 		wantScore, wantBaseScore float64
 		wantErr                  string
+		wantWarnings             []string
 	}{
 		// Invalid data
-		{Header{}, false, 0, 0, "header missing"},
-		{Header{"Spam": ""}, false, 0, 0, "header missing"},
+		{Header{}, false, 0, 0, "header missing", nil},
+		{Header{"Spam": ""}, false, 0, 0, "header missing", nil},
 		{
 			Header{"Spam": "clearly incorrect"},
-			false, 0, 0, "unexpected data",
+			false, 0, 0, "unexpected data", nil,
 		},
 		{
 			Header{"Spam": "bacon ; 0 / 0"},
-			false, 0, 0, "unknown spam status",
+			false, 0, 0, "unknown spam status", nil,
 		},
 		{
-			Header{"Spam": "no ; 0 "},
-			false, 0, 0, "unexpected data",
-		},
-		{
-			Header{"Spam": "no ; 0 / "},
-			false, 0, 0, "could not parse",
-		},
-		{
-			Header{"Spam": "no ; 0 / asd"},
-			false, 0, 0, "could not parse",
+			Header{"Spam": "no ; 0 / 1 / 2"},
+			false, 0, 0, "unexpected data", nil,
 		},
 		{
 			Header{"Spam": "no ; asd / 0"},
-			false, 0, 0, "could not parse",
+			false, 0, 0, "could not parse", nil,
 		},
 
 		// Valid data
 		{
 			Header{"Spam": "no ; 0.1 / 5.0"},
-			false, .1, 5.0, "",
+			false, .1, 5.0, "", nil,
 		},
 		{
 			Header{"Spam": "no;0.1 / 5.0"},
-			false, .1, 5.0, "",
+			false, .1, 5.0, "", nil,
 		},
 		{
 			Header{"Spam": "no;0.1/5.0"},
-			false, .1, 5.0, "",
+			false, .1, 5.0, "", nil,
 		},
 		{
 			Header{"Spam": "no;-0.1/5.0"},
-			false, -.1, 5.0, "",
+			false, -.1, 5.0, "", nil,
 		},
 		{
 			Header{"Spam": "TRUe ; 4 / 7.0"},
-			true, 4.0, 7.0, "",
+			true, 4.0, 7.0, "", nil,
+		},
+		{
+			Header{"Spam": "yes ; 1e+01 / 5.0"},
+			true, 10, 5.0, "", nil,
+		},
+		{
+			Header{"Spam": "no ; 1,6 / 5,0"},
+			false, 1.6, 5.0, "", nil,
+		},
+
+		// Missing or odd base score
+		{
+			Header{"Spam": "no ; 0 "},
+			false, 0, 0, "", []string{`missing base score in Spam header: "no ; 0 "`},
+		},
+		{
+			Header{"Spam": "yes ; 6.2 / "},
+			true, 6.2, 0, "", []string{`missing base score in Spam header: "yes ; 6.2 / "`},
+		},
+		{
+			Header{"Spam": "no ; 0 / asd"},
+			false, 0, 0, "", []string{`invalid base score in Spam header: "no ; 0 / asd"`},
+		},
+		{
+			Header{"Spam": "no ; 0 / -5"},
+			false, 0, -5, "", []string{`negative base score in Spam header: "no ; 0 / -5"`},
 		},
 	}
 
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
-			isSpam, score, baseScore, err := parseSpamHeader(tc.in)
+			isSpam, score, baseScore, warnings, err := parseSpamHeader(tc.in)
 
 			if isSpam != tc.wantIsSpam {
 				t.Errorf("isSpam wrong\nout:  %#v\nwant: %#v\n",
@@ -244,8 +312,178 @@ func TestParseSpamHeader(t *testing.T) {
 				t.Errorf("error wrong\nout:  %#v\nwant: %#v\n",
 					err, tc.wantErr)
 			}
+			if !reflect.DeepEqual(warnings, tc.wantWarnings) {
+				t.Errorf("warnings wrong\nout:  %#v\nwant: %#v\n",
+					warnings, tc.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    float64
+		wantErr string
+	}{
+		{"1.6", 1.6, ""},
+		{"-0.0", 0, ""},
+		{"1e+01", 10, ""},
+		{"2.5E-1", .25, ""},
+		{"1,6", 1.6, ""},
+		{"-1,6", -1.6, ""},
+		{"1,000.5", 0, "invalid syntax"},
+		{"1,2,3", 0, "invalid syntax"},
+		{"asd", 0, "invalid syntax"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			out, err := parseFloat(tc.in)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseReportScoreFormats(t *testing.T) {
+	in := " pts rule name              description\n" +
+		"---- ---------------------- --------------------------------------------------\n" +
+		" 1,2 MISSING_HEADERS        Missing To: header\n" +
+		"1e+01 LOCAL_RULE            Local rule\n"
+	want := []ReportRow{
+		{Points: 1.2, Rule: "MISSING_HEADERS", Description: "Missing To: header"},
+		{Points: 10, Rule: "LOCAL_RULE", Description: "Local rule"},
+	}
+
+	out, warnings, err := parseReport(textproto.NewReader(bufio.NewReader(strings.NewReader(in))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected warnings: %#v", warnings)
+	}
+	if !reflect.DeepEqual(out.Table, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out.Table, want)
+	}
+}
+
+func TestParseReportContentPreview(t *testing.T) {
+	in := normalizeSpace(`
+		Spam detection software, running on the system "d311d8df23f8",
+		has identified this incoming email as possible spam.
+
+		Content preview:  Dear friend, I am writing to you about a business
+		   proposal of mutual benefit. [...]
+
+		Content analysis details:   (6.2 points, 5.0 required)
+
+		 pts rule name              description
+		---- ---------------------- --------------------------------------------------
+		 1.2 MISSING_HEADERS        Missing To: header
+	`)
+
+	out, _, err := parseReport(textproto.NewReader(bufio.NewReader(strings.NewReader(in))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Dear friend, I am writing to you about a business proposal of mutual benefit. [...]"
+	if out.ContentPreview != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out.ContentPreview, want)
+	}
+	wantIntro := normalizeSpace(`
+		Spam detection software, running on the system "d311d8df23f8",
+		has identified this incoming email as possible spam.
+
+		Content analysis details:   (6.2 points, 5.0 required)
+	`)
+	if d := diff.TextDiff(strings.TrimSpace(wantIntro), out.Intro); d != "" {
+		t.Errorf("intro wrong\n%v", d)
+	}
+	if s := out.String(); !strings.Contains(s, "spam.\n\nContent preview:  "+want+"\n\nContent analysis") {
+		t.Errorf("wrong String()\n%v", s)
+	}
+}
+
+func TestReportFormat(t *testing.T) {
+	r := Report{
+		Intro: "Content analysis details:   (1.6 points, 5.0 required)",
+		Table: []ReportRow{
+			{Points: 0.4, Rule: "INVALID_DATE", Description: "Invalid Date: header (not RFC 2822)"},
+			{Points: -0.0, Rule: "NO_RELAYS", Description: "Informational: message was not relayed via SMTP"},
+			{Points: 1.2, Rule: "URIBL_BLOCKED", Description: "ADMINISTRATOR NOTICE: The query to URIBL was",
+				Wrapped: []string{"                            blocked."}},
+		},
+	}
+
+	cases := []struct {
+		in   ReportFormat
+		want string
+	}{
+		{ReportFormat{}, r.String()},
+		{ReportFormat{RuleWidth: 14, DescriptionWidth: 24, OmitZero: true}, normalizeSpace(`
+			Content analysis details:   (1.6 points, 5.0 required)
+
+			 pts rule name      description
+			---- -------------- ------------------------
+			 0.4 INVALID_DATE   Invalid Date: header
+			                    (not RFC 2822)
+			 1.2 URIBL_BLOCKED  ADMINISTRATOR NOTICE:
+			                    The query to URIBL was
+			                    blocked.
+		`)},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := r.Format(tc.in)
+			if d := diff.TextDiff(strings.TrimSpace(tc.want), strings.TrimSpace(out)); d != "" {
+				t.Errorf("wrong output\n%v", d)
+			}
+		})
+	}
+}
+
+func TestReportFilter(t *testing.T) {
+	r := Report{Intro: "intro", Table: []ReportRow{
+		{Points: 0.4, Rule: "INVALID_DATE"},
+		{Points: -0.0, Rule: "NO_RELAYS"},
+		{Points: -1.2, Rule: "RCVD_IN_DNSWL"},
+		{Points: 0.0, Rule: "HTML_MESSAGE"},
+	}}
+
+	cases := []struct {
+		in   float64
+		want SymbolSet
+	}{
+		{0, SymbolSet{"INVALID_DATE", "NO_RELAYS", "RCVD_IN_DNSWL", "HTML_MESSAGE"}},
+		{0.001, SymbolSet{"INVALID_DATE", "RCVD_IN_DNSWL"}},
+		{OmitZeroScore, SymbolSet{"INVALID_DATE", "RCVD_IN_DNSWL"}},
+		{1, SymbolSet{"RCVD_IN_DNSWL"}},
+		{2, SymbolSet{}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := r.Filter(tc.in)
+			if !reflect.DeepEqual(out.Symbols(), tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out.Symbols(), tc.want)
+			}
+			if out.Intro != r.Intro || len(r.Table) != 4 {
+				t.Errorf("report modified or not copied: %#v", out)
+			}
 		})
 	}
+
+	omit := r.Format(ReportFormat{OmitZero: true})
+	if filtered := r.Filter(OmitZeroScore).String(); omit != filtered {
+		t.Errorf("OmitZero and Filter differ\nout:  %#v\nwant: %#v\n", omit, filtered)
+	}
 }
 
 func TestParseReport(t *testing.T) {
@@ -274,15 +512,10 @@ func TestParseReport(t *testing.T) {
 					Spam detection software, running on the system "d311d8df23f8",
 					has NOT identified this incoming email as spam.
 
-					Content preview:  the body [...]
-
 					Content analysis details:   (1.6 points, 5.0 required)
 				`),
-				Table: []struct {
-					Points      float64
-					Rule        string
-					Description string
-				}{
+				ContentPreview: "the body [...]",
+				Table: []ReportRow{
 					{
 						Points:      0.4,
 						Rule:        "INVALID_DATE",
@@ -306,13 +539,56 @@ func TestParseReport(t *testing.T) {
 				},
 			},
 		},
+		{
+			normalizeSpace(`
+				Content analysis details:   (2.5 points, 5.0 required)
+
+				 pts rule name              description
+				---- ---------------------- --------------------------------------------------
+				 0.0 URIBL_BLOCKED          ADMINISTRATOR NOTICE: The query to URIBL was
+				                            blocked.  See
+				                            http://wiki.apache.org/spamassassin/DnsBlocklists#dnsbl-block
+				                             for more information.
+				                            [URIs: example.com]
+				 2.5 FREEMAIL_FORGED_REPLYTO_LONG Freemail in Reply-To, but not
+				                             From
+				-0.0 NO_RELAYS              Informational: message was not relayed via SMTP
+			`),
+			Report{
+				Intro: "Content analysis details:   (2.5 points, 5.0 required)",
+				Table: []ReportRow{
+					{
+						Points:      0.0,
+						Rule:        "URIBL_BLOCKED",
+						Description: "ADMINISTRATOR NOTICE: The query to URIBL was",
+						Wrapped: []string{
+							"                            blocked.  See",
+							"                            http://wiki.apache.org/spamassassin/DnsBlocklists#dnsbl-block",
+							"                             for more information.",
+							"                            [URIs: example.com]",
+						},
+					},
+					{
+						Points:      2.5,
+						Rule:        "FREEMAIL_FORGED_REPLYTO_LONG",
+						Description: "Freemail in Reply-To, but not",
+						Wrapped:     []string{"                             From"},
+					},
+					{
+						Points:      -0.0,
+						Rule:        "NO_RELAYS",
+						Description: "Informational: message was not relayed via SMTP",
+					},
+				},
+			},
+		},
 	}
 
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
 			tp := textproto.NewReader(bufio.NewReader(strings.NewReader(tc.in)))
 
-			out, err := parseReport(tp)
+			out, _, err := parseReport(tp)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -320,6 +596,10 @@ func TestParseReport(t *testing.T) {
 			if d := diff.TextDiff(tc.want.Intro, out.Intro); d != "" {
 				t.Errorf("intro wrong\n%v", d)
 			}
+			if out.ContentPreview != tc.want.ContentPreview {
+				t.Errorf("wrong content preview\nout:  %#v\nwant: %#v\n",
+					out.ContentPreview, tc.want.ContentPreview)
+			}
 
 			if !reflect.DeepEqual(out.Table, tc.want.Table) {
 				t.Errorf("wrong table\nout:  %#v\nwant: %#v\n",
@@ -360,6 +640,7 @@ func TestSizeFromReader(t *testing.T) {
 		{strings.NewReader("xx"), 2, ""},
 		{bytes.NewReader([]byte("xx")), 2, ""},
 		{fp, 3, ""},
+		{io.NewSectionReader(fp, 1, 2), 2, ""},
 		{tr{}, 0, "unknown type: spamc.tr"},
 	}
 
@@ -396,3 +677,129 @@ func normalizeSpace(in string) string {
 
 	return strings.TrimSpace(r)
 }
+
+func BenchmarkWrite(b *testing.B) {
+	conn := fakeconn.New()
+	c := Client{}
+	msg := []byte(strings.Repeat("A message line\r\n", 100))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		conn.Written.Reset()
+		err := c.write(conn, cmdCheck, bytes.NewReader(msg), Header{}.Set("User", "bench"))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadResponse(b *testing.B) {
+	resp := "SPAMD/1.1 0 EX_OK\r\nContent-length: 50\r\nSpam: False ; 1.6 / 5.0\r\n\r\n" +
+		"INVALID_DATE,MISSING_HEADERS,NO_RECEIVED,NO_RELAYS\r\n"
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		h, tp, err := readResponse(strings.NewReader(resp))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, _, _, _, err := parseSpamHeader(h); err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err := readSymbols(tp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseReport(b *testing.B) {
+	report := normalizeSpace(`
+		Spam detection software, running on the system "d311d8df23f8",
+		has NOT identified this incoming email as spam.
+
+		Content preview:  the body [...]
+
+		Content analysis details:   (1.6 points, 5.0 required)
+
+		 pts rule name              description
+		---- ---------------------- --------------------------------------------------
+		 0.4 INVALID_DATE           Invalid Date: header (not RFC 2822)
+		-0.0 NO_RELAYS              Informational: message was not relayed via SMTP
+		 1.2 MISSING_HEADERS        Missing To: header
+		-0.0 NO_RECEIVED            Informational: message has no Received headers
+	`)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		tp := textproto.NewReader(bufio.NewReader(strings.NewReader(report)))
+		if _, _, err := parseReport(tp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWriteContentLength(t *testing.T) {
+	cases := []struct {
+		in      io.Reader
+		inLen   string
+		fix     bool
+		want    string
+		wantErr string
+	}{
+		{strings.NewReader("Message"), "7", false, "Content-length: 7\r\n\r\nMessage", ""},
+		{strings.NewReader("Message"), "3", false, "", "message is 7 bytes, but Content-length is 3 bytes"},
+		{strings.NewReader("Message"), "3", true, "Content-length: 7\r\n\r\nMessage", ""},
+		{ioutil.NopCloser(strings.NewReader("Message")), "7", false, "Content-length: 7\r\n\r\nMessage", ""},
+		{ioutil.NopCloser(strings.NewReader("Message")), "10", false, "Message", "message is 7 bytes, but Content-length is 10 bytes"},
+		{ioutil.NopCloser(strings.NewReader("Message")), "3", true, "Mes", "message is longer than the Content-length of 3 bytes"},
+		{ioutil.NopCloser(strings.NewReader("Message")), "x", false, "", "invalid Content-length"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			conn := fakeconn.New()
+			c := Client{FixContentLength: tc.fix}
+
+			err := c.write(conn, "CMD", tc.in, Header{}.Set("Content-length", tc.inLen))
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if out := conn.Written.String(); !strings.HasSuffix(out, tc.want) {
+				t.Errorf("wrong data written\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnknownHeaders(t *testing.T) {
+	cases := []struct {
+		in      Header
+		strict  bool
+		wantErr string
+		wantLog []string
+	}{
+		{Header{}.Set("USER", "x").Set("content-LENGTH", "7"), true, "", nil},
+		{Header{}.Set(HeaderMessageClass, MessageClassSpam).Set(HeaderSet, TellLocal), true, "", nil},
+		{Header{}.Set("Usre", "x"), true, `unknown header "Usre"`, nil},
+		{Header{}.Set("Usre", "x"), false, "",
+			[]string{"warn: sending header that spamd will ignore [header Usre]"}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			l := &testLogger{}
+			c := Client{StrictHeaders: tc.strict, Logger: l}
+
+			_, _, err := c.prepare(strings.NewReader("Message"), tc.in)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(l.msgs, tc.wantLog) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", l.msgs, tc.wantLog)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package spamdtest
+
+import "time"
+
+// Middleware wraps a Handler, for example to log requests or to reject
+// clients.
+type Middleware func(next Handler) Handler
+
+// Chain wraps h with the middleware; the first middleware is the outermost,
+// and sees the request first:
+//
+//   h := spamdtest.Chain(spamdtest.DefaultHandler,
+//       spamdtest.Observe(logRequest),
+//       spamdtest.Authorize(allowLocal))
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Observe calls f with every request, the response, and the time it took to
+// create it, for example to log requests or to record metrics.
+func Observe(f func(req *Request, resp string, d time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request) string {
+			start := time.Now()
+			resp := next(req)
+			f(req, resp, time.Since(start))
+			return resp
+		}
+	}
+}
+
+// Authorize replies with EX_NOPERM to requests for which allow returns false,
+// for example to only allow some users or source addresses:
+//
+//   spamdtest.Authorize(func(req *spamdtest.Request) bool {
+//       host, _, _ := net.SplitHostPort(req.RemoteAddr)
+//       return host == "127.0.0.1" && req.Header.Get("User") != "root"
+//   })
+func Authorize(allow func(req *Request) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request) string {
+			if !allow(req) {
+				return "SPAMD/1.1 77 EX_NOPERM\r\n\r\n"
+			}
+			return next(req)
+		}
+	}
+}
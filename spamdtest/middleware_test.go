@@ -0,0 +1,119 @@
+package spamdtest_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teamwork/spamc"
+	"github.com/teamwork/spamc/spamdtest"
+	"github.com/teamwork/test"
+)
+
+func TestMiddleware(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	h := spamdtest.Chain(spamdtest.DefaultHandler,
+		spamdtest.Observe(func(req *spamdtest.Request, resp string, d time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, req.Command+" "+resp[:strings.Index(resp, "\r\n")])
+		}),
+		spamdtest.Authorize(func(req *spamdtest.Request) bool {
+			return strings.HasPrefix(req.RemoteAddr, "127.0.0.1:") && req.Header.Get("User") != "root"
+		}))
+	srv := spamdtest.NewServer(h)
+	defer srv.Close()
+	c := spamc.New(srv.Addr, nil)
+	ctx := context.Background()
+
+	if _, err := c.Check(ctx, spamc.HamMessage(), spamc.Header{}.Set("User", "bob")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Check(ctx, spamc.HamMessage(), spamc.Header{}.Set("User", "root"))
+	if code := spamc.ExitCode(err, false); code != spamc.ExNoPerm {
+		t.Errorf("wrong exit code %v for %v", code, err)
+	}
+
+	want := []string{"CHECK SPAMD/1.1 0 EX_OK", "CHECK SPAMD/1.1 77 EX_NOPERM"}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(order, "\n") != strings.Join(want, "\n") {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", order, want)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		srv := spamdtest.NewServer(nil)
+		defer srv.Close()
+		srv.SetLimits(spamdtest.Limits{Timeout: 10 * time.Millisecond})
+
+		// Never send a request; the server should close the connection.
+		conn, err := net.Dial("tcp", srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()                                 // nolint: errcheck
+		conn.SetDeadline(time.Now().Add(10 * time.Second)) // nolint: errcheck
+
+		_, err = conn.Read(make([]byte, 1))
+		if err != io.EOF {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		srv := spamdtest.NewServer(nil)
+		defer srv.Close()
+		srv.SetLimits(spamdtest.Limits{MaxSize: 10})
+
+		_, err := spamc.New(srv.Addr, nil).Check(context.Background(), spamc.HamMessage(), nil)
+		if code := spamc.ExitCode(err, false); code != spamc.ExDataErr {
+			t.Errorf("wrong exit code %v for %v", code, err)
+		}
+		if len(srv.Requests()) != 0 {
+			t.Errorf("request was handled")
+		}
+	})
+
+	t.Run("max conns", func(t *testing.T) {
+		srv := spamdtest.NewServer(nil)
+		defer srv.Close()
+		srv.SetLimits(spamdtest.Limits{MaxConns: 1})
+		c := spamc.New(srv.Addr, nil)
+
+		// Keep a connection open without sending the request.
+		conn, err := net.Dial("tcp", srv.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // nolint: errcheck
+		for srv.Conns() < 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		_, err = c.Check(context.Background(), spamc.HamMessage(), nil)
+		if !test.ErrorContains(err, "EX_TEMPFAIL") {
+			t.Errorf("wrong error: %v", err)
+		}
+
+		// Send an empty request and wait for the server to close it.
+		if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(conn); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Check(context.Background(), spamc.HamMessage(), nil); err != nil {
+			t.Errorf("after closing the connection: %v", err)
+		}
+	})
+}
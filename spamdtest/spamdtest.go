@@ -0,0 +1,472 @@
+// Package spamdtest provides a fake spamd server for tests.
+//
+// The server replies to every command with the response from its Handler. The
+// behaviour of connections can be scripted, to test how clients deal with slow
+// or misbehaving servers:
+//
+//   srv := spamdtest.NewServer(nil)
+//   defer srv.Close()
+//
+//   // The first connection fails with EX_TEMPFAIL, the second is slow, and
+//   // the third is dropped halfway through the headers.
+//   srv.Script(
+//       spamdtest.Scenario{spamdtest.TempFail()},
+//       spamdtest.Scenario{spamdtest.Delay(200 * time.Millisecond), spamdtest.Respond()},
+//       spamdtest.MustParseScript("partial-header; drop"),
+//   )
+//
+//   client := spamc.New(srv.Addr, nil)
+//
+// Connections after the scripted ones get the Handler's response.
+package spamdtest // import "github.com/teamwork/spamc/spamdtest"
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// gtube is the Generic Test for Unsolicited Bulk Email.
+const gtube = "XJS*C4JDBQADN1.NSBN3*2IDNEN*GTUBE-STANDARD-ANTI-UBE-TEST-EMAIL*C.34X"
+
+// Request is a command received by the server.
+type Request struct {
+	Command string
+	Version string
+	Header  textproto.MIMEHeader
+
+	// RemoteAddr is the address of the client, as "host:port".
+	RemoteAddr string
+
+	// Body is the message; it's decompressed if it was sent with
+	// "Compress: zlib".
+	Body []byte
+}
+
+// Handler returns the raw response to a request, including the status line.
+type Handler func(req *Request) string
+
+// DefaultHandler replies to PING with PONG, and to CHECK, SYMBOLS, REPORT,
+// REPORT_IFSPAM, PROCESS, and HEADERS with a score of 1000 if the message
+// contains the GTUBE string, and a score of 0 if it doesn't. Other commands
+// get a EX_OK response without a body.
+func DefaultHandler(req *Request) string {
+	spam, score, symbols := "False", "0.0", ""
+	if bytes.Contains(req.Body, []byte(gtube)) {
+		spam, score, symbols = "True", "1000.0", "GTUBE"
+	}
+	head := func(body string) string {
+		return fmt.Sprintf("SPAMD/1.1 0 EX_OK\r\nContent-length: %d\r\nSpam: %s ; %s / 5.0\r\n\r\n%s",
+			len(body), spam, score, body)
+	}
+
+	switch req.Command {
+	case "PING":
+		return "SPAMD/1.5 0 PONG\r\n"
+	case "CHECK":
+		return head("")
+	case "SYMBOLS":
+		return head(symbols)
+	case "REPORT", "REPORT_IFSPAM":
+		body := "Content analysis details:   (" + score + " points, 5.0 required)\r\n\r\n" +
+			" pts rule name              description\r\n" +
+			"---- ---------------------- --------------------------------------------------\r\n"
+		if symbols != "" {
+			body += "1000 GTUBE                  BODY: Generic Test for Unsolicited Bulk Email\r\n"
+		}
+		return head(body)
+	case "PROCESS":
+		return head(string(req.Body))
+	case "HEADERS":
+		if i := bytes.Index(req.Body, []byte("\r\n\r\n")); i >= 0 {
+			return head(string(req.Body[:i+4]))
+		}
+		return head(string(req.Body))
+	default:
+		return "SPAMD/1.5 0 EX_OK\r\n\r\n"
+	}
+}
+
+// Server is a fake spamd server listening on a local TCP port.
+type Server struct {
+	// Addr is the address the server is listening on, as "host:port".
+	Addr string
+
+	handler Handler
+	l       net.Listener
+	wg      sync.WaitGroup
+
+	mu        sync.Mutex
+	scenarios []Scenario
+	requests  []*Request
+	conns     int
+	active    int
+	open      map[net.Conn]struct{}
+	limits    Limits
+}
+
+// Limits are the per-connection limits of a Server.
+type Limits struct {
+	// Timeout is the time a connection may take, from accepting it until
+	// the scenario is done, like spamd's --timeout-child. The connection is
+	// closed once it's exceeded. There is no limit if this is 0.
+	Timeout time.Duration
+
+	// MaxConns is the maximum number of connections that are handled at
+	// the same time, like spamd's --max-children; connections over the
+	// limit get an EX_TEMPFAIL response. There is no limit if this is 0.
+	MaxConns int
+
+	// MaxSize is the maximum size of a request body; larger requests get an
+	// EX_DATAERR response, without calling the Handler. There is no limit if
+	// this is 0.
+	MaxSize int64
+}
+
+// NewServer starts a server; DefaultHandler is used if h is nil.
+func NewServer(h Handler) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("spamdtest: could not listen: %v", err))
+	}
+	if h == nil {
+		h = DefaultHandler
+	}
+
+	s := &Server{
+		Addr:    l.Addr().String(),
+		handler: h,
+		l:       l,
+		open:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.l.Close() // nolint: errcheck
+	s.mu.Lock()
+	for c := range s.open {
+		c.Close() // nolint: errcheck
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Script sets the scenarios for the next connections; every connection uses
+// the next scenario, in the order they were added. Connections after that
+// get the Handler's response.
+func (s *Server) Script(scenarios ...Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = append(s.scenarios, scenarios...)
+}
+
+// SetLimits sets the limits for new connections.
+func (s *Server) SetLimits(l Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = l
+}
+
+// Requests returns the requests that were received so far.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// Conns returns the number of connections that were accepted so far.
+func (s *Server) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns++
+		s.open[c] = struct{}{}
+		l := s.limits
+		if l.MaxConns > 0 && s.active >= l.MaxConns {
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.reject(c, l)
+			}()
+			continue
+		}
+		s.active++
+		sc := Scenario{Respond()}
+		if len(s.scenarios) > 0 {
+			sc, s.scenarios = s.scenarios[0], s.scenarios[1:]
+		}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(c, sc, l)
+		}()
+	}
+}
+
+func (s *Server) handle(c net.Conn, sc Scenario, l Limits) {
+	// The connection is no longer counted before it's closed, as clients
+	// can connect again as soon as they see it's closed.
+	defer func() {
+		s.mu.Lock()
+		delete(s.open, c)
+		s.active--
+		s.mu.Unlock()
+		c.Close() // nolint: errcheck
+	}()
+
+	if l.Timeout > 0 {
+		c.SetDeadline(time.Now().Add(l.Timeout)) // nolint: errcheck
+	}
+	req, err := readRequest(bufio.NewReader(c), l.MaxSize)
+	if err == errTooLarge {
+		io.WriteString(c, "SPAMD/1.1 65 EX_DATAERR\r\n\r\n") // nolint: errcheck
+		return
+	}
+	if err != nil {
+		return
+	}
+	req.RemoteAddr = c.RemoteAddr().String()
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	st := &state{conn: c, resp: s.handler(req)}
+	for _, step := range sc {
+		if err := step(st); err != nil || st.dropped {
+			return
+		}
+	}
+}
+
+// reject reads the request on a connection over the MaxConns limit, and
+// replies with EX_TEMPFAIL.
+func (s *Server) reject(c net.Conn, l Limits) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.open, c)
+		s.mu.Unlock()
+		c.Close() // nolint: errcheck
+	}()
+
+	if l.Timeout > 0 {
+		c.SetDeadline(time.Now().Add(l.Timeout)) // nolint: errcheck
+	}
+	if _, err := readRequest(bufio.NewReader(c), l.MaxSize); err != nil && err != errTooLarge {
+		return
+	}
+	TempFail()(&state{conn: c}) // nolint: errcheck
+}
+
+// errTooLarge is returned by readRequest() if the body is larger than the
+// MaxSize limit.
+var errTooLarge = errors.New("request body too large")
+
+// readRequest reads a request; the body is read up to the Content-length, or
+// until the client closes its side of the connection. Bodies sent with
+// "Compress: zlib" are decompressed.
+//
+// The body is discarded and errTooLarge is returned if the Content-length is
+// larger than maxSize; maxSize is ignored if it's 0.
+func readRequest(r *bufio.Reader, maxSize int64) (*Request, error) {
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	f := strings.Fields(line)
+	if len(f) != 2 {
+		return nil, errors.Errorf("invalid request line: %q", line)
+	}
+
+	h, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	req := &Request{Command: f[0], Version: f[1], Header: h}
+
+	if l := h.Get("Content-length"); l != "" {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid Content-length: %q", l)
+		}
+		if maxSize > 0 && n > maxSize {
+			_, err := io.Copy(ioutil.Discard, io.LimitReader(r, n))
+			if err != nil {
+				return nil, err
+			}
+			return nil, errTooLarge
+		}
+		req.Body, err = ioutil.ReadAll(io.LimitReader(r, n))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.EqualFold(h.Get("Compress"), "zlib") {
+		zr, err := zlib.NewReader(bytes.NewReader(req.Body))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not decompress body")
+		}
+		req.Body, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not decompress body")
+		}
+	}
+	return req, nil
+}
+
+// state is the state of a connection while a scenario is run.
+type state struct {
+	conn    net.Conn
+	resp    string
+	dropped bool
+}
+
+// Step is a single step of a Scenario.
+type Step func(s *state) error
+
+// Scenario is a list of steps which are run on a connection after the request
+// was read; the connection is closed once they're done. An empty scenario
+// closes the connection without a response.
+type Scenario []Step
+
+// Respond writes the Handler's response.
+func Respond() Step {
+	return func(s *state) error {
+		_, err := io.WriteString(s.conn, s.resp)
+		return err
+	}
+}
+
+// Delay waits for d before the next step.
+func Delay(d time.Duration) Step {
+	return func(s *state) error {
+		time.Sleep(d)
+		return nil
+	}
+}
+
+// Send writes raw data.
+func Send(raw string) Step {
+	return func(s *state) error {
+		_, err := io.WriteString(s.conn, raw)
+		return err
+	}
+}
+
+// PartialHeader writes the status line and the first half of the headers of
+// the Handler's response, without the blank line that ends them.
+func PartialHeader() Step {
+	return func(s *state) error {
+		head := s.resp
+		if i := strings.Index(head, "\r\n\r\n"); i >= 0 {
+			head = head[:i]
+		}
+		_, err := io.WriteString(s.conn, head[:len(head)/2])
+		return err
+	}
+}
+
+// GarbleStatus writes the Handler's response with a status line that can't be
+// parsed.
+func GarbleStatus() Step {
+	return func(s *state) error {
+		resp := "SPAMD/1.x ?? EX_G@RBLED" + s.resp[strings.Index(s.resp+"\r\n", "\r\n"):]
+		_, err := io.WriteString(s.conn, resp)
+		return err
+	}
+}
+
+// TempFail writes a EX_TEMPFAIL response.
+func TempFail() Step {
+	return Send("SPAMD/1.1 75 EX_TEMPFAIL\r\n\r\n")
+}
+
+// Drop closes the connection immediately, without running the next steps.
+func Drop() Step {
+	return func(s *state) error {
+		s.dropped = true
+		return nil
+	}
+}
+
+// ParseScript parses a scenario from a script with one step per line or
+// separated by semicolons:
+//
+//   delay 100ms     Delay(100 * time.Millisecond)
+//   respond         Respond()
+//   partial-header  PartialHeader()
+//   garble-status   GarbleStatus()
+//   tempfail        TempFail()
+//   drop            Drop()
+//
+// Empty lines and lines starting with # are ignored.
+func ParseScript(script string) (Scenario, error) {
+	var sc Scenario
+	for i, line := range strings.FieldsFunc(script, func(r rune) bool { return r == '\n' || r == ';' }) {
+		f := strings.Fields(line)
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+
+		switch {
+		case f[0] == "delay" && len(f) == 2:
+			d, err := time.ParseDuration(f[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "step %d", i+1)
+			}
+			sc = append(sc, Delay(d))
+		case f[0] == "respond" && len(f) == 1:
+			sc = append(sc, Respond())
+		case f[0] == "partial-header" && len(f) == 1:
+			sc = append(sc, PartialHeader())
+		case f[0] == "garble-status" && len(f) == 1:
+			sc = append(sc, GarbleStatus())
+		case f[0] == "tempfail" && len(f) == 1:
+			sc = append(sc, TempFail())
+		case f[0] == "drop" && len(f) == 1:
+			sc = append(sc, Drop())
+		default:
+			return nil, errors.Errorf("step %d: unknown step %q", i+1, strings.TrimSpace(line))
+		}
+	}
+	return sc, nil
+}
+
+// MustParseScript is like ParseScript(), but panics on errors.
+func MustParseScript(script string) Scenario {
+	sc, err := ParseScript(script)
+	if err != nil {
+		panic(fmt.Sprintf("spamdtest: %v", err))
+	}
+	return sc
+}
@@ -0,0 +1,133 @@
+package spamdtest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/teamwork/spamc"
+	"github.com/teamwork/spamc/spamdtest"
+	"github.com/teamwork/test"
+)
+
+func TestServer(t *testing.T) {
+	srv := spamdtest.NewServer(nil)
+	defer srv.Close()
+	c := spamc.New(srv.Addr, nil)
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Symbols(ctx, spamc.GTUBEMessage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.IsSpam || !r.Symbols.Contains("GTUBE") {
+		t.Errorf("GTUBE not spam: %#v", r)
+	}
+
+	rep, err := c.Report(ctx, spamc.HamMessage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.IsSpam || len(rep.Report.Table) != 0 {
+		t.Errorf("ham is spam: %#v", rep)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 3 || reqs[1].Command != "SYMBOLS" || int64(len(reqs[1].Body)) != spamc.GTUBEMessage().Size() {
+		t.Errorf("wrong requests: %#v", reqs)
+	}
+}
+
+func TestServerCompress(t *testing.T) {
+	srv := spamdtest.NewServer(nil)
+	defer srv.Close()
+	c := spamc.New(srv.Addr, nil)
+
+	resp, err := c.Send(context.Background(), &spamc.Request{
+		Command:  "CHECK",
+		Message:  spamc.GTUBEMessage(),
+		Compress: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	score, err := resp.Score()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !score.IsSpam {
+		t.Errorf("compressed GTUBE not spam: %#v", score)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 || reqs[0].Header.Get("Compress") != "zlib" ||
+		int64(len(reqs[0].Body)) != spamc.GTUBEMessage().Size() {
+		t.Errorf("wrong requests: %#v", reqs)
+	}
+}
+
+func TestScript(t *testing.T) {
+	cases := []struct {
+		script  string
+		retry   int
+		wantErr string
+	}{
+		{"respond", 0, ""},
+		{"tempfail", 0, "EX_TEMPFAIL"},
+		{"tempfail", 2, ""},
+		{"drop", 0, "EOF"},
+		{"partial-header; drop", 0, "could not read headers"},
+		{"garble-status", 0, "unknown server protocol"},
+		{"delay 200ms; respond", 0, "i/o timeout"},
+		{"# Comment\n\ndelay 1ms\nrespond", 0, ""},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			srv := spamdtest.NewServer(nil)
+			defer srv.Close()
+			srv.Script(spamdtest.MustParseScript(tc.script))
+
+			c := spamc.New(srv.Addr, nil,
+				spamc.WithTimeout(100*time.Millisecond),
+				spamc.WithRetry(spamc.RetryPolicy{Attempts: tc.retry}))
+			_, err := c.Check(context.Background(), spamc.HamMessage(), nil)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    int
+		wantErr string
+	}{
+		{"", 0, ""},
+		{"delay 1s; respond; drop", 3, ""},
+		{"partial-header\ngarble-status\ntempfail", 3, ""},
+		{"delay", 0, `step 1: unknown step "delay"`},
+		{"respond; delay x", 0, "step 2: time: invalid duration"},
+		{"respond; explode", 0, `step 2: unknown step "explode"`},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out, err := spamdtest.ParseScript(tc.in)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if len(out) != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", len(out), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package spamdtest
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TrainingStore stores the messages sent with TELL, for TellHandler().
+//
+// Every method reports if it changed anything; for example Learn() returns
+// false if the message was already learned with the same class, in which case
+// spamd doesn't include it in the DidSet header.
+type TrainingStore interface {
+	// Learn the message as spam or ham (Set: local).
+	Learn(msg []byte, spam bool) (bool, error)
+
+	// Forget a previously learned message (Remove: local).
+	Forget(msg []byte) (bool, error)
+
+	// Report the message as spam to remote databases (Set: remote).
+	Report(msg []byte) (bool, error)
+
+	// Revoke a previous report (Remove: remote).
+	Revoke(msg []byte) (bool, error)
+}
+
+// TellHandler returns a Handler which replies to TELL with the DidSet and
+// DidRemove headers from the store, and passes other commands to next;
+// DefaultHandler is used if next is nil:
+//
+//   store := spamdtest.NewMemoryStore()
+//   srv := spamdtest.NewServer(spamdtest.TellHandler(store, nil))
+//
+// Errors from the store are sent as EX_IOERR.
+func TellHandler(store TrainingStore, next Handler) Handler {
+	if next == nil {
+		next = DefaultHandler
+	}
+	return func(req *Request) string {
+		if req.Command != "TELL" {
+			return next(req)
+		}
+
+		class := strings.ToLower(strings.TrimSpace(req.Header.Get("Message-class")))
+		if class != "spam" && class != "ham" {
+			return fmt.Sprintf("SPAMD/1.1 76 Bad header line: Message-class: %s\r\n", class)
+		}
+		set, remove := tellTargets(req.Header.Get("Set")), tellTargets(req.Header.Get("Remove"))
+		if len(set) == 0 && len(remove) == 0 {
+			return "SPAMD/1.1 76 Bad header line: missing Set or Remove\r\n"
+		}
+
+		var didSet, didRemove []string
+		do := func(did *[]string, target string, f func([]byte) (bool, error)) error {
+			ok, err := f(req.Body)
+			if ok {
+				*did = append(*did, target)
+			}
+			return err
+		}
+		var err error
+		if set["local"] && err == nil {
+			err = do(&didSet, "local", func(b []byte) (bool, error) { return store.Learn(b, class == "spam") })
+		}
+		if set["remote"] && err == nil {
+			err = do(&didSet, "remote", store.Report)
+		}
+		if remove["local"] && err == nil {
+			err = do(&didRemove, "local", store.Forget)
+		}
+		if remove["remote"] && err == nil {
+			err = do(&didRemove, "remote", store.Revoke)
+		}
+		if err != nil {
+			return fmt.Sprintf("SPAMD/1.1 74 %v\r\n", strings.Replace(err.Error(), "\n", " ", -1))
+		}
+
+		resp := "SPAMD/1.1 0 EX_OK\r\n"
+		if len(didSet) > 0 {
+			resp += "DidSet: " + strings.Join(didSet, ",") + "\r\n"
+		}
+		if len(didRemove) > 0 {
+			resp += "DidRemove: " + strings.Join(didRemove, ",") + "\r\n"
+		}
+		return resp + "\r\n"
+	}
+}
+
+// tellTargets parses the Set or Remove header.
+func tellTargets(h string) map[string]bool {
+	t := make(map[string]bool)
+	for _, s := range strings.Split(h, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			t[s] = true
+		}
+	}
+	return t
+}
+
+// MemoryStore is a TrainingStore which keeps the messages in memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	learned  map[[sha1.Size]byte]bool
+	reported map[[sha1.Size]byte]bool
+}
+
+// NewMemoryStore creates a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		learned:  make(map[[sha1.Size]byte]bool),
+		reported: make(map[[sha1.Size]byte]bool),
+	}
+}
+
+// Learn the message as spam or ham.
+func (m *MemoryStore) Learn(msg []byte, spam bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := sha1.Sum(msg)
+	if s, ok := m.learned[k]; ok && s == spam {
+		return false, nil
+	}
+	m.learned[k] = spam
+	return true, nil
+}
+
+// Forget a learned message.
+func (m *MemoryStore) Forget(msg []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := sha1.Sum(msg)
+	_, ok := m.learned[k]
+	delete(m.learned, k)
+	return ok, nil
+}
+
+// Report the message as spam.
+func (m *MemoryStore) Report(msg []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := sha1.Sum(msg)
+	if m.reported[k] {
+		return false, nil
+	}
+	m.reported[k] = true
+	return true, nil
+}
+
+// Revoke a report.
+func (m *MemoryStore) Revoke(msg []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := sha1.Sum(msg)
+	ok := m.reported[k]
+	delete(m.reported, k)
+	return ok, nil
+}
+
+// Learned reports if the message was learned, and if it was learned as spam.
+func (m *MemoryStore) Learned(msg []byte) (learned, spam bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	spam, learned = m.learned[sha1.Sum(msg)]
+	return learned, spam
+}
+
+// Reported reports if the message was reported as spam.
+func (m *MemoryStore) Reported(msg []byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reported[sha1.Sum(msg)]
+}
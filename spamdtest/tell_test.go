@@ -0,0 +1,72 @@
+package spamdtest_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/spamc"
+	"github.com/teamwork/spamc/spamdtest"
+	"github.com/teamwork/test"
+)
+
+type errStore struct{ *spamdtest.MemoryStore }
+
+func (errStore) Report(msg []byte) (bool, error) { return false, errors.New("oops") }
+
+func TestTellHandler(t *testing.T) {
+	store := spamdtest.NewMemoryStore()
+	srv := spamdtest.NewServer(spamdtest.TellHandler(store, nil))
+	defer srv.Close()
+	c := spamc.New(srv.Addr, nil)
+
+	cases := []struct {
+		class, set, remove  string
+		wantSet, wantRemove []string
+	}{
+		{spamc.MessageClassSpam, spamc.TellLocal, "", []string{"local"}, nil},
+		{spamc.MessageClassSpam, spamc.TellLocal, "", nil, nil},
+		{spamc.MessageClassHam, spamc.TellLocalRemote, "", []string{"local", "remote"}, nil},
+		{spamc.MessageClassHam, "", spamc.TellLocalRemote, nil, []string{"local", "remote"}},
+		{spamc.MessageClassHam, "", spamc.TellLocal, nil, nil},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			hdr := spamc.Header{}.Set(spamc.HeaderMessageClass, tc.class)
+			if tc.set != "" {
+				hdr.Set(spamc.HeaderSet, tc.set)
+			}
+			if tc.remove != "" {
+				hdr.Set(spamc.HeaderRemove, tc.remove)
+			}
+			r, err := c.Tell(context.Background(), spamc.HamMessage(), hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.DidSet, tc.wantSet) || !reflect.DeepEqual(r.DidRemove, tc.wantRemove) {
+				t.Errorf("\nout:  %#v %#v\nwant: %#v %#v\n", r.DidSet, r.DidRemove, tc.wantSet, tc.wantRemove)
+			}
+		})
+	}
+
+	// Other commands are passed to the next handler.
+	if _, err := c.Check(context.Background(), spamc.HamMessage(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTellHandlerError(t *testing.T) {
+	srv := spamdtest.NewServer(spamdtest.TellHandler(errStore{spamdtest.NewMemoryStore()}, nil))
+	defer srv.Close()
+	c := spamc.New(srv.Addr, nil)
+
+	_, err := c.Tell(context.Background(), spamc.GTUBEMessage(), spamc.Header{}.
+		Set(spamc.HeaderMessageClass, spamc.MessageClassSpam).
+		Set(spamc.HeaderSet, spamc.TellRemote))
+	if !test.ErrorContains(err, "oops") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package spamc
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHistogramBounds are the upper bounds of the score histogram buckets
+// used if NewStats() is called without bounds.
+var DefaultHistogramBounds = []float64{0, 1, 2, 3, 4, 5, 7.5, 10, 15, 20}
+
+// statsSlots is the number of slots the window is divided in; statistics
+// expire one slot at a time.
+const statsSlots = 60
+
+// Stats collects statistics about responses over a sliding window, for
+// example for monitoring the health of a mail stream. It's safe for concurrent
+// use.
+type Stats struct {
+	window time.Duration
+	bounds []float64
+	now    func() time.Time
+
+	mu    sync.Mutex
+	slots [statsSlots]statsSlot
+}
+
+type statsSlot struct {
+	start    time.Time
+	total    int
+	spam     int
+	scoreSum float64
+	buckets  []int
+	rules    map[string]int
+}
+
+// StatsSnapshot is a snapshot of the statistics; see Stats.Snapshot().
+type StatsSnapshot struct {
+	Window    time.Duration
+	Total     int     // Total number of responses.
+	Spam      int     // Number of responses where IsSpam was true.
+	Ham       int     // Number of responses where IsSpam was false.
+	SpamRatio float64 // Spam / Total; 0 if there are no responses.
+	MeanScore float64 // Mean score; 0 if there are no responses.
+
+	// Histogram of the scores. The last bucket has an UpperBound of +Inf.
+	Histogram []HistogramBucket
+
+	// TopRules are the rules that were hit most often, sorted by count.
+	TopRules []RuleCount
+}
+
+// HistogramBucket is a single bucket in the score histogram; it counts all
+// scores lower than or equal to UpperBound, and higher than the previous
+// bucket's UpperBound.
+type HistogramBucket struct {
+	UpperBound float64
+	Count      int
+}
+
+// RuleCount is the number of times a rule was hit.
+type RuleCount struct {
+	Rule  string
+	Count int
+}
+
+// NewStats creates a new statistics collector, which keeps statistics over the
+// last window. The bounds are the upper bounds of the histogram buckets, in
+// ascending order; DefaultHistogramBounds is used if none are given.
+func NewStats(window time.Duration, bounds ...float64) *Stats {
+	if len(bounds) == 0 {
+		bounds = DefaultHistogramBounds
+	}
+	b := make([]float64, len(bounds), len(bounds)+1)
+	copy(b, bounds)
+	sort.Float64s(b)
+
+	return &Stats{
+		window: window,
+		bounds: append(b, math.Inf(1)),
+		now:    time.Now,
+	}
+}
+
+// Add a response to the statistics; symbols may be nil if they're not known
+// (e.g. for the Check command).
+func (s *Stats) Add(score ResponseScore, symbols SymbolSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	slotSize := s.window / statsSlots
+	if slotSize <= 0 {
+		slotSize = 1
+	}
+	start := now.Truncate(slotSize)
+	slot := &s.slots[(start.UnixNano()/int64(slotSize))%statsSlots]
+	if !slot.start.Equal(start) {
+		*slot = statsSlot{
+			start:   start,
+			buckets: make([]int, len(s.bounds)),
+			rules:   make(map[string]int),
+		}
+	}
+
+	slot.total++
+	if score.IsSpam {
+		slot.spam++
+	}
+	slot.scoreSum += score.Score
+	slot.buckets[sort.SearchFloat64s(s.bounds, score.Score)]++
+	for _, r := range symbols {
+		slot.rules[r]++
+	}
+}
+
+// Snapshot returns the statistics over the current window. At most topN rules
+// are returned in TopRules; all rules are returned if topN is 0 or negative.
+func (s *Stats) Snapshot(topN int) StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{
+		Window:    s.window,
+		Histogram: make([]HistogramBucket, len(s.bounds)),
+	}
+	for i, b := range s.bounds {
+		snap.Histogram[i].UpperBound = b
+	}
+
+	var (
+		scoreSum float64
+		rules    = make(map[string]int)
+		oldest   = s.now().Add(-s.window)
+	)
+	for _, slot := range s.slots {
+		if slot.total == 0 || !slot.start.After(oldest) {
+			continue
+		}
+
+		snap.Total += slot.total
+		snap.Spam += slot.spam
+		scoreSum += slot.scoreSum
+		for i, c := range slot.buckets {
+			snap.Histogram[i].Count += c
+		}
+		for r, c := range slot.rules {
+			rules[r] += c
+		}
+	}
+
+	snap.Ham = snap.Total - snap.Spam
+	if snap.Total > 0 {
+		snap.SpamRatio = float64(snap.Spam) / float64(snap.Total)
+		snap.MeanScore = scoreSum / float64(snap.Total)
+	}
+
+	snap.TopRules = make([]RuleCount, 0, len(rules))
+	for r, c := range rules {
+		snap.TopRules = append(snap.TopRules, RuleCount{Rule: r, Count: c})
+	}
+	sort.Slice(snap.TopRules, func(i, j int) bool {
+		if snap.TopRules[i].Count == snap.TopRules[j].Count {
+			return snap.TopRules[i].Rule < snap.TopRules[j].Rule
+		}
+		return snap.TopRules[i].Count > snap.TopRules[j].Count
+	})
+	if topN > 0 && len(snap.TopRules) > topN {
+		snap.TopRules = snap.TopRules[:topN]
+	}
+
+	return snap
+}
@@ -0,0 +1,60 @@
+package spamc
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := NewStats(time.Minute, 5, 0)
+	s.now = func() time.Time { return now }
+
+	s.Add(ResponseScore{IsSpam: false, Score: -1}, SymbolSet{"NO_RELAYS"})
+	s.Add(ResponseScore{IsSpam: false, Score: 2}, SymbolSet{"NO_RELAYS", "MISSING_HEADERS"})
+	now = now.Add(30 * time.Second)
+	s.Add(ResponseScore{IsSpam: true, Score: 8}, SymbolSet{"BAYES_99", "NO_RELAYS"})
+	s.Add(ResponseScore{IsSpam: true, Score: 11}, nil)
+
+	want := StatsSnapshot{
+		Window:    time.Minute,
+		Total:     4,
+		Spam:      2,
+		Ham:       2,
+		SpamRatio: 0.5,
+		MeanScore: 5,
+		Histogram: []HistogramBucket{{0, 1}, {5, 1}, {math.Inf(1), 2}},
+		TopRules:  []RuleCount{{"NO_RELAYS", 3}, {"BAYES_99", 1}},
+	}
+	if out := s.Snapshot(2); !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+	for _, n := range []int{0, -1} {
+		if out := s.Snapshot(n); len(out.TopRules) != 3 {
+			t.Errorf("Snapshot(%d): %#v", n, out.TopRules)
+		}
+	}
+
+	// First two responses should expire.
+	now = now.Add(40 * time.Second)
+	want = StatsSnapshot{
+		Window:    time.Minute,
+		Total:     2,
+		Spam:      2,
+		SpamRatio: 1,
+		MeanScore: 9.5,
+		Histogram: []HistogramBucket{{0, 0}, {5, 0}, {math.Inf(1), 2}},
+		TopRules:  []RuleCount{{"BAYES_99", 1}, {"NO_RELAYS", 1}},
+	}
+	if out := s.Snapshot(10); !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	// Everything expired.
+	now = now.Add(time.Hour)
+	if out := s.Snapshot(10); out.Total != 0 || out.SpamRatio != 0 || len(out.TopRules) != 0 {
+		t.Errorf("not empty: %#v", out)
+	}
+}
@@ -0,0 +1,73 @@
+package spamc
+
+// Names of some commonly used SpamAssassin rules.
+const (
+	SymbolGTUBE          = "GTUBE"
+	SymbolBayes00        = "BAYES_00"
+	SymbolBayes50        = "BAYES_50"
+	SymbolBayes99        = "BAYES_99"
+	SymbolBayes999       = "BAYES_999"
+	SymbolDKIMSigned     = "DKIM_SIGNED"
+	SymbolDKIMValid      = "DKIM_VALID"
+	SymbolDKIMValidAU    = "DKIM_VALID_AU"
+	SymbolSPFPass        = "SPF_PASS"
+	SymbolSPFFail        = "SPF_FAIL"
+	SymbolSPFSoftFail    = "SPF_SOFTFAIL"
+	SymbolRDNSNone       = "RDNS_NONE"
+	SymbolURIBLBlocked   = "URIBL_BLOCKED"
+	SymbolHTMLMessage    = "HTML_MESSAGE"
+	SymbolMissingHeaders = "MISSING_HEADERS"
+	SymbolInvalidDate    = "INVALID_DATE"
+	SymbolNoRelays       = "NO_RELAYS"
+	SymbolNoReceived     = "NO_RECEIVED"
+)
+
+// SymbolSet is a list of SpamAssassin rules that matched a message.
+//
+// The helper methods make policy code easier to read; for example:
+//
+//   if s.Contains(SymbolGTUBE) || s.All(SymbolBayes99, SymbolRDNSNone) {
+//       // reject
+//   }
+type SymbolSet []string
+
+// Contains reports if the symbol is in the set.
+func (s SymbolSet) Contains(symbol string) bool {
+	for _, v := range s {
+		if v == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// Any reports if at least one of the symbols is in the set.
+func (s SymbolSet) Any(symbols ...string) bool {
+	for _, v := range symbols {
+		if s.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// All reports if all of the symbols are in the set.
+func (s SymbolSet) All(symbols ...string) bool {
+	for _, v := range symbols {
+		if !s.Contains(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersect returns the symbols that are in both sets, in the order of s.
+func (s SymbolSet) Intersect(other SymbolSet) SymbolSet {
+	var r SymbolSet
+	for _, v := range s {
+		if other.Contains(v) && !r.Contains(v) {
+			r = append(r, v)
+		}
+	}
+	return r
+}
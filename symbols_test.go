@@ -0,0 +1,29 @@
+package spamc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSymbolSet(t *testing.T) {
+	s := SymbolSet{SymbolBayes99, SymbolRDNSNone, SymbolHTMLMessage}
+
+	if !s.Contains(SymbolBayes99) || s.Contains(SymbolGTUBE) {
+		t.Error("Contains")
+	}
+	if !s.Any(SymbolGTUBE, SymbolRDNSNone) || s.Any(SymbolGTUBE) || s.Any() {
+		t.Error("Any")
+	}
+	if !s.All(SymbolBayes99, SymbolRDNSNone) || s.All(SymbolBayes99, SymbolGTUBE) || !s.All() {
+		t.Error("All")
+	}
+
+	out := s.Intersect(SymbolSet{SymbolHTMLMessage, SymbolGTUBE, SymbolBayes99})
+	want := SymbolSet{SymbolBayes99, SymbolHTMLMessage}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Intersect\nout:  %#v\nwant: %#v\n", out, want)
+	}
+	if out := s.Intersect(nil); out != nil {
+		t.Errorf("Intersect with nil: %#v", out)
+	}
+}
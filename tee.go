@@ -0,0 +1,27 @@
+package spamc
+
+import (
+	"context"
+	"io"
+)
+
+type teeKey struct{}
+
+// ContextWithTee returns a copy of ctx which copies the message of commands
+// sent with it to w as it's sent to spamd, for example to archive it without
+// having to read a non-seekable message twice:
+//
+//   f, _ := os.Create("archive.eml")
+//   r, err := c.Check(spamc.ContextWithTee(ctx, f), msg, hdr)
+//
+// The bytes written to w are exactly the message that was sent, after the
+// Preprocessor was run. An error from w aborts the command. Commands with a tee
+// aren't retried, as w would get the message more than once.
+func ContextWithTee(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, teeKey{}, w)
+}
+
+func teeFromContext(ctx context.Context) io.Writer {
+	w, _ := ctx.Value(teeKey{}).(io.Writer)
+	return w
+}
@@ -0,0 +1,55 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/test"
+)
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestTee(t *testing.T) {
+	t.Run("tee", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		msg := ioutil.NopCloser(strings.NewReader("A message"))
+		_, err := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n").
+			Check(ContextWithTee(context.Background(), buf), msg, Header{}.Set("Content-length", "9"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "A message" {
+			t.Errorf("wrong tee: %q", buf.String())
+		}
+	})
+
+	t.Run("preprocessor", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		c := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n")
+		c.Preprocessor = PreprocessorFunc(func(msg io.Reader) (io.Reader, error) {
+			return strings.NewReader("Preprocessed"), nil
+		})
+		_, err := c.Check(ContextWithTee(context.Background(), buf), strings.NewReader("A message"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "Preprocessed" {
+			t.Errorf("wrong tee: %q", buf.String())
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := newClient("SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.0 / 5.0\r\n\r\n").
+			Check(ContextWithTee(context.Background(), errWriter{}), strings.NewReader("A message"), nil)
+		if !test.ErrorContains(err, "disk full") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
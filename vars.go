@@ -0,0 +1,68 @@
+package spamc
+
+import "io/ioutil"
+
+// AsVars returns the score in the format of the old Vars map, with the
+// isSpam, spamScore, and baseSpamScore keys.
+func (r ResponseScore) AsVars() map[string]interface{} {
+	return map[string]interface{}{
+		"isSpam":        r.IsSpam,
+		"spamScore":     r.Score,
+		"baseSpamScore": r.BaseScore,
+	}
+}
+
+// AsVars returns the response in the format of the old Vars map; the symbols
+// are in symbolList.
+func (r ResponseSymbols) AsVars() map[string]interface{} {
+	vars := r.ResponseScore.AsVars()
+	vars["symbolList"] = []string(r.Symbols)
+	return vars
+}
+
+// AsVars returns the response in the format of the old Vars map; the report
+// is in report.
+func (r ResponseReport) AsVars() map[string]interface{} {
+	vars := r.ResponseScore.AsVars()
+	vars["report"] = r.Report.asVars()
+	return vars
+}
+
+// AsVars returns the response in the format of the old Vars map; the symbols
+// are in symbolList and the report in report.
+func (r ResponseFull) AsVars() map[string]interface{} {
+	vars := r.ResponseScore.AsVars()
+	vars["symbolList"] = []string(r.Symbols)
+	vars["report"] = r.Report.asVars()
+	return vars
+}
+
+// AsVars returns the response in the format of the old Vars map; the message
+// is in body.
+//
+// This reads and closes the Message.
+func (r ResponseProcess) AsVars() (map[string]interface{}, error) {
+	defer r.Message.Close() // nolint: errcheck
+
+	body, err := ioutil.ReadAll(r.Message)
+	if err != nil {
+		return nil, err
+	}
+	vars := r.ResponseScore.AsVars()
+	vars["body"] = string(body)
+	return vars, nil
+}
+
+// asVars converts the report table to the old format, with a score, symbol,
+// and message for every row.
+func (r Report) asVars() []map[string]interface{} {
+	rows := make([]map[string]interface{}, len(r.Table))
+	for i, row := range r.Table {
+		rows[i] = map[string]interface{}{
+			"score":   row.Points,
+			"symbol":  row.Rule,
+			"message": row.Description,
+		}
+	}
+	return rows
+}
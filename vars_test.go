@@ -0,0 +1,49 @@
+package spamc
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAsVars(t *testing.T) {
+	score := ResponseScore{IsSpam: true, Score: 6.5, BaseScore: 5}
+	report := Report{Table: []ReportRow{{Points: 3.5, Rule: "BAYES_99", Description: "Bayes 99%"}}}
+
+	t.Run("full", func(t *testing.T) {
+		out := ResponseFull{ResponseScore: score, Symbols: SymbolSet{"BAYES_99"}, Report: report}.AsVars()
+		want := map[string]interface{}{
+			"isSpam":        true,
+			"spamScore":     6.5,
+			"baseSpamScore": 5.0,
+			"symbolList":    []string{"BAYES_99"},
+			"report": []map[string]interface{}{
+				{"score": 3.5, "symbol": "BAYES_99", "message": "Bayes 99%"},
+			},
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		out := (&ResponseCheck{ResponseScore: score}).AsVars()
+		if len(out) != 3 || out["spamScore"] != 6.5 {
+			t.Errorf("wrong vars: %#v", out)
+		}
+	})
+
+	t.Run("process", func(t *testing.T) {
+		out, err := ResponseProcess{
+			ResponseScore: score,
+			Message:       ioutil.NopCloser(strings.NewReader("Subject: x\r\n\r\nbody")),
+		}.AsVars()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out["body"] != "Subject: x\r\n\r\nbody" || out["isSpam"] != true {
+			t.Errorf("wrong vars: %#v", out)
+		}
+	})
+}
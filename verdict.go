@@ -0,0 +1,158 @@
+package spamc
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Verdict is the outcome of scanning a message, in a form that can be sent to
+// other systems; for example as JSON to a webhook. It's passed to the
+// OnVerdict hook and the VerdictSink.
+type Verdict struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	User    string    `json:"user,omitempty"`
+
+	IsSpam    bool    `json:"is_spam"`
+	Score     float64 `json:"score"`
+	BaseScore float64 `json:"base_score"`
+
+	// Symbols that matched; this is only set for commands that return them,
+	// such as SYMBOLS and REPORT.
+	Symbols SymbolSet `json:"symbols,omitempty"`
+
+	// Metadata from the command's context.
+	Metadata Metadata `json:"metadata,omitempty"`
+
+	// Degraded is set if the verdict is from the Client's OnUnavailable
+	// fallback rather than from spamd.
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// VerdictSink receives verdicts, for example to log, store, or forward them.
+type VerdictSink interface {
+	// Accept the verdict. This is called before the command returns, so
+	// slow sinks should do their work in the background.
+	Accept(ctx context.Context, v Verdict) error
+}
+
+// VerdictSinkFunc is an adapter to allow the use of ordinary functions as a
+// VerdictSink.
+type VerdictSinkFunc func(ctx context.Context, v Verdict) error
+
+// Accept calls f(ctx, v).
+func (f VerdictSinkFunc) Accept(ctx context.Context, v Verdict) error { return f(ctx, v) }
+
+// MultiSink returns a VerdictSink which sends verdicts to all sinks, in order.
+// All sinks are called even if one of them fails; the error is a SinkErrors
+// if more than one failed.
+func MultiSink(sinks ...VerdictSink) VerdictSink {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return multiSink(sinks)
+}
+
+type multiSink []VerdictSink
+
+func (m multiSink) Accept(ctx context.Context, v Verdict) error {
+	var errs SinkErrors
+	for _, s := range m {
+		if err := s.Accept(ctx, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// SinkErrors are the errors from a MultiSink.
+type SinkErrors []error
+
+func (e SinkErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// LogSink is a VerdictSink which logs verdicts at the Info level.
+func LogSink(l Logger) VerdictSink {
+	return VerdictSinkFunc(func(ctx context.Context, v Verdict) error {
+		l.Info("verdict", "command", v.Command, "user", v.User,
+			"spam", v.IsSpam, "score", v.Score)
+		return nil
+	})
+}
+
+// WithVerdictSink sets the VerdictSink; multiple sinks are combined with
+// MultiSink().
+func WithVerdictSink(sinks ...VerdictSink) Option {
+	return func(c *Client) { c.VerdictSink = MultiSink(sinks...) }
+}
+
+// WithOnVerdict sets the OnVerdict hook.
+func WithOnVerdict(f func(context.Context, Verdict)) Option {
+	return func(c *Client) { c.OnVerdict = f }
+}
+
+// newVerdict creates a Verdict for a command.
+func newVerdict(
+	ctx context.Context,
+	cmd, user string,
+	score ResponseScore,
+	symbols SymbolSet,
+) Verdict {
+
+	return Verdict{
+		Time:      time.Now(),
+		Command:   cmd,
+		User:      user,
+		IsSpam:    score.IsSpam,
+		Score:     score.Score,
+		BaseScore: score.BaseScore,
+		Symbols:   symbols,
+		Metadata:  MetadataFromContext(ctx),
+	}
+}
+
+// verdictFor creates a Verdict from the response to one of the built-in
+// commands that have a score; ok is false for other responses.
+func verdictFor(ctx context.Context, cmd, user string, r interface{}) (v Verdict, ok bool) {
+	switch r := r.(type) {
+	case *ResponseCheck:
+		return newVerdict(ctx, cmd, user, r.ResponseScore, nil), true
+	case *ResponseSymbols:
+		return newVerdict(ctx, cmd, user, r.ResponseScore, r.Symbols), true
+	case *ResponseReport:
+		return newVerdict(ctx, cmd, user, r.ResponseScore, r.Report.Symbols()), true
+	case *ResponseFull:
+		return newVerdict(ctx, cmd, user, r.ResponseScore, r.Symbols), true
+	}
+	return Verdict{}, false
+}
+
+// hasVerdictHooks reports if the OnVerdict hook or the VerdictSink is set.
+func (c *Client) hasVerdictHooks() bool {
+	return c.OnVerdict != nil || c.VerdictSink != nil
+}
+
+// emitVerdict calls the OnVerdict hook and the VerdictSink, if any.
+func (c *Client) emitVerdict(ctx context.Context, v Verdict) {
+	if c.OnVerdict != nil {
+		c.OnVerdict(ctx, v)
+	}
+	if c.VerdictSink != nil {
+		if err := c.VerdictSink.Accept(ctx, v); err != nil {
+			c.log().Warn("verdict sink failed", "cmd", v.Command, "user", v.User, "error", err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package spamc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestOnVerdict(t *testing.T) {
+	var out []Verdict
+	c := New("", replyDialer{func(req string) string {
+		switch {
+		case strings.HasPrefix(req, cmdSymbols):
+			return "SPAMD/1.1 0 EX_OK\r\nSpam: True ; 1000.0 / 5.0\r\n\r\nGTUBE,NO_RECEIVED"
+		case strings.HasPrefix(req, cmdPing):
+			return "SPAMD/1.5 0 PONG\r\n"
+		}
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.5 / 5.0\r\n\r\n"
+	}}, WithDefaultUser("default"), WithOnVerdict(func(ctx context.Context, v Verdict) {
+		if time.Since(v.Time) > time.Minute {
+			t.Errorf("wrong time: %v", v.Time)
+		}
+		v.Time = time.Time{}
+		out = append(out, v)
+	}))
+
+	ctx := ContextWithMetadata(context.Background(), Metadata{"queue": "q1"})
+	if _, err := c.Check(ctx, strings.NewReader("A message"), nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Symbols(context.Background(), strings.NewReader("A message"), Header{}.Set("User", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Verdict{
+		{Command: "CHECK", User: "default", Score: 1.5, BaseScore: 5, Metadata: Metadata{"queue": "q1"}},
+		{Command: "SYMBOLS", User: "a", IsSpam: true, Score: 1000, BaseScore: 5,
+			Symbols: SymbolSet{"GTUBE", "NO_RECEIVED"}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
+
+func TestVerdictSink(t *testing.T) {
+	var calls []string
+	sink := func(name string, err error) VerdictSink {
+		return VerdictSinkFunc(func(ctx context.Context, v Verdict) error {
+			calls = append(calls, name+" "+v.User)
+			return err
+		})
+	}
+
+	l := &testLogger{}
+	c := New("", replyDialer{func(req string) string {
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.5 / 5.0\r\n\r\n"
+	}}, WithLogger(l), WithVerdictSink(
+		sink("a", nil),
+		sink("b", errors.New("oops")),
+		sink("c", errors.New("oh no")),
+		LogSink(l),
+	))
+
+	_, err := c.Check(context.Background(), strings.NewReader("A message"), Header{}.Set("User", "u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := []string{"a u", "b u", "c u"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", calls, wantCalls)
+	}
+	wantLog := []string{
+		"info: verdict [command CHECK user u spam false score 1.5]",
+		"warn: verdict sink failed [cmd CHECK user u error oops; oh no]",
+	}
+	if !reflect.DeepEqual(l.msgs, wantLog) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", l.msgs, wantLog)
+	}
+}
@@ -0,0 +1,58 @@
+package spamc
+
+import "context"
+
+// ParseMode controls how responses that can't be fully parsed are handled.
+type ParseMode int
+
+// Parse modes.
+const (
+	// ParseLenient skips the parts of a response that can't be parsed, with
+	// a warning; see Client.OnParseWarning. This is the default.
+	ParseLenient ParseMode = iota
+
+	// ParseStrict returns a ProtocolError if any part of a response can't be
+	// parsed, such as a malformed report line. This is useful in tests and
+	// QA environments, to detect changes in spamd's output early.
+	ParseStrict
+)
+
+// WithParseMode sets the ParseMode.
+func WithParseMode(m ParseMode) Option {
+	return func(c *Client) { c.ParseMode = m }
+}
+
+// WithOnParseWarning sets OnParseWarning.
+func WithOnParseWarning(f func(ctx context.Context, cmd, warning string)) Option {
+	return func(c *Client) { c.OnParseWarning = f }
+}
+
+// warningsOf returns the parse warnings of a response from a built-in parser.
+func warningsOf(r interface{}) []string {
+	switch r := r.(type) {
+	case *ResponseCheck:
+		return r.Warnings
+	case *ResponseSymbols:
+		return r.Warnings
+	case *ResponseReport:
+		return r.Warnings
+	case *ResponseFull:
+		return r.Warnings
+	}
+	return nil
+}
+
+// parseWarnings logs the warnings and calls OnParseWarning, or returns an
+// error for the first warning with ParseStrict.
+func (c *Client) parseWarnings(ctx context.Context, cmd string, warnings []string) error {
+	if c.ParseMode == ParseStrict && len(warnings) > 0 {
+		return protocolErrorf("could not parse response to %v: %v", cmd, warnings[0])
+	}
+	for _, w := range warnings {
+		c.log().Warn("could not parse response", "cmd", cmd, "warning", w)
+		if c.OnParseWarning != nil {
+			c.OnParseWarning(ctx, cmd, w)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package spamc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestParseWarnings(t *testing.T) {
+	cases := []struct {
+		cmd, body string
+		want      []string
+	}{
+		{cmdSymbols, "INVALID_DATE,MISSING_HEADERS", nil},
+		{cmdSymbols, "INVALID_DATE,,MISSING HEADERS", []string{
+			"empty symbol",
+			`malformed symbol: "MISSING HEADERS"`,
+		}},
+		{cmdReport, "Intro\n\n" +
+			" pts rule name              description\n" +
+			"---- ---------------------- --------------------------------------------------\n" +
+			" 0.4 INVALID_DATE           Invalid Date: header (not RFC 2822)\n" +
+			"                            continued description\n", nil},
+		{cmdReport, "Intro\n\n" +
+			" pts rule name              description\n" +
+			"---- ---------------------- --------------------------------------------------\n" +
+			" 0.4 INVALID_DATE           Invalid Date: header (not RFC 2822)\n" +
+			"xx MISSING_HEADERS\n" +
+			"1.2.3 MISSING_HEADERS        Missing To: header\n", []string{
+			`malformed report line: "xx MISSING_HEADERS"`,
+			`invalid points in report line: "1.2.3 MISSING_HEADERS        Missing To: header"`,
+		}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			var (
+				hook []string
+				l    = &testLogger{}
+			)
+			c := New("", replyDialer{func(req string) string {
+				return "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.6 / 5.0\r\n\r\n" + tc.body
+			}}, WithLogger(l), WithOnParseWarning(func(ctx context.Context, cmd, w string) {
+				hook = append(hook, cmd+": "+w)
+			}))
+
+			r, err := c.Exec(context.Background(), tc.cmd, strings.NewReader("Message"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := warningsOf(r)
+			if !reflect.DeepEqual(out, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+			if len(hook) != len(tc.want) || len(l.msgs) != len(tc.want) {
+				t.Errorf("wrong number of calls\nhook: %#v\nlog:  %#v\n", hook, l.msgs)
+			}
+			for j, w := range tc.want {
+				if j < len(hook) && hook[j] != tc.cmd+": "+w {
+					t.Errorf("wrong hook call\nout:  %#v\nwant: %#v\n", hook[j], tc.cmd+": "+w)
+				}
+			}
+		})
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	cases := []struct {
+		spam, body, wantErr string
+	}{
+		{"False ; 1.6 / 5.0", "INVALID_DATE,MISSING_HEADERS", ""},
+		{"False ; 1.6 / 5.0", "INVALID_DATE,,MISSING_HEADERS",
+			"could not parse response to SYMBOLS: empty symbol"},
+		{"False ; 1.6", "INVALID_DATE,MISSING_HEADERS",
+			`could not parse response to SYMBOLS: missing base score in Spam header: "False ; 1.6"`},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			c := New("", replyDialer{func(req string) string {
+				return "SPAMD/1.1 0 EX_OK\r\nSpam: " + tc.spam + "\r\n\r\n" + tc.body
+			}}, WithParseMode(ParseStrict))
+
+			_, err := c.Symbols(context.Background(), strings.NewReader("Message"), nil)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if tc.wantErr != "" && !IsProtocolError(err) {
+				t.Errorf("not a protocol error: %#v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Package webhook POSTs spamc verdicts as JSON to a URL, for example to alert
+// an abuse team about high-scoring messages.
+//
+// Connect it to a Client as a VerdictSink:
+//
+//   n := webhook.New("https://soc.example.com/hooks/spam", secret, 15)
+//   client := spamc.New(addr, nil, spamc.WithVerdictSink(n))
+//   defer n.Wait()
+//
+// The request body is the JSON-encoded spamc.Verdict. If a Secret is set, the
+// body is signed with HMAC-SHA256 and the signature is sent in the
+// X-Spamc-Signature header as "sha256=<hex>"; receivers can check it with
+// Verify().
+package webhook // import "github.com/teamwork/spamc/webhook"
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/teamwork/spamc"
+)
+
+// SignatureHeader is the header with the HMAC signature of the body.
+const SignatureHeader = "X-Spamc-Signature"
+
+// Notifier sends verdicts to a webhook; it's safe for concurrent use.
+type Notifier struct {
+	// URL to POST the verdicts to.
+	URL string
+
+	// Secret to sign the request body with; requests aren't signed if this
+	// is empty.
+	Secret []byte
+
+	// Threshold is the score from which OnVerdict() and Accept() send a
+	// verdict.
+	Threshold float64
+
+	// Attempts is the maximum number of times a request is sent; requests
+	// are retried on connection errors and 5xx and 429 responses. Backoff is
+	// the delay before the first retry, and is doubled for every following
+	// retry.
+	Attempts int
+	Backoff  time.Duration
+
+	// Client to send requests with; this defaults to a client with a 10
+	// second timeout.
+	Client *http.Client
+
+	// OnError is called if a verdict couldn't be sent by OnVerdict() or
+	// Accept().
+	OnError func(error, spamc.Verdict)
+
+	wg sync.WaitGroup
+}
+
+// New creates a new Notifier which retries failed requests 3 times.
+func New(url string, secret []byte, threshold float64) *Notifier {
+	return &Notifier{
+		URL:       url,
+		Secret:    secret,
+		Threshold: threshold,
+		Attempts:  3,
+		Backoff:   time.Second,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// OnVerdict sends v in the background if its score is equal to or higher than
+// the Threshold. It can be used as the Client's OnVerdict hook.
+func (n *Notifier) OnVerdict(ctx context.Context, v spamc.Verdict) {
+	if v.Score < n.Threshold {
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		// Don't use ctx, as it's usually canceled once the command returns.
+		if err := n.Notify(context.Background(), v); err != nil && n.OnError != nil {
+			n.OnError(err, v)
+		}
+	}()
+}
+
+// Accept is the same as OnVerdict(), to implement spamc.VerdictSink. Errors
+// are reported to OnError, as the verdict is sent in the background.
+func (n *Notifier) Accept(ctx context.Context, v spamc.Verdict) error {
+	n.OnVerdict(ctx, v)
+	return nil
+}
+
+// Wait until all verdicts sent by OnVerdict() are finished.
+func (n *Notifier) Wait() { n.wg.Wait() }
+
+// Notify sends v to the webhook, regardless of the Threshold.
+func (n *Notifier) Notify(ctx context.Context, v spamc.Verdict) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "could not encode verdict")
+	}
+
+	attempts := n.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := n.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= attempts {
+			return errors.Wrapf(err, "could not send verdict to %v", n.URL)
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return errors.Wrapf(ctx.Err(), "could not send verdict to %v", n.URL)
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// post the body once; retry is true if the request can be retried.
+func (n *Notifier) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(n.Secret, body))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	// Read the body so the connection can be reused.
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		errors.Errorf("unexpected status %v", resp.Status)
+}
+
+// Sign returns the signature for body, as sent in the X-Spamc-Signature
+// header.
+func Sign(secret, body []byte) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write(body) // nolint: errcheck
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify reports if signature is a valid signature for body.
+func Verify(secret, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/teamwork/spamc"
+)
+
+func TestNotifier(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+		got   []spamc.Verdict
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if !Verify([]byte("secret"), body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("invalid signature %q", r.Header.Get(SignatureHeader))
+		}
+		var v spamc.Verdict
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Error(err)
+		}
+		got = append(got, v)
+	}))
+	defer srv.Close()
+
+	n := New(srv.URL, []byte("secret"), 10)
+	n.Backoff = 0
+	n.OnError = func(err error, v spamc.Verdict) { t.Error(err) }
+
+	n.OnVerdict(context.Background(), spamc.Verdict{User: "low", Score: 9.9})
+	n.OnVerdict(context.Background(), spamc.Verdict{
+		User: "high", Score: 12, IsSpam: true, Symbols: spamc.SymbolSet{"GTUBE"},
+	})
+	n.Wait()
+
+	want := []spamc.Verdict{{User: "high", Score: 12, IsSpam: true, Symbols: spamc.SymbolSet{"GTUBE"}}}
+	if calls != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("\nout:  %d %#v\nwant: 2 %#v\n", calls, got, want)
+	}
+}
+
+func TestNotifierError(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	n := New(srv.URL, nil, 0)
+	err := n.Notify(context.Background(), spamc.Verdict{})
+	if err == nil {
+		t.Fatal("error is nil")
+	}
+	if calls != 1 {
+		t.Errorf("4xx responses retried: %v calls", calls)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		sig  string
+		want bool
+	}{
+		{Sign([]byte("secret"), []byte("body")), true},
+		{Sign([]byte("other"), []byte("body")), false},
+		{"", false},
+		{"sha256=", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sig, func(t *testing.T) {
+			out := Verify([]byte("secret"), []byte("body"), tt.sig)
+			if out != tt.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tt.want)
+			}
+		})
+	}
+}
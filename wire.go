@@ -0,0 +1,93 @@
+package spamc
+
+import (
+	"bytes"
+	"io"
+	"net"
+)
+
+// defaultDebugBodyLimit is the number of body bytes recorded if
+// Client.DebugBodyLimit is 0.
+const defaultDebugBodyLimit = 4096
+
+// maxDebugHeader is the maximum number of bytes recorded while looking for
+// the end of the response headers.
+const maxDebugHeader = 64 * 1024
+
+// Wire is a snapshot of the raw data exchanged with spamd; it's only recorded
+// if Client.Debug is set.
+type Wire struct {
+	// Request is the command line and headers, without the message.
+	Request []byte
+
+	// Response is the response line, headers, and the start of the body, up
+	// to Client.DebugBodyLimit bytes.
+	//
+	// For Process() and Headers() the body is recorded as the Message is
+	// read.
+	Response []byte
+
+	limit     int
+	headerLen int
+}
+
+func newWire(limit int) *Wire {
+	if limit <= 0 {
+		limit = defaultDebugBodyLimit
+	}
+	return &Wire{limit: limit}
+}
+
+// record data read from spamd.
+func (w *Wire) record(p []byte) {
+	if w.headerLen == 0 {
+		w.Response = append(w.Response, p...)
+		if i := bytes.Index(w.Response, []byte("\r\n\r\n")); i >= 0 {
+			w.headerLen = i + 4
+		}
+		if max := w.headerLen + w.limit; w.headerLen > 0 && len(w.Response) > max {
+			w.Response = w.Response[:max]
+		} else if len(w.Response) > maxDebugHeader+w.limit {
+			w.Response = w.Response[:maxDebugHeader+w.limit]
+		}
+		return
+	}
+
+	room := w.headerLen + w.limit - len(w.Response)
+	if room <= 0 {
+		return
+	}
+	if len(p) > room {
+		p = p[:room]
+	}
+	w.Response = append(w.Response, p...)
+}
+
+// respConn is the connection a response is read from. Errors other than
+// io.EOF are wrapped in an OpError, the data is recorded if wire is set, and
+// the OnCommand hook is called on Close().
+type respConn struct {
+	net.Conn
+	addr string
+	user string
+	wire *Wire
+	done *cmdDone
+}
+
+func (c respConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.wire != nil && n > 0 {
+		c.wire.record(b[:n])
+	}
+	if err != nil && err != io.EOF {
+		err = newOpError("read", c.addr, err)
+		c.done.fail(err)
+	}
+	return n, err
+}
+
+func (c respConn) Close() error {
+	err := c.Conn.Close()
+	c.done.finish()
+	return err
+}
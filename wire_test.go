@@ -0,0 +1,65 @@
+package spamc
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWireRecord(t *testing.T) {
+	cases := []struct {
+		in    []string
+		limit int
+		want  string
+	}{
+		{[]string{"SPAMD/1.1 0 EX_OK\r\n\r\nbody"}, 10, "SPAMD/1.1 0 EX_OK\r\n\r\nbody"},
+		{[]string{"SPAMD/1.1 0 EX_OK\r\n\r\nbody"}, 2, "SPAMD/1.1 0 EX_OK\r\n\r\nbo"},
+		{[]string{"SPAMD/1.1 0 EX_OK\r", "\n\r\nbo", "dy"}, 3, "SPAMD/1.1 0 EX_OK\r\n\r\nbod"},
+		{[]string{"SPAMD/1.1 0 EX_OK\r\n\r\n", "body", "more"}, 6, "SPAMD/1.1 0 EX_OK\r\n\r\nbodymo"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			w := newWire(tc.limit)
+			for _, p := range tc.in {
+				w.record([]byte(p))
+			}
+			if out := string(w.Response); out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestDebug(t *testing.T) {
+	resp := "SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\nSubject: x\r\n\r\nA long body"
+
+	c := newClient(resp).Clone(WithDebug(4))
+	r, err := c.Process(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r.Message); err != nil {
+		t.Fatal(err)
+	}
+	r.Message.Close() // nolint: errcheck
+
+	if r.Wire == nil {
+		t.Fatal("Wire not set")
+	}
+	if want := "PROCESS SPAMC/1.5\r\nContent-length: 9\r\n\r\n"; string(r.Wire.Request) != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", string(r.Wire.Request), want)
+	}
+	if want := "SPAMD/1.1 0 EX_OK\r\nSpam: no; 0.1 / 5.0\r\n\r\nSubj"; string(r.Wire.Response) != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", string(r.Wire.Response), want)
+	}
+
+	r2, err := newClient(resp).Check(context.Background(), strings.NewReader("A message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.Wire != nil {
+		t.Errorf("Wire set without Debug: %#v", r2.Wire)
+	}
+}
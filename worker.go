@@ -0,0 +1,82 @@
+package spamc
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataUser is the Metadata key for the user to scan a message for in
+// Scan() and Handler().
+const MetadataUser = "user"
+
+// ScanFunc scans a message and returns its verdict; Client.Scan is a ScanFunc.
+type ScanFunc func(ctx context.Context, msg []byte, md Metadata) (Verdict, error)
+
+// Scan scans msg with the SYMBOLS command and returns its verdict, for
+// pipelines which receive messages from a queue rather than from a reader.
+//
+// md is attached to ctx, so it's available to hooks and in the verdict's
+// Metadata. The User header is set from md[MetadataUser] if it's not empty.
+//
+// The verdict is from the OnUnavailable fallback if spamd is unavailable and
+// the fallback is set; its Degraded field is set.
+func (c *Client) Scan(ctx context.Context, msg []byte, md Metadata) (Verdict, error) {
+	if len(md) > 0 {
+		ctx = ContextWithMetadata(ctx, md)
+	}
+	var hdr Header
+	if u := md[MetadataUser]; u != "" {
+		hdr = Header{}.Set("User", u)
+	}
+
+	r, sentUser, fallback, err := c.exec(ctx, cmdSymbols, bytes.NewReader(msg), hdr)
+	if err != nil {
+		return Verdict{}, err
+	}
+	if fallback != nil {
+		return *fallback, nil
+	}
+	v, ok := verdictFor(ctx, cmdSymbols, sentUser, r)
+	if !ok {
+		return Verdict{}, parserTypeError(cmdSymbols, r)
+	}
+	return v, nil
+}
+
+// BusHandler is a handler for messages from a message bus, such as Kafka or
+// NATS; md are the message's headers or other metadata. The bus should
+// redeliver the message if an error is returned.
+type BusHandler func(ctx context.Context, msg []byte, md Metadata) error
+
+// Handler returns a BusHandler which scans messages with Scan() and sends the
+// verdicts to sink. For example with NATS:
+//
+//   h := client.Handler(sink)
+//   sub, err := js.Subscribe("mail.incoming", func(m *nats.Msg) {
+//       md := spamc.Metadata{spamc.MetadataUser: m.Header.Get("Rcpt")}
+//       if err := h(ctx, m.Data, md); err != nil {
+//           m.Nak()
+//           return
+//       }
+//       m.Ack()
+//   })
+//
+// The sink is called in addition to the Client's OnVerdict hook and
+// VerdictSink.
+func (c *Client) Handler(sink VerdictSink) BusHandler {
+	return func(ctx context.Context, msg []byte, md Metadata) error {
+		if len(md) > 0 {
+			ctx = ContextWithMetadata(ctx, md)
+		}
+		v, err := c.Scan(ctx, msg, md)
+		if err != nil {
+			return err
+		}
+		if err := sink.Accept(ctx, v); err != nil {
+			return errors.Wrap(err, "could not send verdict")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package spamc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestHandler(t *testing.T) {
+	c := New("", replyDialer{func(req string) string {
+		if strings.Contains(req, "User: unknown\r\n") {
+			return "SPAMD/1.1 67 EX_NOUSER\r\n\r\n"
+		}
+		if !strings.HasPrefix(req, cmdSymbols) {
+			t.Errorf("wrong command: %q", req)
+		}
+		return "SPAMD/1.1 0 EX_OK\r\nSpam: True ; 6.0 / 5.0\r\n\r\nNO_RECEIVED"
+	}}, WithDefaultUser("default"))
+
+	var out []Verdict
+	sinkErr := error(nil)
+	h := c.Handler(VerdictSinkFunc(func(ctx context.Context, v Verdict) error {
+		if !reflect.DeepEqual(MetadataFromContext(ctx), v.Metadata) {
+			t.Errorf("metadata not in context: %#v", MetadataFromContext(ctx))
+		}
+		v.Time = time.Time{}
+		out = append(out, v)
+		return sinkErr
+	}))
+
+	if err := h(context.Background(), []byte("A message"), Metadata{MetadataUser: "a", "id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h(context.Background(), []byte("A message"), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []Verdict{
+		{Command: "SYMBOLS", User: "a", IsSpam: true, Score: 6, BaseScore: 5,
+			Symbols: SymbolSet{"NO_RECEIVED"}, Metadata: Metadata{"user": "a", "id": "1"}},
+		{Command: "SYMBOLS", User: "default", IsSpam: true, Score: 6, BaseScore: 5,
+			Symbols: SymbolSet{"NO_RECEIVED"}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		err := h(context.Background(), []byte("A message"), Metadata{MetadataUser: "unknown"})
+		if ExitCode(err, false) != ExNoUser {
+			t.Errorf("wrong error: %v", err)
+		}
+
+		sinkErr = errors.New("oops")
+		err = h(context.Background(), []byte("A message"), nil)
+		if errors.Cause(err) != sinkErr {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
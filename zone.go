@@ -0,0 +1,78 @@
+package spamc
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ZoneAware returns a Balancer for backends in several availability zones,
+// which prefers the backends in the local zone and only sends commands to
+// other zones if all local backends are failing or saturated:
+//
+//   WithBalancer(ZoneAware("eu-west-1a", map[string]string{
+//       "10.0.1.10:783": "eu-west-1a",
+//       "10.0.1.11:783": "eu-west-1a",
+//       "10.0.2.10:783": "eu-west-1b",
+//   }, 8))
+//
+// zones has the zone of every backend; backends that aren't in it are
+// considered remote. A backend is saturated if it has maxActive or more
+// commands in progress, or if it's at its connection limit (see
+// WithBackendLimits()). maxActive is ignored if it's 0.
+//
+// Within a zone, the backend with the lowest connection latency relative to
+// its number of commands in progress is picked.
+func ZoneAware(zone string, zones map[string]string, maxActive int) Balancer {
+	return &zoneAware{zone: zone, zones: zones, maxActive: maxActive}
+}
+
+type zoneAware struct {
+	zone      string
+	zones     map[string]string
+	maxActive int
+	next      uint32
+}
+
+func (z *zoneAware) Pick(backends []Backend) string {
+	usable := func(b Backend) bool {
+		return !b.Failing && (z.maxActive <= 0 || b.Active < z.maxActive)
+	}
+
+	var local, remote []Backend
+	for _, b := range backends {
+		if !usable(b) {
+			continue
+		}
+		if z.zones[b.Addr] == z.zone {
+			local = append(local, b)
+		} else {
+			remote = append(remote, b)
+		}
+	}
+
+	switch {
+	case len(local) > 0:
+		return z.fastest(local)
+	case len(remote) > 0:
+		return z.fastest(remote)
+	default:
+		return z.fastest(backends)
+	}
+}
+
+// fastest returns the backend with the lowest latency multiplied by the number
+// of commands that would be in progress; ties are broken with round-robin.
+func (z *zoneAware) fastest(backends []Backend) string {
+	cost := func(b Backend) time.Duration {
+		return b.Latency * time.Duration(b.Active+1)
+	}
+
+	start := int(atomic.AddUint32(&z.next, 1)-1) % len(backends)
+	best := backends[start]
+	for i := 1; i < len(backends); i++ {
+		if b := backends[(start+i)%len(backends)]; cost(b) < cost(best) {
+			best = b
+		}
+	}
+	return best.Addr
+}
@@ -0,0 +1,37 @@
+package spamc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestZoneAware(t *testing.T) {
+	zones := map[string]string{"a1": "a", "a2": "a", "b1": "b"}
+	ms := time.Millisecond
+
+	cases := []struct {
+		backends []Backend
+		want     string
+	}{
+		{[]Backend{{Addr: "a1", Latency: 2 * ms}, {Addr: "a2", Latency: ms}, {Addr: "b1"}}, "a2"},
+		{[]Backend{{Addr: "a1", Latency: ms, Active: 2}, {Addr: "a2", Latency: 2 * ms}, {Addr: "b1"}}, "a2"},
+		{[]Backend{{Addr: "a1", Failing: true}, {Addr: "a2", Latency: 5 * ms}, {Addr: "b1", Latency: ms}}, "a2"},
+
+		// Spill over.
+		{[]Backend{{Addr: "a1", Failing: true}, {Addr: "a2", Active: 4}, {Addr: "b1", Latency: 9 * ms}}, "b1"},
+		{[]Backend{{Addr: "a1", Failing: true}, {Addr: "b1", Latency: ms}, {Addr: "c1", Latency: 2 * ms}}, "b1"},
+
+		// Everything is down.
+		{[]Backend{{Addr: "a1", Failing: true, Latency: ms}, {Addr: "b1", Failing: true, Latency: 2 * ms}}, "a1"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := ZoneAware("a", zones, 4).Pick(tc.backends)
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}